@@ -16,6 +16,7 @@ type AutoscalingConfiguration struct {
 	ServiceName     string                    `yaml:"service"`
 	HostNameAndPort string                    `yaml:"host"`
 	Prometheus      *prometheus.Configuration `yaml:"prometheus"`
+	Logging         *common.LoggingConfig     `yaml:"logging"`
 
 	// Autoscaling-specific fields
 	Autoscaling AutoscalingSettings `yaml:"autoscaling"`
@@ -170,5 +171,6 @@ func (c *AutoscalingConfiguration) ToCommonConfiguration() common.Configuration
 		ServiceName:     c.ServiceName,
 		HostNameAndPort: c.HostNameAndPort,
 		Prometheus:      c.Prometheus,
+		Logging:         c.Logging,
 	}
 }
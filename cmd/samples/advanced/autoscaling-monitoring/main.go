@@ -3,7 +3,6 @@ package main
 import (
 	"flag"
 	"fmt"
-	"net/http"
 	"os"
 	"path/filepath"
 	"time"
@@ -12,9 +11,6 @@ import (
 	"go.uber.org/cadence/client"
 
 	"github.com/uber-common/cadence-samples/cmd/samples/common"
-	"github.com/uber-go/tally"
-	"github.com/uber-go/tally/prometheus"
-	"go.uber.org/zap"
 )
 
 const (
@@ -63,7 +59,7 @@ func main() {
 	h.Config = config.ToCommonConfiguration()
 
 	// Set up logging
-	logger, err := zap.NewDevelopment()
+	logger, err := common.NewLogger(config.Logging)
 	if err != nil {
 		panic(fmt.Sprintf("Failed to setup logger: %v", err))
 	}
@@ -80,54 +76,17 @@ func main() {
 	}
 	h.Service = service
 
-	// Set up metrics scope with Tally Prometheus reporter
-	var (
-		safeCharacters  = []rune{'_'}
-		sanitizeOptions = tally.SanitizeOptions{
-			NameCharacters: tally.ValidCharacters{
-				Ranges:     tally.AlphanumericRange,
-				Characters: safeCharacters,
-			},
-			KeyCharacters: tally.ValidCharacters{
-				Ranges:     tally.AlphanumericRange,
-				Characters: safeCharacters,
-			},
-			ValueCharacters: tally.ValidCharacters{
-				Ranges:     tally.AlphanumericRange,
-				Characters: safeCharacters,
-			},
-			ReplacementCharacter: tally.DefaultReplacementCharacter,
-		}
-	)
-
-	// Create Prometheus reporter
-	reporter := prometheus.NewReporter(prometheus.Options{})
-
-	// Create root scope with proper options
-	scope, closer := tally.NewRootScope(tally.ScopeOptions{
-		Tags:            map[string]string{"service": "autoscaling-monitoring"},
-		SanitizeOptions: &sanitizeOptions,
-		CachedReporter:  reporter,
-	}, 10)
-	defer closer.Close()
-
-	// Set up metrics scope for helper
-	h.WorkerMetricScope = scope
-	h.ServiceMetricScope = scope
-
 	switch mode {
 	case "worker":
-		// Start metrics server only in worker mode
-		if config.Prometheus != nil {
-			go func() {
-				http.Handle("/metrics", reporter.HTTPHandler())
-				logger.Info("Starting Prometheus metrics server",
-					zap.String("port", config.Prometheus.ListenAddress))
-				if err := http.ListenAndServe(config.Prometheus.ListenAddress, nil); err != nil {
-					logger.Error("Failed to start metrics server", zap.Error(err))
-				}
-			}()
+		// Serve metrics only in worker mode, on the scrape endpoint shared by the samples. The worker metrics keep the
+		// names of the cadence client that the Grafana dashboard queries.
+		noPrefix := ""
+		h.Config.Metrics = &common.MetricsConfig{
+			Tags:         map[string]string{"service": ApplicationName},
+			WorkerPrefix: &noPrefix,
 		}
+		h.SetupMetrics()
+		defer h.Close()
 		startWorkers(&h, &config)
 	case "trigger":
 		startWorkflow(&h, &config)
@@ -0,0 +1,493 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/cadence"
+	"go.uber.org/cadence/activity"
+	"go.uber.org/cadence/client"
+	"go.uber.org/cadence/workflow"
+	"go.uber.org/zap"
+
+	"github.com/uber-common/cadence-samples/cmd/samples/common"
+)
+
+type (
+	// BatchParams is the input of batchWorkflow
+	BatchParams struct {
+		// Query selects the executions with a visibility query, e.g. `WorkflowType = "main.tripWorkflow" AND
+		// CloseTime = missing`. Without a query the open executions of WorkflowType are selected.
+		Query        string
+		WorkflowType string
+
+		// Operation is one of signal, cancel, terminate or reset
+		Operation   string
+		SignalName  string
+		SignalInput json.RawMessage
+		// Reason is recorded on terminated and reset executions
+		Reason     string
+		ResetPoint common.ResetPoint
+
+		// Concurrency is the number of executions operated on in parallel, defaults to 1
+		Concurrency int
+		// RPS limits the operations per second over all parallel batches, 0 does not limit
+		RPS float64
+		// DryRun reports the selected executions without changing them
+		DryRun   bool
+		PageSize int32
+		// PagesPerRun is the number of pages a run operates on before it continues as new, defaults to 10
+		PagesPerRun int
+		// Continued carries the progress of the previous runs of a batch that continued as new
+		Continued *BatchCheckpoint
+	}
+
+	// BatchCheckpoint is where a batch that continued as new resumes
+	BatchCheckpoint struct {
+		PageToken []byte
+		Report    BatchReport
+	}
+
+	// Execution identifies a selected run
+	Execution struct {
+		WorkflowID string
+		RunID      string
+	}
+
+	// ExecutionPage is a page of selected executions returned by listBatchExecutions
+	ExecutionPage struct {
+		Executions    []Execution
+		NextPageToken []byte
+	}
+
+	// ExecutionResult is the outcome of the operation on one execution
+	ExecutionResult struct {
+		Execution
+		NewRunID string `json:",omitempty"`
+		Detail   string `json:",omitempty"`
+		Error    string `json:",omitempty"`
+	}
+
+	// BatchResult counts the outcomes of the operations on a batch of executions and keeps the first of them
+	BatchResult struct {
+		Succeeded int
+		Failed    int
+		// Failures are the first failed operations, at most maxSampledResults
+		Failures []ExecutionResult `json:",omitempty"`
+		// Preview are the first results of a dry run, at most maxSampledResults
+		Preview []ExecutionResult `json:",omitempty"`
+	}
+
+	// BatchReport is the result of batchWorkflow and the answer to its report query
+	BatchReport struct {
+		Operation string
+		DryRun    bool
+		Selected  int
+		BatchResult
+	}
+
+	// batchProgress is the heartbeat of processExecutions, a retried attempt continues from Next
+	batchProgress struct {
+		Next   int
+		Result BatchResult
+	}
+
+	// ClientKey is the key for lookup
+	ClientKey int
+)
+
+const (
+	// ApplicationName is the task list for this sample
+	ApplicationName = "batchGroup"
+	// ReportQueryName answers the progress of a running batch
+	ReportQueryName = "report"
+
+	operationSignal    = "signal"
+	operationCancel    = "cancel"
+	operationTerminate = "terminate"
+	operationReset     = "reset"
+
+	defaultBatchPageSize    = 100
+	defaultBatchPagesPerRun = 10
+	// maxSampledResults bounds the failures and the dry run preview kept in the report and the heartbeats
+	maxSampledResults = 100
+)
+
+const (
+	// CadenceClientKey for retrieving cadence client from context
+	CadenceClientKey ClientKey = iota
+	// DomainKey for retrieving the domain the batch runs in from context
+	DomainKey
+)
+
+// ErrCadenceClientNotFound when cadence client is not found on context
+var ErrCadenceClientNotFound = errors.New("failed to retrieve cadence client from context")
+
+// batchWorkflow applies one operation to every execution selected by a visibility query or a workflow type. It
+// operates on one page of executions at a time and continues as new after PagesPerRun pages, so neither its memory
+// nor its history grows with the number of selected executions.
+func batchWorkflow(ctx workflow.Context, params BatchParams) (*BatchReport, error) {
+	logger := workflow.GetLogger(ctx)
+	if err := params.validate(); err != nil {
+		return nil, cadence.NewCustomError("invalid batch", err.Error())
+	}
+
+	report := &BatchReport{Operation: params.Operation, DryRun: params.DryRun}
+	var pageToken []byte
+	if params.Continued != nil {
+		report = &params.Continued.Report
+		pageToken = params.Continued.PageToken
+	}
+	if err := workflow.SetQueryHandler(ctx, ReportQueryName, func() (*BatchReport, error) {
+		return report, nil
+	}); err != nil {
+		return nil, err
+	}
+
+	ao := workflow.ActivityOptions{
+		ScheduleToStartTimeout: 10 * time.Minute,
+		StartToCloseTimeout:    10 * time.Minute,
+		HeartbeatTimeout:       time.Second * 30,
+	}
+	listCtx := workflow.WithActivityOptions(ctx, ao)
+
+	// Setup retry policy for the operation activities, a retried attempt resumes from its last heartbeat
+	info := workflow.GetInfo(ctx)
+	expiration := time.Duration(info.ExecutionStartToCloseTimeoutSeconds) * time.Second
+	ao = workflow.ActivityOptions{
+		ScheduleToStartTimeout: expiration,
+		StartToCloseTimeout:    expiration,
+		HeartbeatTimeout:       time.Second * 30,
+		RetryPolicy: &cadence.RetryPolicy{
+			InitialInterval:    time.Second,
+			BackoffCoefficient: 2,
+			MaximumInterval:    10 * time.Second,
+			ExpirationInterval: expiration,
+			MaximumAttempts:    100,
+		},
+	}
+	processCtx := workflow.WithActivityOptions(ctx, ao)
+
+	concurrency := 1
+	if params.Concurrency > 0 {
+		concurrency = params.Concurrency
+	}
+	pagesPerRun := defaultBatchPagesPerRun
+	if params.PagesPerRun > 0 {
+		pagesPerRun = params.PagesPerRun
+	}
+
+	// A page is operated on before the next one is listed. The page token is a cursor past the executions listed
+	// so far, closing them does not shift the executions of the next pages.
+	self := info.WorkflowExecution.ID
+	for pages := 0; ; pages++ {
+		if pages == pagesPerRun {
+			logger.Info("Batch continues as new.", zap.Int("Selected", report.Selected))
+			next := params
+			next.Continued = &BatchCheckpoint{PageToken: pageToken, Report: *report}
+			return nil, workflow.NewContinueAsNewError(ctx, batchWorkflow, next)
+		}
+
+		var page ExecutionPage
+		if err := workflow.ExecuteActivity(listCtx, listBatchExecutions, params, pageToken).Get(ctx, &page); err != nil {
+			logger.Error("Failed to list executions.", zap.Error(err))
+			return nil, err
+		}
+		var executions []Execution
+		for _, execution := range page.Executions {
+			if execution.WorkflowID != self {
+				executions = append(executions, execution)
+			}
+		}
+		report.Selected += len(executions)
+		logger.Info("Selected executions.", zap.Int("Count", len(executions)), zap.String("Operation", params.Operation))
+
+		if err := processPage(ctx, processCtx, params, executions, concurrency, report); err != nil {
+			logger.Error("Batch failed.", zap.Int("Succeeded", report.Succeeded), zap.Int("Failed", report.Failed))
+			return report, err
+		}
+		if len(page.NextPageToken) == 0 {
+			break
+		}
+		pageToken = page.NextPageToken
+	}
+
+	logger.Info("Batch completed.",
+		zap.Int("Succeeded", report.Succeeded),
+		zap.Int("Failed", report.Failed))
+	return report, nil
+}
+
+// processPage splits the executions of a page over concurrency parallel processExecutions activities and adds their
+// results to the report. The report query shows the results of the batches that finished, in the order of the
+// selected executions. The executions of a batch that gave up are counted as failed, except for those its last
+// heartbeat recorded.
+func processPage(
+	ctx, processCtx workflow.Context,
+	params BatchParams,
+	executions []Execution,
+	concurrency int,
+	report *BatchReport,
+) error {
+	if len(executions) == 0 {
+		return nil
+	}
+	if len(executions) < concurrency {
+		concurrency = len(executions)
+	}
+	batchSize := len(executions) / concurrency
+	if len(executions)%concurrency != 0 {
+		batchSize++
+	}
+
+	// each batch gets an equal share of the rate limit
+	rps := params.RPS / float64(concurrency)
+	// batchResults holds the results of the finished batches by batch index, nil until a batch finishes
+	batchResults := make([]*BatchResult, concurrency)
+	previous := report.BatchResult
+	var batchErr error
+	doneCh := workflow.NewChannel(ctx)
+	for i := 0; i < concurrency; i++ {
+		i := i
+		start := i * batchSize
+		end := start + batchSize
+		if end > len(executions) {
+			end = len(executions)
+		}
+		batch := executions[start:end]
+
+		workflow.Go(ctx, func(ctx workflow.Context) {
+			defer doneCh.Send(ctx, i)
+			var result BatchResult
+			err := workflow.ExecuteActivity(processCtx, processExecutions, params, batch, rps).Get(ctx, &result)
+			if err != nil {
+				workflow.GetLogger(ctx).Error("Batch failed.", zap.Int("StartIndex", start), zap.Error(err))
+				batchErr = errors.Join(batchErr, err)
+				result = partialResult(batch, err)
+			}
+			batchResults[i] = &result
+		})
+	}
+
+	for i := 0; i < concurrency; i++ {
+		doneCh.Receive(ctx, nil)
+		report.BatchResult = previous
+		for _, result := range batchResults {
+			if result != nil {
+				report.merge(*result)
+			}
+		}
+	}
+	return batchErr
+}
+
+// listBatchExecutions returns the page of selected executions after pageToken
+func listBatchExecutions(ctx context.Context, params BatchParams, pageToken []byte) (*ExecutionPage, error) {
+	cadenceClient, err := getCadenceClientFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	domain, _ := ctx.Value(DomainKey).(string)
+
+	filter := common.ExecutionFilter{PageSize: params.PageSize, PageToken: pageToken}
+	if filter.PageSize == 0 {
+		filter.PageSize = defaultBatchPageSize
+	}
+	var it *common.ExecutionIterator
+	if params.Query != "" {
+		filter.Query = params.Query
+		it = common.ScanExecutions(ctx, cadenceClient, domain, filter)
+	} else {
+		filter.WorkflowType = params.WorkflowType
+		it = common.ListOpenExecutions(ctx, cadenceClient, domain, filter)
+	}
+
+	// only hand out one page, the workflow asks for the next one with the returned token
+	infos, err := it.NextPage()
+	if err != nil {
+		return nil, err
+	}
+	page := &ExecutionPage{NextPageToken: it.NextPageToken()}
+	for _, info := range infos {
+		page.Executions = append(page.Executions, Execution{
+			WorkflowID: info.Execution.GetWorkflowId(),
+			RunID:      info.Execution.GetRunId(),
+		})
+	}
+	return page, nil
+}
+
+// processExecutions applies the operation to each execution of the batch. A failed operation is counted in the
+// result instead of failing the batch, so a retry never repeats an operation that succeeded.
+func processExecutions(ctx context.Context, params BatchParams, executions []Execution, rps float64) (*BatchResult, error) {
+	logger := activity.GetLogger(ctx)
+	cadenceClient, err := getCadenceClientFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	domain, _ := ctx.Value(DomainKey).(string)
+
+	// Check if this activity has previous heartbeat to retrieve progress from it
+	var progress batchProgress
+	if activity.HasHeartbeatDetails(ctx) {
+		if err := activity.GetHeartbeatDetails(ctx, &progress); err != nil {
+			progress = batchProgress{}
+		}
+	}
+
+	var tick <-chan time.Time
+	if rps > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / rps))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for index := progress.Next; index < len(executions); index++ {
+		if tick != nil && index > progress.Next {
+			select {
+			case <-tick:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+
+		result := applyOperation(ctx, cadenceClient, domain, params, executions[index])
+		if result.Error != "" {
+			logger.Warn("Operation failed.",
+				zap.String("WorkflowID", result.WorkflowID),
+				zap.String("Operation", params.Operation),
+				zap.String("Error", result.Error))
+		}
+		progress.Result.add(result)
+		progress.Next = index + 1
+
+		// Record a heartbeat after each execution
+		activity.RecordHeartbeat(ctx, progress)
+	}
+	return &progress.Result, nil
+}
+
+func applyOperation(
+	ctx context.Context,
+	c client.Client,
+	domain string,
+	params BatchParams,
+	execution Execution,
+) ExecutionResult {
+	result := ExecutionResult{Execution: execution}
+	var err error
+	switch params.Operation {
+	case operationSignal:
+		if params.DryRun {
+			result.Detail = "would signal " + params.SignalName
+			break
+		}
+		err = c.SignalWorkflow(ctx, execution.WorkflowID, execution.RunID, params.SignalName, params.SignalInput)
+	case operationCancel:
+		if params.DryRun {
+			result.Detail = "would cancel"
+			break
+		}
+		err = c.CancelWorkflow(ctx, execution.WorkflowID, execution.RunID)
+	case operationTerminate:
+		if params.DryRun {
+			result.Detail = "would terminate"
+			break
+		}
+		err = c.TerminateWorkflow(ctx, execution.WorkflowID, execution.RunID, params.Reason, nil)
+	case operationReset:
+		if params.DryRun {
+			var eventID int64
+			if _, eventID, err = common.ResolveResetPoint(ctx, c, execution.WorkflowID, execution.RunID, params.ResetPoint); err == nil {
+				result.Detail = fmt.Sprintf("would reset to event %d", eventID)
+			}
+			break
+		}
+		result.NewRunID, err = common.ResetWorkflow(ctx, c, domain, execution.WorkflowID, execution.RunID, params.Reason, params.ResetPoint)
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+func (p BatchParams) validate() error {
+	if p.Query == "" && p.WorkflowType == "" {
+		return errors.New("a visibility query or a workflow type is required")
+	}
+	switch p.Operation {
+	case operationSignal:
+		if p.SignalName == "" {
+			return errors.New("the signal operation needs a signal name")
+		}
+	case operationCancel, operationTerminate, operationReset:
+	default:
+		return fmt.Errorf("unknown operation %q, expected signal, cancel, terminate or reset", p.Operation)
+	}
+	if p.Concurrency < 0 || p.RPS < 0 {
+		return errors.New("concurrency and rps must not be negative")
+	}
+	return nil
+}
+
+// add counts the result of an operation and samples it when it failed or is part of a dry run
+func (r *BatchResult) add(result ExecutionResult) {
+	if result.Error != "" {
+		r.Failed++
+		if len(r.Failures) < maxSampledResults {
+			r.Failures = append(r.Failures, result)
+		}
+	} else {
+		r.Succeeded++
+	}
+	if result.Detail != "" && len(r.Preview) < maxSampledResults {
+		r.Preview = append(r.Preview, result)
+	}
+}
+
+// merge adds the counts and samples of other to r
+func (r *BatchResult) merge(other BatchResult) {
+	r.Succeeded += other.Succeeded
+	r.Failed += other.Failed
+	r.Failures = appendSample(r.Failures, other.Failures)
+	r.Preview = appendSample(r.Preview, other.Preview)
+}
+
+func appendSample(sample, results []ExecutionResult) []ExecutionResult {
+	if n := maxSampledResults - len(sample); len(results) > n {
+		results = results[:n]
+	}
+	// copy, sample may share its array with the report of the previous pages
+	return append(sample[:len(sample):len(sample)], results...)
+}
+
+// partialResult is the result of a batch whose processExecutions gave up. A timeout carries the last heartbeat of
+// the activity, the executions it recorded keep their results and the others are counted as failed.
+func partialResult(executions []Execution, err error) BatchResult {
+	var progress batchProgress
+	var timeoutErr *workflow.TimeoutError
+	if errors.As(err, &timeoutErr) && timeoutErr.HasDetails() {
+		if timeoutErr.Details(&progress) != nil || progress.Next > len(executions) {
+			progress = batchProgress{}
+		}
+	}
+	result := progress.Result
+	for _, execution := range executions[progress.Next:] {
+		result.add(ExecutionResult{Execution: execution, Error: "batch failed: " + err.Error()})
+	}
+	return result
+}
+
+func getCadenceClientFromContext(ctx context.Context) (client.Client, error) {
+	logger := activity.GetLogger(ctx)
+	cadenceClient, ok := ctx.Value(CadenceClientKey).(client.Client)
+	if !ok {
+		logger.Error("Could not retrieve cadence client from context.")
+		return nil, ErrCadenceClientNotFound
+	}
+
+	return cadenceClient, nil
+}
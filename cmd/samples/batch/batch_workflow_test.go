@@ -0,0 +1,366 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/cadence/.gen/go/shared"
+	"go.uber.org/cadence/client"
+	"go.uber.org/cadence/testsuite"
+	"go.uber.org/cadence/worker"
+	"go.uber.org/cadence/workflow"
+
+	"github.com/uber-common/cadence-samples/cmd/samples/common"
+)
+
+// fakeBatchClient lists its workflow IDs in pages of the requested size and records the operations applied to them
+type fakeBatchClient struct {
+	client.Client
+
+	workflowIDs []string
+	failing     map[string]bool
+
+	mu         sync.Mutex
+	signals    map[string]string
+	terminated []string
+	resets     map[string]int64
+}
+
+func newFakeBatchClient(n int) *fakeBatchClient {
+	c := &fakeBatchClient{
+		failing: map[string]bool{},
+		signals: map[string]string{},
+		resets:  map[string]int64{},
+	}
+	for i := 0; i < n; i++ {
+		c.workflowIDs = append(c.workflowIDs, fmt.Sprintf("trip-%d", i))
+	}
+	return c
+}
+
+func (c *fakeBatchClient) ListOpenWorkflow(ctx context.Context, request *shared.ListOpenWorkflowExecutionsRequest) (*shared.ListOpenWorkflowExecutionsResponse, error) {
+	offset := 0
+	if len(request.NextPageToken) > 0 {
+		offset, _ = strconv.Atoi(string(request.NextPageToken))
+	}
+	end := offset + int(request.GetMaximumPageSize())
+	resp := &shared.ListOpenWorkflowExecutionsResponse{}
+	if end < len(c.workflowIDs) {
+		resp.NextPageToken = []byte(strconv.Itoa(end))
+	} else {
+		end = len(c.workflowIDs)
+	}
+	for _, id := range c.workflowIDs[offset:end] {
+		resp.Executions = append(resp.Executions, &shared.WorkflowExecutionInfo{
+			Execution: &shared.WorkflowExecution{WorkflowId: common.StringPtr(id), RunId: common.StringPtr("run-" + id)},
+		})
+	}
+	return resp, nil
+}
+
+func (c *fakeBatchClient) SignalWorkflow(ctx context.Context, workflowID, runID, signalName string, arg interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	input, _ := json.Marshal(arg)
+	c.signals[workflowID] = signalName + " " + string(input)
+	return nil
+}
+
+func (c *fakeBatchClient) TerminateWorkflow(ctx context.Context, workflowID, runID, reason string, details []byte) error {
+	if c.failing[workflowID] {
+		return errors.New("workflow execution already completed")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.terminated = append(c.terminated, workflowID)
+	return nil
+}
+
+func (c *fakeBatchClient) GetWorkflowHistory(ctx context.Context, workflowID, runID string, isLongPoll bool, filterType shared.HistoryEventFilterType) client.HistoryEventIterator {
+	eventType := func(t shared.EventType) *shared.EventType { return &t }
+	return &fakeHistoryIterator{events: []*shared.HistoryEvent{
+		{EventId: common.Int64Ptr(1), EventType: eventType(shared.EventTypeWorkflowExecutionStarted)},
+		{EventId: common.Int64Ptr(4), EventType: eventType(shared.EventTypeDecisionTaskCompleted)},
+		{EventId: common.Int64Ptr(5), EventType: eventType(shared.EventTypeActivityTaskScheduled)},
+		{EventId: common.Int64Ptr(9), EventType: eventType(shared.EventTypeDecisionTaskCompleted)},
+	}}
+}
+
+func (c *fakeBatchClient) ResetWorkflow(ctx context.Context, request *shared.ResetWorkflowExecutionRequest) (*shared.ResetWorkflowExecutionResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.resets[request.WorkflowExecution.GetWorkflowId()] = request.GetDecisionFinishEventId()
+	return &shared.ResetWorkflowExecutionResponse{RunId: common.StringPtr("reset-" + request.WorkflowExecution.GetWorkflowId())}, nil
+}
+
+type fakeHistoryIterator struct {
+	events []*shared.HistoryEvent
+}
+
+func (it *fakeHistoryIterator) HasNext() bool {
+	return len(it.events) > 0
+}
+
+func (it *fakeHistoryIterator) Next() (*shared.HistoryEvent, error) {
+	event := it.events[0]
+	it.events = it.events[1:]
+	return event, nil
+}
+
+type UnitTestSuite struct {
+	suite.Suite
+	testsuite.WorkflowTestSuite
+
+	env    *testsuite.TestWorkflowEnvironment
+	client *fakeBatchClient
+}
+
+func TestUnitTestSuite(t *testing.T) {
+	suite.Run(t, new(UnitTestSuite))
+}
+
+func (s *UnitTestSuite) SetupTest() {
+	s.client = newFakeBatchClient(5)
+	s.env = s.newEnvironment()
+}
+
+// newEnvironment returns a workflow environment whose activities operate on s.client
+func (s *UnitTestSuite) newEnvironment() *testsuite.TestWorkflowEnvironment {
+	ctx := context.WithValue(context.Background(), CadenceClientKey, client.Client(s.client))
+	ctx = context.WithValue(ctx, DomainKey, "samples-domain")
+
+	env := s.NewTestWorkflowEnvironment()
+	env.SetWorkerOptions(worker.Options{BackgroundActivityContext: ctx})
+	env.RegisterWorkflow(batchWorkflow)
+	env.RegisterActivity(listBatchExecutions)
+	env.RegisterActivity(processExecutions)
+	return env
+}
+
+func (s *UnitTestSuite) TearDownTest() {
+	s.env.AssertExpectations(s.T())
+}
+
+func (s *UnitTestSuite) report() *BatchReport {
+	s.True(s.env.IsWorkflowCompleted())
+	s.NoError(s.env.GetWorkflowError())
+	var report BatchReport
+	s.NoError(s.env.GetWorkflowResult(&report))
+	return &report
+}
+
+func (s *UnitTestSuite) Test_TerminateReportsFailures() {
+	s.client.failing["trip-3"] = true
+
+	s.env.ExecuteWorkflow(batchWorkflow, BatchParams{
+		WorkflowType: "main.tripWorkflow",
+		Operation:    operationTerminate,
+		Reason:       "bad deploy",
+		Concurrency:  2,
+		RPS:          1000,
+	})
+
+	report := s.report()
+	s.Equal(5, report.Selected)
+	s.Equal(4, report.Succeeded)
+	s.Equal(1, report.Failed)
+	s.ElementsMatch([]string{"trip-0", "trip-1", "trip-2", "trip-4"}, s.client.terminated)
+	s.Equal([]string{"trip-3"}, resultIDs(report.Failures))
+	s.Equal("workflow execution already completed", report.Failures[0].Error)
+}
+
+func (s *UnitTestSuite) Test_Signal() {
+	s.env.ExecuteWorkflow(batchWorkflow, BatchParams{
+		WorkflowType: "main.tripWorkflow",
+		Operation:    operationSignal,
+		SignalName:   "trip_event",
+		SignalInput:  json.RawMessage(`{"ID":"Trip1","Total":10}`),
+	})
+
+	report := s.report()
+	s.Equal(5, report.Succeeded)
+	s.Len(s.client.signals, 5)
+	s.Equal(`trip_event {"ID":"Trip1","Total":10}`, s.client.signals["trip-4"])
+}
+
+func (s *UnitTestSuite) Test_ResetDryRunChangesNothing() {
+	s.env.ExecuteWorkflow(batchWorkflow, BatchParams{
+		WorkflowType: "main.tripWorkflow",
+		Operation:    operationReset,
+		ResetPoint:   common.ResetPoint{EventType: "ActivityTaskScheduled"},
+		Concurrency:  3,
+		DryRun:       true,
+	})
+
+	report := s.report()
+	s.True(report.DryRun)
+	s.Equal(5, report.Succeeded)
+	s.Empty(s.client.resets)
+	s.Len(report.Preview, 5)
+	s.Equal("would reset to event 4", report.Preview[0].Detail)
+}
+
+func (s *UnitTestSuite) Test_Reset() {
+	s.env.ExecuteWorkflow(batchWorkflow, BatchParams{
+		WorkflowType: "main.tripWorkflow",
+		Operation:    operationReset,
+		Concurrency:  2,
+	})
+
+	report := s.report()
+	s.Equal(5, report.Succeeded)
+	s.Len(s.client.resets, 5)
+	s.Equal(int64(9), s.client.resets["trip-2"])
+}
+
+func (s *UnitTestSuite) Test_InvalidParams() {
+	s.env.ExecuteWorkflow(batchWorkflow, BatchParams{WorkflowType: "main.tripWorkflow", Operation: operationSignal})
+
+	s.True(s.env.IsWorkflowCompleted())
+	s.ErrorContains(s.env.GetWorkflowError(), "invalid batch")
+}
+
+func (s *UnitTestSuite) Test_ProcessExecutionsResumesFromHeartbeat() {
+	ctx := context.WithValue(context.Background(), CadenceClientKey, client.Client(s.client))
+	env := s.NewTestActivityEnvironment()
+	env.SetWorkerOptions(worker.Options{BackgroundActivityContext: ctx})
+	env.RegisterActivity(processExecutions)
+
+	executions := []Execution{{WorkflowID: "trip-0"}, {WorkflowID: "trip-1"}, {WorkflowID: "trip-2"}}
+	env.SetHeartbeatDetails(batchProgress{Next: 1, Result: BatchResult{Succeeded: 1}})
+
+	value, err := env.ExecuteActivity(processExecutions, BatchParams{Operation: operationTerminate}, executions, 0.0)
+	s.NoError(err)
+	var result BatchResult
+	s.NoError(value.Get(&result))
+	s.Equal(3, result.Succeeded)
+	s.Equal([]string{"trip-1", "trip-2"}, s.client.terminated)
+}
+
+// onBatch mocks the processExecutions call of the batch that starts with the given workflow ID
+func (s *UnitTestSuite) onBatch(firstWorkflowID string) *testsuite.MockCallWrapper {
+	return s.env.OnActivity(processExecutions, mock.Anything, mock.Anything, mock.MatchedBy(func(executions []Execution) bool {
+		return executions[0].WorkflowID == firstWorkflowID
+	}), mock.Anything)
+}
+
+// failed is the result of a batch in which the operations on the given workflow IDs failed
+func failed(succeeded int, ids ...string) *BatchResult {
+	result := &BatchResult{Succeeded: succeeded}
+	for _, id := range ids {
+		result.add(ExecutionResult{Execution: Execution{WorkflowID: id, RunID: "run-" + id}, Error: "not found"})
+	}
+	return result
+}
+
+func resultIDs(results []ExecutionResult) []string {
+	var ids []string
+	for _, result := range results {
+		ids = append(ids, result.WorkflowID)
+	}
+	return ids
+}
+
+func (s *UnitTestSuite) Test_ReportShowsFinishedBatchesInOrder() {
+	// the first batch finishes last
+	s.onBatch("trip-0").After(time.Hour).Return(failed(2, "trip-0"), nil)
+	s.onBatch("trip-3").Return(failed(1, "trip-3"), nil)
+
+	s.env.RegisterDelayedCallback(func() {
+		value, err := s.env.QueryWorkflow(ReportQueryName)
+		s.NoError(err)
+		var report BatchReport
+		s.NoError(value.Get(&report))
+		s.Equal(5, report.Selected)
+		s.Equal(1, report.Succeeded)
+		s.Equal([]string{"trip-3"}, resultIDs(report.Failures))
+	}, time.Minute)
+	s.env.ExecuteWorkflow(batchWorkflow, BatchParams{
+		WorkflowType: "main.tripWorkflow",
+		Operation:    operationTerminate,
+		Concurrency:  2,
+	})
+
+	report := s.report()
+	s.Equal(3, report.Succeeded)
+	s.Equal(2, report.Failed)
+	s.Equal([]string{"trip-0", "trip-3"}, resultIDs(report.Failures))
+}
+
+func (s *UnitTestSuite) Test_FailedBatchCountsItsExecutions() {
+	s.onBatch("trip-0").Return(failed(3), nil)
+	s.onBatch("trip-3").Return(nil, errors.New("frontend unavailable"))
+
+	s.env.ExecuteWorkflow(batchWorkflow, BatchParams{
+		WorkflowType: "main.tripWorkflow",
+		Operation:    operationTerminate,
+		Concurrency:  2,
+	})
+
+	s.True(s.env.IsWorkflowCompleted())
+	s.ErrorContains(s.env.GetWorkflowError(), "frontend unavailable")
+	value, err := s.env.QueryWorkflow(ReportQueryName)
+	s.NoError(err)
+	var report BatchReport
+	s.NoError(value.Get(&report))
+	s.Equal(3, report.Succeeded)
+	s.Equal(2, report.Failed)
+	s.Equal([]string{"trip-3", "trip-4"}, resultIDs(report.Failures))
+	s.Contains(report.Failures[1].Error, "batch failed")
+}
+
+func (s *UnitTestSuite) Test_TimedOutBatchKeepsHeartbeatedResults() {
+	s.onBatch("trip-0").Return(failed(3), nil)
+	// the last heartbeat recorded the operation on trip-3
+	s.onBatch("trip-3").Return(nil, workflow.NewHeartbeatTimeoutError(batchProgress{Next: 1, Result: *failed(1)}))
+
+	s.env.ExecuteWorkflow(batchWorkflow, BatchParams{
+		WorkflowType: "main.tripWorkflow",
+		Operation:    operationTerminate,
+		Concurrency:  2,
+	})
+
+	s.True(s.env.IsWorkflowCompleted())
+	s.Error(s.env.GetWorkflowError())
+	value, err := s.env.QueryWorkflow(ReportQueryName)
+	s.NoError(err)
+	var report BatchReport
+	s.NoError(value.Get(&report))
+	s.Equal(4, report.Succeeded)
+	s.Equal(1, report.Failed)
+	s.Equal([]string{"trip-4"}, resultIDs(report.Failures))
+}
+
+func (s *UnitTestSuite) Test_ContinuesAsNewAfterPagesPerRun() {
+	params := BatchParams{
+		WorkflowType: "main.tripWorkflow",
+		Operation:    operationTerminate,
+		PageSize:     2,
+		PagesPerRun:  2,
+	}
+	s.env.ExecuteWorkflow(batchWorkflow, params)
+
+	var continueAsNew *workflow.ContinueAsNewError
+	s.True(errors.As(s.env.GetWorkflowError(), &continueAsNew))
+	next := continueAsNew.Args()[0].(BatchParams)
+	s.Equal([]byte("4"), next.Continued.PageToken)
+	s.Equal(4, next.Continued.Report.Selected)
+	s.Equal(4, next.Continued.Report.Succeeded)
+
+	// the new run operates on the page after the checkpoint and adds to the report
+	s.env = s.newEnvironment()
+	s.env.ExecuteWorkflow(batchWorkflow, next)
+
+	report := s.report()
+	s.Equal(5, report.Selected)
+	s.Equal(5, report.Succeeded)
+	s.Equal([]string{"trip-0", "trip-1", "trip-2", "trip-3", "trip-4"}, s.client.terminated)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"time"
+
+	"github.com/pborman/uuid"
+	"go.uber.org/cadence/client"
+	"go.uber.org/cadence/worker"
+	"go.uber.org/zap"
+
+	"github.com/uber-common/cadence-samples/cmd/samples/common"
+)
+
+// This needs to be done as part of a bootstrap step when the process starts.
+// The workers are supposed to be long running.
+func runWorkers(h *common.SampleHelper) {
+	workflowClient, err := h.Builder.BuildCadenceClient()
+	if err != nil {
+		h.Logger.Error("Failed to build cadence client.", zap.Error(err))
+		panic(err)
+	}
+	ctx := context.WithValue(context.Background(), CadenceClientKey, workflowClient)
+	ctx = context.WithValue(ctx, DomainKey, h.Config.DomainName)
+
+	// Configure worker options.
+	workerOptions := worker.Options{
+		MetricsScope:              h.WorkerMetricScope,
+		Logger:                    h.Logger,
+		BackgroundActivityContext: ctx,
+	}
+	h.RunWorkers(common.WorkerSpec{TaskList: ApplicationName, Options: workerOptions})
+}
+
+func startWorkflow(h *common.SampleHelper, params BatchParams) {
+	workflowOptions := client.StartWorkflowOptions{
+		ID:                              "batch_" + uuid.New(),
+		TaskList:                        ApplicationName,
+		ExecutionStartToCloseTimeout:    time.Hour * 24,
+		DecisionTaskStartToCloseTimeout: time.Second * 10,
+	}
+	h.StartWorkflow(workflowOptions, batchWorkflow, params)
+}
+
+func main() {
+	var mode, workflowID, input, signalInput, resetAfter string
+	var params BatchParams
+	flag.StringVar(&mode, "m", "trigger", "Mode is worker, trigger or report.")
+	flag.StringVar(&workflowID, "w", "", "WorkflowID of the batch to report on.")
+	flag.StringVar(&input, "i", "", "Batch parameters as JSON, overrides the flags below.")
+	flag.StringVar(&params.Query, "q", "", "Visibility query selecting the executions.")
+	flag.StringVar(&params.WorkflowType, "wt", "", "Workflow type whose open executions are selected when there is no query.")
+	flag.StringVar(&params.Operation, "op", "", "Operation is signal, cancel, terminate or reset.")
+	flag.StringVar(&params.SignalName, "signal", "", "Signal name for the signal operation.")
+	flag.StringVar(&signalInput, "signal-input", "", "Signal input as JSON for the signal operation.")
+	flag.StringVar(&params.Reason, "reason", "batch", "Reason recorded on terminated and reset executions.")
+	flag.StringVar(&params.ResetPoint.EventType, "reset-event-type", "", "Reset to the last decision before the first event of this type, defaults to the last decision.")
+	flag.Int64Var(&params.ResetPoint.EventID, "reset-event-id", 0, "Reset to the DecisionTaskCompleted event with this ID.")
+	flag.StringVar(&params.ResetPoint.BinaryChecksum, "reset-binary-checksum", "", "Reset to the first decision completed by the worker binary with this checksum.")
+	flag.StringVar(&resetAfter, "reset-after", "", "Reset to the first decision completed at or after this RFC3339 time.")
+	flag.IntVar(&params.Concurrency, "c", 1, "Executions operated on in parallel.")
+	flag.Float64Var(&params.RPS, "rps", 0, "Operations per second, 0 does not limit.")
+	flag.BoolVar(&params.DryRun, "dry-run", false, "Report the selected executions without changing them.")
+	flag.IntVar(&params.PagesPerRun, "pages-per-run", 0, "Pages of executions a run operates on before it continues as new, defaults to 10.")
+	flag.Parse()
+
+	var h common.SampleHelper
+	h.SetupServiceConfig()
+
+	switch mode {
+	case "worker":
+		h.RegisterWorkflow(batchWorkflow)
+		h.RegisterActivity(listBatchExecutions)
+		h.RegisterActivity(processExecutions)
+		runWorkers(&h)
+	case "trigger":
+		if input != "" {
+			params = BatchParams{}
+			if err := json.Unmarshal([]byte(input), &params); err != nil {
+				panic(err)
+			}
+		} else {
+			if signalInput != "" {
+				params.SignalInput = json.RawMessage(signalInput)
+			}
+			if resetAfter != "" {
+				after, err := time.Parse(time.RFC3339, resetAfter)
+				if err != nil {
+					h.Logger.Fatal("Invalid reset time.", zap.Error(err))
+				}
+				params.ResetPoint.After = after
+			}
+		}
+		if err := params.validate(); err != nil {
+			h.Logger.Fatal("Invalid batch.", zap.Error(err))
+		}
+		startWorkflow(&h, params)
+	case "report":
+		h.QueryWorkflow(workflowID, "", ReportQueryName)
+	}
+}
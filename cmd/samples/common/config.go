@@ -0,0 +1,425 @@
+package common
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/uber-go/tally/prometheus"
+	"gopkg.in/yaml.v2"
+)
+
+// ConfigSource identifies which layer supplied a configuration value.
+type ConfigSource string
+
+const (
+	// ConfigSourceDefault is a value that was not overridden by any other layer
+	ConfigSourceDefault ConfigSource = "default"
+	// ConfigSourceFile is a value read from the YAML config file
+	ConfigSourceFile ConfigSource = "file"
+	// ConfigSourceEnv is a value read from a CADENCE_* environment variable
+	ConfigSourceEnv ConfigSource = "env"
+	// ConfigSourceFlag is a value passed as a command-line flag
+	ConfigSourceFlag ConfigSource = "flag"
+)
+
+const (
+	defaultDomainName      = "cadence-samples"
+	defaultServiceName     = "cadence-frontend"
+	defaultHostNameAndPort = "localhost:7833"
+
+	configFileEnv  = "CADENCE_CONFIG"
+	configFileFlag = "cadence-config"
+)
+
+type (
+	// ConfigReport describes how a Configuration was resolved.
+	ConfigReport struct {
+		// File is the config file that was loaded, empty if none was found
+		File string
+		// Sources maps each configuration key to the layer that supplied its value
+		Sources map[string]ConfigSource
+	}
+
+	// ConfigLoader resolves a Configuration by layering defaults, the YAML config file, CADENCE_* environment
+	// variables and command-line flags, in that order.
+	ConfigLoader struct {
+		// File is the config file path, which must exist when set. When it is empty config/development.yaml is used
+		// if it can be found. A relative path is also searched for in the parent directories of SearchFrom.
+		File string
+		// SearchFrom is the directory the upward search starts from. Defaults to the working directory.
+		SearchFrom string
+		// LookupEnv reads environment variables. Defaults to os.LookupEnv.
+		LookupEnv func(key string) (string, bool)
+		// Flags holds the parsed command-line flags. Defaults to flag.CommandLine.
+		Flags *flag.FlagSet
+	}
+
+	// configField binds a configuration key to its environment variable and flag.
+	configField struct {
+		key  string
+		env  string
+		flag string
+		desc string
+		get  func(c *Configuration) string
+		set  func(c *Configuration, v string) error
+	}
+)
+
+var configFields = []configField{
+	{
+		key:  "domain",
+		env:  "CADENCE_DOMAIN",
+		flag: "cadence-domain",
+		desc: "Cadence domain the samples run in.",
+		get:  func(c *Configuration) string { return c.DomainName },
+		set:  func(c *Configuration, v string) error { c.DomainName = v; return nil },
+	},
+	{
+		key:  "service",
+		env:  "CADENCE_SERVICE",
+		flag: "cadence-service",
+		desc: "Cadence frontend service name.",
+		get:  func(c *Configuration) string { return c.ServiceName },
+		set:  func(c *Configuration, v string) error { c.ServiceName = v; return nil },
+	},
+	{
+		key:  "host",
+		env:  "CADENCE_HOST",
+		flag: "cadence-host",
+		desc: "Cadence frontend host:port, a comma separated list of them or a dns:///host:port target.",
+		get:  func(c *Configuration) string { return c.HostNameAndPort },
+		set:  func(c *Configuration, v string) error { c.HostNameAndPort = v; return nil },
+	},
+	{
+		key:  "peerChooser",
+		env:  "CADENCE_PEER_CHOOSER",
+		flag: "cadence-peer-chooser",
+		desc: "How requests are spread over several frontends, round-robin or least-pending.",
+		get:  func(c *Configuration) string { return c.PeerChooser },
+		set:  func(c *Configuration, v string) error { c.PeerChooser = v; return nil },
+	},
+	{
+		key:  "dnsRefreshInterval",
+		env:  "CADENCE_DNS_REFRESH_INTERVAL",
+		flag: "cadence-dns-refresh-interval",
+		desc: "How often a dns:/// host is resolved again, e.g. 30s.",
+		get: func(c *Configuration) string {
+			if c.DNSRefreshInterval == 0 {
+				return ""
+			}
+			return c.DNSRefreshInterval.String()
+		},
+		set: func(c *Configuration, v string) error {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return err
+			}
+			c.DNSRefreshInterval = d
+			return nil
+		},
+	},
+	{
+		key:  "autoRegisterDomain.enabled",
+		env:  "CADENCE_AUTO_REGISTER_DOMAIN",
+		flag: "cadence-auto-register-domain",
+		desc: "Register the domain on startup if it does not exist, true or false.",
+		get: func(c *Configuration) string {
+			if c.AutoRegisterDomain == nil {
+				return ""
+			}
+			return strconv.FormatBool(c.AutoRegisterDomain.Enabled)
+		},
+		set: func(c *Configuration, v string) error {
+			enabled, err := strconv.ParseBool(v)
+			if err != nil {
+				return err
+			}
+			if c.AutoRegisterDomain == nil {
+				c.AutoRegisterDomain = &DomainRegistrationConfig{}
+			}
+			c.AutoRegisterDomain.Enabled = enabled
+			return nil
+		},
+	},
+	{
+		key:  "logging.level",
+		env:  "CADENCE_LOG_LEVEL",
+		flag: "cadence-log-level",
+		desc: "Minimum log level: debug, info, warn or error.",
+		get: func(c *Configuration) string {
+			if c.Logging == nil {
+				return ""
+			}
+			return c.Logging.Level
+		},
+		set: func(c *Configuration, v string) error {
+			if c.Logging == nil {
+				c.Logging = &LoggingConfig{}
+			}
+			c.Logging.Level = v
+			return nil
+		},
+	},
+	{
+		key:  "logging.encoding",
+		env:  "CADENCE_LOG_ENCODING",
+		flag: "cadence-log-encoding",
+		desc: "Log encoding: json or console.",
+		get: func(c *Configuration) string {
+			if c.Logging == nil {
+				return ""
+			}
+			return c.Logging.Encoding
+		},
+		set: func(c *Configuration, v string) error {
+			if c.Logging == nil {
+				c.Logging = &LoggingConfig{}
+			}
+			c.Logging.Encoding = v
+			return nil
+		},
+	},
+	{
+		key:  "prometheus.listenAddress",
+		env:  "CADENCE_PROMETHEUS_LISTEN_ADDRESS",
+		flag: "cadence-prometheus-listen-address",
+		desc: "Address to serve Prometheus metrics on.",
+		get: func(c *Configuration) string {
+			if c.Prometheus == nil {
+				return ""
+			}
+			return c.Prometheus.ListenAddress
+		},
+		set: func(c *Configuration, v string) error {
+			if c.Prometheus == nil {
+				c.Prometheus = &prometheus.Configuration{}
+			}
+			c.Prometheus.ListenAddress = v
+			return nil
+		},
+	},
+	{
+		key:  "lifecycle.drainTimeout",
+		env:  "CADENCE_DRAIN_TIMEOUT",
+		flag: "cadence-drain-timeout",
+		desc: "How long in-flight tasks get to finish when workers stop, e.g. 30s.",
+		get: func(c *Configuration) string {
+			if c.Lifecycle == nil || c.Lifecycle.DrainTimeout == 0 {
+				return ""
+			}
+			return c.Lifecycle.DrainTimeout.String()
+		},
+		set: func(c *Configuration, v string) error {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return err
+			}
+			if c.Lifecycle == nil {
+				c.Lifecycle = &LifecycleConfig{}
+			}
+			c.Lifecycle.DrainTimeout = d
+			return nil
+		},
+	},
+	{
+		key:  "lifecycle.healthListenAddress",
+		env:  "CADENCE_HEALTH_LISTEN_ADDRESS",
+		flag: "cadence-health-listen-address",
+		desc: "Address to serve worker liveness and readiness probes on.",
+		get: func(c *Configuration) string {
+			if c.Lifecycle == nil {
+				return ""
+			}
+			return c.Lifecycle.HealthListenAddress
+		},
+		set: func(c *Configuration, v string) error {
+			if c.Lifecycle == nil {
+				c.Lifecycle = &LifecycleConfig{}
+			}
+			c.Lifecycle.HealthListenAddress = v
+			return nil
+		},
+	},
+}
+
+func init() {
+	RegisterConfigFlags(flag.CommandLine)
+}
+
+// RegisterConfigFlags defines the flags that override configuration values on the given flag set. The flags are
+// registered on flag.CommandLine at init time, so samples get them for free once they call flag.Parse.
+func RegisterConfigFlags(fs *flag.FlagSet) {
+	if fs.Lookup(configFileFlag) == nil {
+		fs.String(configFileFlag, "", fmt.Sprintf("Path to the samples config file. Defaults to %v.", defaultConfigFile))
+	}
+	for _, f := range configFields {
+		if fs.Lookup(f.flag) == nil {
+			fs.String(f.flag, "", f.desc)
+		}
+	}
+}
+
+// DefaultConfiguration returns the configuration used when no other layer supplies a value.
+func DefaultConfiguration() Configuration {
+	return Configuration{
+		DomainName:      defaultDomainName,
+		ServiceName:     defaultServiceName,
+		HostNameAndPort: defaultHostNameAndPort,
+	}
+}
+
+// Load resolves the configuration and reports which layer supplied each value.
+func (l ConfigLoader) Load() (Configuration, *ConfigReport, error) {
+	l.setDefaults()
+	setFlags := l.setFlags()
+
+	config := DefaultConfiguration()
+	report := &ConfigReport{Sources: make(map[string]ConfigSource, len(configFields))}
+	for _, f := range configFields {
+		if f.get(&config) != "" {
+			report.Sources[f.key] = ConfigSourceDefault
+		}
+	}
+
+	// An explicitly requested config file must exist, the default one is optional
+	file, explicit := l.File, l.File != ""
+	if v, ok := l.LookupEnv(configFileEnv); ok && v != "" {
+		file, explicit = v, true
+	}
+	if v, ok := setFlags[configFileFlag]; ok && v != "" {
+		file, explicit = v, true
+	}
+	if file == "" {
+		file = defaultConfigFile
+	}
+
+	path, err := findConfigFile(file, l.SearchFrom)
+	switch {
+	case err == nil:
+		if err := applyConfigFile(path, &config, report); err != nil {
+			return Configuration{}, nil, err
+		}
+		report.File = path
+	case explicit || !os.IsNotExist(err):
+		return Configuration{}, nil, fmt.Errorf("failed to load config file %v: %w", file, err)
+	}
+
+	for _, f := range configFields {
+		if v, ok := l.LookupEnv(f.env); ok && v != "" {
+			if err := f.set(&config, v); err != nil {
+				return Configuration{}, nil, fmt.Errorf("invalid value for %v: %w", f.env, err)
+			}
+			report.Sources[f.key] = ConfigSourceEnv
+		}
+	}
+
+	for _, f := range configFields {
+		if v, ok := setFlags[f.flag]; ok {
+			if err := f.set(&config, v); err != nil {
+				return Configuration{}, nil, fmt.Errorf("invalid value for -%v: %w", f.flag, err)
+			}
+			report.Sources[f.key] = ConfigSourceFlag
+		}
+	}
+
+	return config, report, nil
+}
+
+// String renders the report as one "key=source" entry per line, sorted by key.
+func (r *ConfigReport) String() string {
+	keys := make([]string, 0, len(r.Sources))
+	for k := range r.Sources {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var sb strings.Builder
+	if r.File != "" {
+		fmt.Fprintf(&sb, "config file: %v\n", r.File)
+	} else {
+		sb.WriteString("config file: none\n")
+	}
+	for _, k := range keys {
+		fmt.Fprintf(&sb, "%v=%v\n", k, r.Sources[k])
+	}
+	return sb.String()
+}
+
+func (l *ConfigLoader) setDefaults() {
+	if l.LookupEnv == nil {
+		l.LookupEnv = os.LookupEnv
+	}
+	if l.Flags == nil {
+		l.Flags = flag.CommandLine
+	}
+	if l.SearchFrom == "" {
+		if wd, err := os.Getwd(); err == nil {
+			l.SearchFrom = wd
+		}
+	}
+}
+
+// setFlags returns the flags that were explicitly passed on the command line, flags left at their default value
+// must not override the lower layers.
+func (l *ConfigLoader) setFlags() map[string]string {
+	values := make(map[string]string)
+	l.Flags.Visit(func(f *flag.Flag) {
+		values[f.Name] = f.Value.String()
+	})
+	return values
+}
+
+// findConfigFile returns the path of the config file, walking up from dir when a relative path is not found.
+func findConfigFile(file, dir string) (string, error) {
+	if filepath.IsAbs(file) {
+		_, err := os.Stat(file)
+		return file, err
+	}
+
+	_, statErr := os.Stat(file)
+	if statErr == nil {
+		return file, nil
+	}
+
+	for dir != "" {
+		candidate := filepath.Join(dir, file)
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	return "", statErr
+}
+
+func applyConfigFile(path string, config *Configuration, report *ConfigReport) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file %v: %w", path, err)
+	}
+
+	if err := yaml.Unmarshal(data, config); err != nil {
+		return fmt.Errorf("failed to parse config file %v: %w", path, err)
+	}
+
+	// Decode again into an empty configuration to find out which keys the file actually sets
+	var fromFile Configuration
+	if err := yaml.Unmarshal(data, &fromFile); err != nil {
+		return fmt.Errorf("failed to parse config file %v: %w", path, err)
+	}
+	for _, f := range configFields {
+		if f.get(&fromFile) != "" {
+			report.Sources[f.key] = ConfigSourceFile
+		}
+	}
+	return nil
+}
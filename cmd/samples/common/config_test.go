@@ -0,0 +1,70 @@
+package common
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigLoaderLayers(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "config"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, defaultConfigFile), []byte(`
+domain: "file-domain"
+host: "file-host:7833"
+prometheus:
+  listenAddress: "127.0.0.1:9098"
+`), 0644))
+
+	// Start the search from a nested package directory to exercise the upward lookup
+	searchFrom := filepath.Join(root, "cmd", "samples", "dsl")
+	require.NoError(t, os.MkdirAll(searchFrom, 0755))
+
+	env := map[string]string{
+		"CADENCE_HOST":                      "env-host:7833",
+		"CADENCE_PROMETHEUS_LISTEN_ADDRESS": "0.0.0.0:9098",
+	}
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	RegisterConfigFlags(flags)
+	require.NoError(t, flags.Parse([]string{"-cadence-host", "flag-host:7833"}))
+
+	config, report, err := ConfigLoader{
+		SearchFrom: searchFrom,
+		LookupEnv:  func(key string) (string, bool) { v, ok := env[key]; return v, ok },
+		Flags:      flags,
+	}.Load()
+	require.NoError(t, err)
+
+	assert.Equal(t, "file-domain", config.DomainName)
+	assert.Equal(t, defaultServiceName, config.ServiceName)
+	assert.Equal(t, "flag-host:7833", config.HostNameAndPort)
+	require.NotNil(t, config.Prometheus)
+	assert.Equal(t, "0.0.0.0:9098", config.Prometheus.ListenAddress)
+
+	assert.Equal(t, filepath.Join(root, defaultConfigFile), report.File)
+	assert.Equal(t, map[string]ConfigSource{
+		"domain":                   ConfigSourceFile,
+		"service":                  ConfigSourceDefault,
+		"host":                     ConfigSourceFlag,
+		"prometheus.listenAddress": ConfigSourceEnv,
+	}, report.Sources)
+}
+
+func TestConfigLoaderMissingFile(t *testing.T) {
+	noEnv := func(string) (string, bool) { return "", false }
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+
+	// The default config file is optional
+	config, report, err := ConfigLoader{SearchFrom: t.TempDir(), LookupEnv: noEnv, Flags: flags}.Load()
+	require.NoError(t, err)
+	assert.Equal(t, DefaultConfiguration(), config)
+	assert.Empty(t, report.File)
+
+	// An explicitly requested one is not
+	_, _, err = ConfigLoader{File: "missing.yaml", SearchFrom: t.TempDir(), LookupEnv: noEnv, Flags: flags}.Load()
+	require.Error(t, err)
+}
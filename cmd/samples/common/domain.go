@@ -0,0 +1,191 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/cadence/.gen/go/shared"
+	"go.uber.org/cadence/client"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultDomainRetentionDays   = 1
+	defaultDomainRegisterTimeout = 30 * time.Second
+)
+
+// domainPollInterval is how often a freshly registered domain is described until it shows up
+var domainPollInterval = 500 * time.Millisecond
+
+type (
+	// DomainRegistrationConfig controls the opt-in registration of a missing domain in SetupServiceConfig.
+	DomainRegistrationConfig struct {
+		Enabled     bool   `yaml:"enabled"`
+		Description string `yaml:"description"`
+		OwnerEmail  string `yaml:"ownerEmail"`
+		// RetentionDays is how long closed workflow histories are kept, defaults to 1
+		RetentionDays      int32           `yaml:"retentionDays"`
+		EmitMetric         bool            `yaml:"emitMetric"`
+		HistoryArchival    *ArchivalConfig `yaml:"historyArchival"`
+		VisibilityArchival *ArchivalConfig `yaml:"visibilityArchival"`
+		// SearchAttributes maps the search attributes the samples rely on to their type, e.g. CustomKeywordField: Keyword.
+		// Search attributes are cluster wide, so they are only checked and never added.
+		SearchAttributes map[string]string `yaml:"searchAttributes"`
+		// WaitTimeout bounds how long to wait for the registered domain to become describable, defaults to 30s
+		WaitTimeout time.Duration `yaml:"waitTimeout"`
+	}
+
+	// ArchivalConfig enables archival for a domain to the given URI, e.g. file:///tmp/cadence_archival/development
+	ArchivalConfig struct {
+		Enabled bool   `yaml:"enabled"`
+		URI     string `yaml:"uri"`
+	}
+)
+
+// EnsureDomain describes the domain and, if it does not exist and registration is enabled, registers it and waits
+// until it can be described. When registration is enabled, the search attributes listed in the config are verified
+// afterwards.
+func EnsureDomain(
+	ctx context.Context,
+	domainClient client.DomainClient,
+	workflowClient client.Client,
+	domain string,
+	config *DomainRegistrationConfig,
+	logger *zap.Logger,
+) error {
+	_, err := domainClient.Describe(ctx, domain)
+	var notExists *shared.EntityNotExistsError
+	switch {
+	case err == nil:
+		logger.Info("Domain successfully registered.", zap.String("Domain", domain))
+	case errors.As(err, &notExists) && config != nil && config.Enabled:
+		if err := registerDomain(ctx, domainClient, domain, config, logger); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("domain %v doesn't exist: %w", domain, err)
+	}
+
+	if config == nil || !config.Enabled || len(config.SearchAttributes) == 0 {
+		return nil
+	}
+	return checkSearchAttributes(ctx, workflowClient, config.SearchAttributes)
+}
+
+func registerDomain(
+	ctx context.Context,
+	domainClient client.DomainClient,
+	domain string,
+	config *DomainRegistrationConfig,
+	logger *zap.Logger,
+) error {
+	request, err := newRegisterDomainRequest(domain, config)
+	if err != nil {
+		return err
+	}
+
+	logger.Info("Registering domain.",
+		zap.String("Domain", domain),
+		zap.Int32("RetentionDays", request.GetWorkflowExecutionRetentionPeriodInDays()))
+	var alreadyExists *shared.DomainAlreadyExistsError
+	if err := domainClient.Register(ctx, request); err != nil && !errors.As(err, &alreadyExists) {
+		return fmt.Errorf("failed to register domain %v: %w", domain, err)
+	}
+
+	timeout := config.WaitTimeout
+	if timeout <= 0 {
+		timeout = defaultDomainRegisterTimeout
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(domainPollInterval)
+	defer ticker.Stop()
+	for {
+		_, err := domainClient.Describe(waitCtx, domain)
+		if err == nil {
+			logger.Info("Domain successfully registered.", zap.String("Domain", domain))
+			return nil
+		}
+
+		select {
+		case <-waitCtx.Done():
+			return fmt.Errorf("domain %v was registered but is not describable after %v: %w", domain, timeout, err)
+		case <-ticker.C:
+		}
+	}
+}
+
+func newRegisterDomainRequest(domain string, config *DomainRegistrationConfig) (*shared.RegisterDomainRequest, error) {
+	retention := config.RetentionDays
+	if retention <= 0 {
+		retention = defaultDomainRetentionDays
+	}
+
+	request := &shared.RegisterDomainRequest{
+		Name:                                   StringPtr(domain),
+		Description:                            StringPtr(config.Description),
+		OwnerEmail:                             StringPtr(config.OwnerEmail),
+		WorkflowExecutionRetentionPeriodInDays: Int32Ptr(retention),
+		EmitMetric:                             &config.EmitMetric,
+	}
+	if config.HistoryArchival != nil {
+		status, uri, err := config.HistoryArchival.toThrift()
+		if err != nil {
+			return nil, fmt.Errorf("invalid history archival config: %w", err)
+		}
+		request.HistoryArchivalStatus, request.HistoryArchivalURI = status, uri
+	}
+	if config.VisibilityArchival != nil {
+		status, uri, err := config.VisibilityArchival.toThrift()
+		if err != nil {
+			return nil, fmt.Errorf("invalid visibility archival config: %w", err)
+		}
+		request.VisibilityArchivalStatus, request.VisibilityArchivalURI = status, uri
+	}
+	return request, nil
+}
+
+func (c *ArchivalConfig) toThrift() (*shared.ArchivalStatus, *string, error) {
+	if !c.Enabled {
+		return shared.ArchivalStatusDisabled.Ptr(), nil, nil
+	}
+	if c.URI == "" {
+		return nil, nil, errors.New("uri is required when archival is enabled")
+	}
+	return shared.ArchivalStatusEnabled.Ptr(), StringPtr(c.URI), nil
+}
+
+// checkSearchAttributes verifies that every expected search attribute is known to the cluster with the expected type
+func checkSearchAttributes(ctx context.Context, workflowClient client.Client, expected map[string]string) error {
+	resp, err := workflowClient.GetSearchAttributes(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get search attributes: %w", err)
+	}
+
+	var problems []string
+	for name, wantType := range expected {
+		var want shared.IndexedValueType
+		if err := want.UnmarshalText([]byte(strings.ToUpper(wantType))); err != nil {
+			return fmt.Errorf("invalid type %q for search attribute %v: %w", wantType, name, err)
+		}
+
+		got, ok := resp.GetKeys()[name]
+		switch {
+		case !ok:
+			problems = append(problems, fmt.Sprintf("%v is missing", name))
+		case got != want:
+			problems = append(problems, fmt.Sprintf("%v has type %v, expected %v", name, got, want))
+		}
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("search attributes do not match expectations, add them with "+
+			"'cadence adm cluster add-search-attr': %v", strings.Join(problems, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package common
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/cadence/.gen/go/shared"
+	"go.uber.org/cadence/client"
+	"go.uber.org/zap/zaptest"
+)
+
+// fakeDomainClient pretends the domain becomes describable a number of Describe calls after registration
+type fakeDomainClient struct {
+	client.DomainClient
+
+	registered    *shared.RegisterDomainRequest
+	describeDelay int
+	describeCalls int
+}
+
+func (c *fakeDomainClient) Register(ctx context.Context, request *shared.RegisterDomainRequest) error {
+	c.registered = request
+	return nil
+}
+
+func (c *fakeDomainClient) Describe(ctx context.Context, name string) (*shared.DescribeDomainResponse, error) {
+	c.describeCalls++
+	if c.registered == nil {
+		return nil, &shared.EntityNotExistsError{Message: "domain " + name + " does not exist"}
+	}
+	if c.describeDelay > 0 {
+		c.describeDelay--
+		return nil, &shared.EntityNotExistsError{Message: "domain " + name + " is not visible yet"}
+	}
+	return &shared.DescribeDomainResponse{DomainInfo: &shared.DomainInfo{Name: StringPtr(name)}}, nil
+}
+
+type fakeSearchAttributesClient struct {
+	client.Client
+
+	keys map[string]shared.IndexedValueType
+}
+
+func (c *fakeSearchAttributesClient) GetSearchAttributes(ctx context.Context) (*shared.GetSearchAttributesResponse, error) {
+	return &shared.GetSearchAttributesResponse{Keys: c.keys}, nil
+}
+
+func TestEnsureDomainRegistersMissingDomain(t *testing.T) {
+	pollInterval := domainPollInterval
+	domainPollInterval = time.Millisecond
+	t.Cleanup(func() { domainPollInterval = pollInterval })
+
+	domainClient := &fakeDomainClient{describeDelay: 2}
+	workflowClient := &fakeSearchAttributesClient{keys: map[string]shared.IndexedValueType{
+		"CustomKeywordField": shared.IndexedValueTypeKeyword,
+	}}
+	config := &DomainRegistrationConfig{
+		Enabled:          true,
+		Description:      "samples",
+		OwnerEmail:       "samples@example.com",
+		RetentionDays:    3,
+		HistoryArchival:  &ArchivalConfig{Enabled: true, URI: "file:///tmp/cadence_archival/development"},
+		SearchAttributes: map[string]string{"CustomKeywordField": "Keyword"},
+	}
+
+	err := EnsureDomain(context.Background(), domainClient, workflowClient, "cadence-samples", config, zaptest.NewLogger(t))
+	require.NoError(t, err)
+
+	require.NotNil(t, domainClient.registered)
+	assert.Equal(t, "cadence-samples", domainClient.registered.GetName())
+	assert.Equal(t, "samples@example.com", domainClient.registered.GetOwnerEmail())
+	assert.Equal(t, int32(3), domainClient.registered.GetWorkflowExecutionRetentionPeriodInDays())
+	assert.Equal(t, shared.ArchivalStatusEnabled, domainClient.registered.GetHistoryArchivalStatus())
+	assert.Equal(t, "file:///tmp/cadence_archival/development", domainClient.registered.GetHistoryArchivalURI())
+	assert.Nil(t, domainClient.registered.VisibilityArchivalStatus)
+	// One describe before registering, then polling until the domain shows up
+	assert.Equal(t, 4, domainClient.describeCalls)
+}
+
+func TestEnsureDomainWithoutRegistration(t *testing.T) {
+	domainClient := &fakeDomainClient{}
+	err := EnsureDomain(context.Background(), domainClient, nil, "cadence-samples", nil, zaptest.NewLogger(t))
+	require.Error(t, err)
+	assert.Nil(t, domainClient.registered)
+
+	err = EnsureDomain(context.Background(), domainClient, nil, "cadence-samples",
+		&DomainRegistrationConfig{Enabled: false}, zaptest.NewLogger(t))
+	require.Error(t, err)
+	assert.Nil(t, domainClient.registered)
+}
+
+func TestEnsureDomainChecksSearchAttributes(t *testing.T) {
+	domainClient := &fakeDomainClient{registered: &shared.RegisterDomainRequest{}}
+	workflowClient := &fakeSearchAttributesClient{keys: map[string]shared.IndexedValueType{
+		"CustomIntField": shared.IndexedValueTypeKeyword,
+	}}
+	config := &DomainRegistrationConfig{Enabled: true, SearchAttributes: map[string]string{
+		"CustomIntField":     "Int",
+		"CustomKeywordField": "Keyword",
+	}}
+
+	err := EnsureDomain(context.Background(), domainClient, workflowClient, "cadence-samples", config, zaptest.NewLogger(t))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "CustomIntField has type KEYWORD, expected INT")
+	assert.Contains(t, err.Error(), "CustomKeywordField is missing")
+
+	// The search attributes are only checked when registration is enabled
+	config.Enabled = false
+	require.NoError(t, EnsureDomain(context.Background(), domainClient, workflowClient, "cadence-samples", config, zaptest.NewLogger(t)))
+}
@@ -1,7 +1,9 @@
 package common
 
 import (
-	"errors"
+	"fmt"
+	"sync"
+	"time"
 
 	"github.com/opentracing/opentracing-go"
 	"github.com/uber-go/tally"
@@ -12,6 +14,7 @@ import (
 	"go.uber.org/cadence/encoded"
 	"go.uber.org/cadence/workflow"
 	"go.uber.org/yarpc"
+	"go.uber.org/yarpc/api/transport"
 	"go.uber.org/yarpc/transport/grpc"
 	"go.uber.org/zap"
 )
@@ -21,10 +24,15 @@ const (
 	_cadenceFrontendService = "cadence-frontend"
 )
 
-// WorkflowClientBuilder build client to cadence service
+// WorkflowClientBuilder build client to cadence service. The clients it builds are cached and shared, so it is safe
+// to call the Build methods repeatedly and from multiple goroutines.
 type WorkflowClientBuilder struct {
+	mu             sync.Mutex
 	hostPort       string
+	peerChooser    string
+	dnsRefresh     time.Duration
 	dispatcher     *yarpc.Dispatcher
+	ownsDispatcher bool
 	domain         string
 	clientIdentity string
 	metricsScope   tally.Scope
@@ -32,6 +40,10 @@ type WorkflowClientBuilder struct {
 	ctxProps       []workflow.ContextPropagator
 	dataConverter  encoded.DataConverter
 	tracer         opentracing.Tracer
+
+	service      workflowserviceclient.Interface
+	client       client.Client
+	domainClient client.DomainClient
 }
 
 // NewBuilder creates a new WorkflowClientBuilder
@@ -43,60 +55,111 @@ func NewBuilder(logger *zap.Logger) *WorkflowClientBuilder {
 
 // SetHostPort sets the hostport for the builder
 func (b *WorkflowClientBuilder) SetHostPort(hostport string) *WorkflowClientBuilder {
+	b.mu.Lock()
+	defer b.mu.Unlock()
 	b.hostPort = hostport
+	b.resetTransport()
+	return b
+}
+
+// SetPeerChooser sets how requests are spread when the hostport names several frontends, see PeerChooserRoundRobin
+// and PeerChooserLeastPending
+func (b *WorkflowClientBuilder) SetPeerChooser(peerChooser string) *WorkflowClientBuilder {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.peerChooser = peerChooser
+	b.resetTransport()
+	return b
+}
+
+// SetDNSRefreshInterval sets how often a dns:/// hostport is resolved again
+func (b *WorkflowClientBuilder) SetDNSRefreshInterval(interval time.Duration) *WorkflowClientBuilder {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.dnsRefresh = interval
+	b.resetTransport()
 	return b
 }
 
 // SetDomain sets the domain for the builder
 func (b *WorkflowClientBuilder) SetDomain(domain string) *WorkflowClientBuilder {
+	b.mu.Lock()
+	defer b.mu.Unlock()
 	b.domain = domain
+	b.resetClients()
 	return b
 }
 
 // SetClientIdentity sets the identity for the builder
 func (b *WorkflowClientBuilder) SetClientIdentity(identity string) *WorkflowClientBuilder {
+	b.mu.Lock()
+	defer b.mu.Unlock()
 	b.clientIdentity = identity
+	b.resetClients()
 	return b
 }
 
 // SetMetricsScope sets the metrics scope for the builder
 func (b *WorkflowClientBuilder) SetMetricsScope(metricsScope tally.Scope) *WorkflowClientBuilder {
+	b.mu.Lock()
+	defer b.mu.Unlock()
 	b.metricsScope = metricsScope
+	b.resetClients()
 	return b
 }
 
 // SetDispatcher sets the dispatcher for the builder
 func (b *WorkflowClientBuilder) SetDispatcher(dispatcher *yarpc.Dispatcher) *WorkflowClientBuilder {
+	b.mu.Lock()
+	defer b.mu.Unlock()
 	b.dispatcher = dispatcher
+	b.ownsDispatcher = false
+	b.resetClients()
 	return b
 }
 
 // SetContextPropagators sets the context propagators for the builder
 func (b *WorkflowClientBuilder) SetContextPropagators(ctxProps []workflow.ContextPropagator) *WorkflowClientBuilder {
+	b.mu.Lock()
+	defer b.mu.Unlock()
 	b.ctxProps = ctxProps
+	b.resetClients()
 	return b
 }
 
 // SetDataConverter sets the data converter for the builder
 func (b *WorkflowClientBuilder) SetDataConverter(dataConverter encoded.DataConverter) *WorkflowClientBuilder {
+	b.mu.Lock()
+	defer b.mu.Unlock()
 	b.dataConverter = dataConverter
+	b.resetClients()
 	return b
 }
 
 // SetTracer sets the tracer for the builder
 func (b *WorkflowClientBuilder) SetTracer(tracer opentracing.Tracer) *WorkflowClientBuilder {
+	b.mu.Lock()
+	defer b.mu.Unlock()
 	b.tracer = tracer
+	b.resetClients()
 	return b
 }
 
-// BuildCadenceClient builds a client to cadence service
+// BuildCadenceClient builds a client to cadence service, reusing the previously built client if there is one
 func (b *WorkflowClientBuilder) BuildCadenceClient() (client.Client, error) {
-	service, err := b.BuildServiceClient()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.client != nil {
+		return b.client, nil
+	}
+
+	service, err := b.buildServiceClient()
 	if err != nil {
 		return nil, err
 	}
 
-	return client.NewClient(
+	b.client = client.NewClient(
 		service,
 		b.domain,
 		&client.Options{
@@ -108,17 +171,25 @@ func (b *WorkflowClientBuilder) BuildCadenceClient() (client.Client, error) {
 			FeatureFlags: client.FeatureFlags{
 				WorkflowExecutionAlreadyCompletedErrorEnabled: true,
 			},
-		}), nil
+		})
+	return b.client, nil
 }
 
-// BuildCadenceDomainClient builds a domain client to cadence service
+// BuildCadenceDomainClient builds a domain client to cadence service, reusing the previously built client if there is one
 func (b *WorkflowClientBuilder) BuildCadenceDomainClient() (client.DomainClient, error) {
-	service, err := b.BuildServiceClient()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.domainClient != nil {
+		return b.domainClient, nil
+	}
+
+	service, err := b.buildServiceClient()
 	if err != nil {
 		return nil, err
 	}
 
-	return client.NewDomainClient(
+	b.domainClient = client.NewDomainClient(
 		service,
 		&client.Options{
 			Identity:           b.clientIdentity,
@@ -128,11 +199,40 @@ func (b *WorkflowClientBuilder) BuildCadenceDomainClient() (client.DomainClient,
 				WorkflowExecutionAlreadyCompletedErrorEnabled: true,
 			},
 		},
-	), nil
+	)
+	return b.domainClient, nil
 }
 
-// BuildServiceClient builds a rpc service client to cadence service
+// BuildServiceClient builds a rpc service client to cadence service, reusing the previously built client if there is one
 func (b *WorkflowClientBuilder) BuildServiceClient() (workflowserviceclient.Interface, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buildServiceClient()
+}
+
+// Close stops the RPC dispatcher if it was started by this builder and drops all cached clients. A dispatcher
+// provided through SetDispatcher is left running since its lifecycle is owned by the caller.
+func (b *WorkflowClientBuilder) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.resetClients()
+	if b.dispatcher == nil || !b.ownsDispatcher {
+		return nil
+	}
+
+	err := b.dispatcher.Stop()
+	b.dispatcher = nil
+	b.ownsDispatcher = false
+	return err
+}
+
+func (b *WorkflowClientBuilder) buildServiceClient() (workflowserviceclient.Interface, error) {
+	if b.service != nil {
+		return b.service, nil
+	}
+
 	if err := b.build(); err != nil {
 		return nil, err
 	}
@@ -142,12 +242,34 @@ func (b *WorkflowClientBuilder) BuildServiceClient() (workflowserviceclient.Inte
 	}
 
 	clientConfig := b.dispatcher.ClientConfig(_cadenceFrontendService)
-	return compatibility.NewThrift2ProtoAdapter(
+	b.service = compatibility.NewThrift2ProtoAdapter(
 		apiv1.NewDomainAPIYARPCClient(clientConfig),
 		apiv1.NewWorkflowAPIYARPCClient(clientConfig),
 		apiv1.NewWorkerAPIYARPCClient(clientConfig),
 		apiv1.NewVisibilityAPIYARPCClient(clientConfig),
-	), nil
+	)
+	return b.service, nil
+}
+
+// resetClients drops the cached clients so the next Build call picks up changed settings. Must be called with mu held.
+func (b *WorkflowClientBuilder) resetClients() {
+	b.service = nil
+	b.client = nil
+	b.domainClient = nil
+}
+
+// resetTransport drops the cached clients and stops the dispatcher this builder started, so the next Build call dials
+// with the changed host or peer settings. A dispatcher set through SetDispatcher is kept. Must be called with mu held.
+func (b *WorkflowClientBuilder) resetTransport() {
+	b.resetClients()
+	if b.dispatcher == nil || !b.ownsDispatcher {
+		return
+	}
+	if err := b.dispatcher.Stop(); err != nil {
+		b.Logger.Warn("Failed to stop RPC dispatcher.", zap.Error(err))
+	}
+	b.dispatcher = nil
+	b.ownsDispatcher = false
 }
 
 func (b *WorkflowClientBuilder) build() error {
@@ -155,26 +277,38 @@ func (b *WorkflowClientBuilder) build() error {
 		return nil
 	}
 
-	if len(b.hostPort) == 0 {
-		return errors.New("HostPort is empty")
+	target, err := parsePeerTarget(b.hostPort)
+	if err != nil {
+		return err
 	}
 
 	b.Logger.Debug("Creating RPC dispatcher outbound",
 		zap.String("ServiceName", _cadenceFrontendService),
-		zap.String("HostPort", b.hostPort))
+		zap.String("HostPort", b.hostPort),
+		zap.String("PeerChooser", b.peerChooser))
+
+	var outbound transport.UnaryOutbound
+	if target.isSingle() {
+		outbound = grpc.NewTransport().NewSingleOutbound(target.hostPorts[0])
+	} else {
+		outbound, err = newPeerOutbound(grpc.NewTransport(), target, b.peerChooser, b.dnsRefresh, b.Logger)
+		if err != nil {
+			return err
+		}
+	}
 
 	b.dispatcher = yarpc.NewDispatcher(yarpc.Config{
 		Name: _cadenceClientName,
 		Outbounds: yarpc.Outbounds{
-			_cadenceFrontendService: {Unary: grpc.NewTransport().NewSingleOutbound(b.hostPort)},
+			_cadenceFrontendService: {Unary: outbound},
 		},
 	})
 
-	if b.dispatcher != nil {
-		if err := b.dispatcher.Start(); err != nil {
-			b.Logger.Fatal("Failed to create outbound transport channel: %v", zap.Error(err))
-		}
+	if err := b.dispatcher.Start(); err != nil {
+		b.dispatcher = nil
+		return fmt.Errorf("failed to create outbound transport channel: %w", err)
 	}
+	b.ownsDispatcher = true
 
 	return nil
 }
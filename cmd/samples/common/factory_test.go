@@ -0,0 +1,87 @@
+package common
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/cadence/client"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestBuilderReusesClients(t *testing.T) {
+	builder := NewBuilder(zaptest.NewLogger(t)).
+		SetHostPort("127.0.0.1:7833").
+		SetDomain("cadence-samples")
+	defer builder.Close()
+
+	var wg sync.WaitGroup
+	clients := make([]client.Client, 10)
+	errs := make([]error, len(clients))
+	for i := range clients {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			clients[i], errs[i] = builder.BuildCadenceClient()
+		}(i)
+	}
+	wg.Wait()
+
+	for i, c := range clients {
+		require.NoError(t, errs[i])
+		require.True(t, c == clients[0])
+	}
+
+	first, err := builder.BuildServiceClient()
+	require.NoError(t, err)
+	second, err := builder.BuildServiceClient()
+	require.NoError(t, err)
+	require.True(t, first == second)
+
+	// Changing a setting must invalidate the cached client
+	builder.SetDomain("another-domain")
+	rebuilt, err := builder.BuildCadenceClient()
+	require.NoError(t, err)
+	require.False(t, rebuilt == clients[0])
+}
+
+func TestBuilderClose(t *testing.T) {
+	builder := NewBuilder(zaptest.NewLogger(t)).SetHostPort("127.0.0.1:7833")
+
+	_, err := builder.BuildCadenceDomainClient()
+	require.NoError(t, err)
+	require.NotNil(t, builder.dispatcher)
+
+	require.NoError(t, builder.Close())
+	require.Nil(t, builder.dispatcher)
+	require.Nil(t, builder.domainClient)
+
+	// Closing twice is a no-op
+	require.NoError(t, builder.Close())
+}
+
+func TestBuilderRedialsOnHostChange(t *testing.T) {
+	builder := NewBuilder(zaptest.NewLogger(t)).SetHostPort("127.0.0.1:7833")
+	defer builder.Close()
+
+	_, err := builder.BuildServiceClient()
+	require.NoError(t, err)
+	first := builder.dispatcher
+	outbound := first.Outbounds()[_cadenceFrontendService].Unary
+	require.True(t, outbound.IsRunning())
+
+	// The dispatcher dialing the old host is stopped and a new one is started on the next build
+	builder.SetHostPort("127.0.0.1:7834")
+	require.False(t, outbound.IsRunning())
+	_, err = builder.BuildServiceClient()
+	require.NoError(t, err)
+	require.NotNil(t, builder.dispatcher)
+	require.False(t, builder.dispatcher == first)
+
+	// A dispatcher set by the caller is kept
+	second := builder.dispatcher
+	builder.SetDispatcher(second)
+	builder.SetPeerChooser(PeerChooserLeastPending)
+	require.True(t, builder.dispatcher == second)
+	require.NoError(t, second.Stop())
+}
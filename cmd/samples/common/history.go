@@ -0,0 +1,239 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"go.uber.org/cadence/.gen/go/shared"
+	"go.uber.org/cadence/client"
+	"go.uber.org/cadence/encoded"
+)
+
+// maxDecodedArgs bounds the number of values decodePayload reads from one payload
+const maxDecodedArgs = 16
+
+// FetchHistory returns every event of the given run of a workflow, an empty runID selects the current run. The
+// client pages through GetWorkflowExecutionHistory until the last page; events of a running workflow are returned
+// as of the call.
+func FetchHistory(ctx context.Context, c client.Client, workflowID, runID string) ([]*shared.HistoryEvent, error) {
+	var events []*shared.HistoryEvent
+	it := c.GetWorkflowHistory(ctx, workflowID, runID, false, shared.HistoryEventFilterTypeAllEvent)
+	for it.HasNext() {
+		event, err := it.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get history of workflow %v: %w", workflowID, err)
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// WriteHistoryJSON writes the events as the JSON array that the replay tests read with
+// worker.NewWorkflowReplayer().ReplayWorkflowHistoryFromJSONFile
+func WriteHistoryJSON(w io.Writer, events []*shared.HistoryEvent) error {
+	data, err := json.MarshalIndent(events, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode history: %w", err)
+	}
+	if _, err := w.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+	return nil
+}
+
+// WriteHistoryTimeline writes one line per event with its ID, time, type and the attributes that matter when
+// reading a history. Payloads are decoded with dataConverter, or shown as their size when it is nil.
+func WriteHistoryTimeline(w io.Writer, events []*shared.HistoryEvent, dataConverter encoded.DataConverter) error {
+	var start int64
+	if len(events) > 0 {
+		start = events[0].GetTimestamp()
+	}
+	for _, event := range events {
+		line := fmt.Sprintf("%5d  %v  +%-10v  %v",
+			event.GetEventId(),
+			time.Unix(0, event.GetTimestamp()).UTC().Format(time.RFC3339Nano),
+			time.Duration(event.GetTimestamp()-start).Round(time.Millisecond),
+			event.GetEventType())
+		if details := eventDetails(event, dataConverter); len(details) > 0 {
+			line += "  " + strings.Join(details, " ")
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return fmt.Errorf("failed to write timeline: %w", err)
+		}
+	}
+	return nil
+}
+
+// ExportHistory fetches the history of the given run and writes it to path in the replayer's JSON format. With a
+// timeline writer it also prints the timeline there, decoding payloads with the helper's data converter if
+// decodePayloads is set.
+func (h *SampleHelper) ExportHistory(ctx context.Context, workflowID, runID, path string, timeline io.Writer, decodePayloads bool) error {
+	workflowClient, err := h.Builder.BuildCadenceClient()
+	if err != nil {
+		return fmt.Errorf("failed to build cadence client: %w", err)
+	}
+	events, err := FetchHistory(ctx, workflowClient, workflowID, runID)
+	if err != nil {
+		return err
+	}
+
+	if path != "" {
+		f, err := os.Create(path)
+		if err != nil {
+			return fmt.Errorf("failed to create history file: %w", err)
+		}
+		if err := WriteHistoryJSON(f, events); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return fmt.Errorf("failed to close history file: %w", err)
+		}
+	}
+
+	if timeline == nil {
+		return nil
+	}
+	var dataConverter encoded.DataConverter
+	if decodePayloads {
+		dataConverter = h.DataConverter
+		if dataConverter == nil {
+			dataConverter = encoded.GetDefaultDataConverter()
+		}
+	}
+	return WriteHistoryTimeline(timeline, events, dataConverter)
+}
+
+// eventDetails returns the key=value pairs printed after the event type
+func eventDetails(event *shared.HistoryEvent, dc encoded.DataConverter) []string {
+	var details detailList
+	switch event.GetEventType() {
+	case shared.EventTypeWorkflowExecutionStarted:
+		attr := event.WorkflowExecutionStartedEventAttributes
+		details.add("type", attr.GetWorkflowType().GetName())
+		details.add("taskList", attr.GetTaskList().GetName())
+		details.payload("input", attr.Input, dc)
+	case shared.EventTypeWorkflowExecutionCompleted:
+		details.payload("result", event.WorkflowExecutionCompletedEventAttributes.Result, dc)
+	case shared.EventTypeWorkflowExecutionFailed:
+		attr := event.WorkflowExecutionFailedEventAttributes
+		details.add("reason", attr.GetReason())
+		details.payload("details", attr.Details, dc)
+	case shared.EventTypeWorkflowExecutionContinuedAsNew:
+		attr := event.WorkflowExecutionContinuedAsNewEventAttributes
+		details.add("newRunID", attr.GetNewExecutionRunId())
+		details.payload("input", attr.Input, dc)
+	case shared.EventTypeWorkflowExecutionSignaled:
+		attr := event.WorkflowExecutionSignaledEventAttributes
+		details.add("signal", attr.GetSignalName())
+		details.payload("input", attr.Input, dc)
+	case shared.EventTypeWorkflowExecutionTerminated:
+		attr := event.WorkflowExecutionTerminatedEventAttributes
+		details.add("reason", attr.GetReason())
+		details.add("identity", attr.GetIdentity())
+	case shared.EventTypeDecisionTaskCompleted:
+		details.add("binaryChecksum", event.DecisionTaskCompletedEventAttributes.GetBinaryChecksum())
+	case shared.EventTypeDecisionTaskFailed:
+		attr := event.DecisionTaskFailedEventAttributes
+		details.add("cause", attr.GetCause().String())
+		details.add("reason", attr.GetReason())
+	case shared.EventTypeActivityTaskScheduled:
+		attr := event.ActivityTaskScheduledEventAttributes
+		details.add("activityID", attr.GetActivityId())
+		details.add("type", attr.GetActivityType().GetName())
+		details.payload("input", attr.Input, dc)
+	case shared.EventTypeActivityTaskStarted:
+		details.add("attempt", fmt.Sprint(event.ActivityTaskStartedEventAttributes.GetAttempt()))
+	case shared.EventTypeActivityTaskCompleted:
+		attr := event.ActivityTaskCompletedEventAttributes
+		details.add("scheduledEventID", fmt.Sprint(attr.GetScheduledEventId()))
+		details.payload("result", attr.Result, dc)
+	case shared.EventTypeActivityTaskFailed:
+		attr := event.ActivityTaskFailedEventAttributes
+		details.add("scheduledEventID", fmt.Sprint(attr.GetScheduledEventId()))
+		details.add("reason", attr.GetReason())
+		details.payload("details", attr.Details, dc)
+	case shared.EventTypeActivityTaskTimedOut:
+		attr := event.ActivityTaskTimedOutEventAttributes
+		details.add("scheduledEventID", fmt.Sprint(attr.GetScheduledEventId()))
+		details.add("timeoutType", attr.GetTimeoutType().String())
+	case shared.EventTypeTimerStarted:
+		attr := event.TimerStartedEventAttributes
+		details.add("timerID", attr.GetTimerId())
+		details.add("timeout", (time.Duration(attr.GetStartToFireTimeoutSeconds()) * time.Second).String())
+	case shared.EventTypeTimerFired:
+		details.add("timerID", event.TimerFiredEventAttributes.GetTimerId())
+	case shared.EventTypeMarkerRecorded:
+		attr := event.MarkerRecordedEventAttributes
+		details.add("marker", attr.GetMarkerName())
+		details.payload("details", attr.Details, dc)
+	case shared.EventTypeStartChildWorkflowExecutionInitiated:
+		attr := event.StartChildWorkflowExecutionInitiatedEventAttributes
+		details.add("workflowID", attr.GetWorkflowId())
+		details.add("type", attr.GetWorkflowType().GetName())
+		details.payload("input", attr.Input, dc)
+	case shared.EventTypeChildWorkflowExecutionCompleted:
+		attr := event.ChildWorkflowExecutionCompletedEventAttributes
+		details.add("workflowID", attr.GetWorkflowExecution().GetWorkflowId())
+		details.payload("result", attr.Result, dc)
+	case shared.EventTypeChildWorkflowExecutionFailed:
+		attr := event.ChildWorkflowExecutionFailedEventAttributes
+		details.add("workflowID", attr.GetWorkflowExecution().GetWorkflowId())
+		details.add("reason", attr.GetReason())
+	case shared.EventTypeSignalExternalWorkflowExecutionInitiated:
+		attr := event.SignalExternalWorkflowExecutionInitiatedEventAttributes
+		details.add("workflowID", attr.GetWorkflowExecution().GetWorkflowId())
+		details.add("signal", attr.GetSignalName())
+		details.payload("input", attr.Input, dc)
+	}
+	return details
+}
+
+type detailList []string
+
+func (d *detailList) add(key, value string) {
+	if value != "" {
+		*d = append(*d, key+"="+value)
+	}
+}
+
+func (d *detailList) payload(key string, data []byte, dc encoded.DataConverter) {
+	if len(data) > 0 {
+		*d = append(*d, key+"="+decodePayload(data, dc))
+	}
+}
+
+// decodePayload returns the values encoded in a payload as JSON. A payload holds one value per argument and the
+// count is not recorded, so it decodes as many values as the data converter accepts.
+func decodePayload(data []byte, dc encoded.DataConverter) string {
+	if dc == nil {
+		return fmt.Sprintf("<%d bytes>", len(data))
+	}
+
+	var decoded []interface{}
+	for n := 1; n <= maxDecodedArgs; n++ {
+		values := make([]interface{}, n)
+		ptrs := make([]interface{}, n)
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := dc.FromData(data, ptrs...); err != nil {
+			break
+		}
+		decoded = values
+	}
+	if decoded == nil {
+		return fmt.Sprintf("<%d bytes>", len(data))
+	}
+
+	encodedValues, err := json.Marshal(decoded)
+	if err != nil {
+		return fmt.Sprintf("<%d bytes>", len(data))
+	}
+	return string(encodedValues)
+}
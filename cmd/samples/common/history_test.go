@@ -0,0 +1,120 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/cadence/.gen/go/shared"
+	"go.uber.org/cadence/client"
+	"go.uber.org/cadence/encoded"
+	"go.uber.org/zap/zaptest"
+)
+
+// fakeHistoryClient serves a fixed history through the client's history iterator
+type fakeHistoryClient struct {
+	client.Client
+
+	events []*shared.HistoryEvent
+}
+
+func (c *fakeHistoryClient) GetWorkflowHistory(ctx context.Context, workflowID, runID string, isLongPoll bool, filterType shared.HistoryEventFilterType) client.HistoryEventIterator {
+	return &fakeHistoryIterator{events: c.events}
+}
+
+type fakeHistoryIterator struct {
+	events []*shared.HistoryEvent
+}
+
+func (it *fakeHistoryIterator) HasNext() bool {
+	return len(it.events) > 0
+}
+
+func (it *fakeHistoryIterator) Next() (*shared.HistoryEvent, error) {
+	event := it.events[0]
+	it.events = it.events[1:]
+	return event, nil
+}
+
+func encode(t *testing.T, values ...interface{}) []byte {
+	data, err := encoded.GetDefaultDataConverter().ToData(values...)
+	require.NoError(t, err)
+	return data
+}
+
+func testHistory(t *testing.T) []*shared.HistoryEvent {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC).UnixNano()
+	at := func(d time.Duration) *int64 { return Int64Ptr(start + int64(d)) }
+	eventType := func(t shared.EventType) *shared.EventType { return &t }
+	return []*shared.HistoryEvent{
+		{
+			EventId:   Int64Ptr(1),
+			Timestamp: at(0),
+			EventType: eventType(shared.EventTypeWorkflowExecutionStarted),
+			WorkflowExecutionStartedEventAttributes: &shared.WorkflowExecutionStartedEventAttributes{
+				WorkflowType: &shared.WorkflowType{Name: StringPtr("helloWorldWorkflow")},
+				TaskList:     &shared.TaskList{Name: StringPtr("helloWorldGroup")},
+				Input:        encode(t, "Cadence", 2),
+			},
+		},
+		{
+			EventId:   Int64Ptr(5),
+			Timestamp: at(20 * time.Millisecond),
+			EventType: eventType(shared.EventTypeActivityTaskScheduled),
+			ActivityTaskScheduledEventAttributes: &shared.ActivityTaskScheduledEventAttributes{
+				ActivityId:   StringPtr("0"),
+				ActivityType: &shared.ActivityType{Name: StringPtr("helloWorldActivity")},
+				Input:        encode(t, "Cadence"),
+			},
+		},
+		{
+			EventId:   Int64Ptr(11),
+			Timestamp: at(1500 * time.Millisecond),
+			EventType: eventType(shared.EventTypeWorkflowExecutionCompleted),
+			WorkflowExecutionCompletedEventAttributes: &shared.WorkflowExecutionCompletedEventAttributes{
+				Result: encode(t, "Hello Cadence!"),
+			},
+		},
+	}
+}
+
+func TestExportHistoryWritesReplayerJSON(t *testing.T) {
+	events := testHistory(t)
+	h := &SampleHelper{
+		Logger:  zaptest.NewLogger(t),
+		Builder: &WorkflowClientBuilder{client: &fakeHistoryClient{events: events}},
+	}
+	path := filepath.Join(t.TempDir(), "helloworld.json")
+
+	var timeline bytes.Buffer
+	require.NoError(t, h.ExportHistory(context.Background(), "helloworld_1", "", path, &timeline, true))
+
+	// the replayer decodes the file as a JSON array of history events
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var decoded []*shared.HistoryEvent
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, events, decoded)
+	assert.Contains(t, string(data), `"eventType": "WorkflowExecutionStarted"`)
+
+	lines := strings.Split(strings.TrimSuffix(timeline.String(), "\n"), "\n")
+	require.Len(t, lines, 3)
+	assert.Equal(t, `    1  2024-05-01T12:00:00Z  +0s          WorkflowExecutionStarted  type=helloWorldWorkflow taskList=helloWorldGroup input=["Cadence",2]`, lines[0])
+	assert.Contains(t, lines[1], `+20ms`)
+	assert.Contains(t, lines[1], `ActivityTaskScheduled  activityID=0 type=helloWorldActivity input=["Cadence"]`)
+	assert.Contains(t, lines[2], `+1.5s`)
+	assert.Contains(t, lines[2], `WorkflowExecutionCompleted  result=["Hello Cadence!"]`)
+}
+
+func TestWriteHistoryTimelineWithoutDecoding(t *testing.T) {
+	var timeline bytes.Buffer
+	require.NoError(t, WriteHistoryTimeline(&timeline, testHistory(t)[2:], nil))
+	assert.Contains(t, timeline.String(), `WorkflowExecutionCompleted  result=<17 bytes>`)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"go.uber.org/zap"
+
+	"github.com/uber-common/cadence-samples/cmd/samples/common"
+)
+
+// historyexport downloads the history of a workflow run for the replay tests, e.g.
+//
+//	./bin/historyexport -w helloworld_1 -o cmd/samples/recipes/helloworld/helloworld.json
+//
+// writes the JSON that worker.NewWorkflowReplayer().ReplayWorkflowHistoryFromJSONFile reads and prints a timeline
+// of the run.
+func main() {
+	var workflowID, runID, output string
+	var decode, quiet bool
+	flag.StringVar(&workflowID, "w", "", "WorkflowID")
+	flag.StringVar(&runID, "r", "", "RunID, defaults to the current run.")
+	flag.StringVar(&output, "o", "", "File to write the history JSON to, the history is only printed when empty.")
+	flag.BoolVar(&decode, "decode", false, "Decode payloads in the timeline with the data converter.")
+	flag.BoolVar(&quiet, "q", false, "Do not print the timeline.")
+	flag.Parse()
+
+	if workflowID == "" {
+		fmt.Fprintln(os.Stderr, "a workflow ID is required")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var h common.SampleHelper
+	h.SetupServiceConfig()
+
+	var timeline io.Writer = os.Stdout
+	if quiet {
+		timeline = nil
+	}
+	if err := h.ExportHistory(context.Background(), workflowID, runID, output, timeline, decode); err != nil {
+		h.Logger.Fatal("Failed to export history.", zap.String("WorkflowID", workflowID), zap.Error(err))
+	}
+	if output != "" {
+		h.Logger.Info("Exported history.", zap.String("WorkflowID", workflowID), zap.String("File", output))
+	}
+}
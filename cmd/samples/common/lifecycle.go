@@ -0,0 +1,227 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"go.uber.org/cadence/worker"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultDrainTimeout = 10 * time.Second
+
+	// LivenessPath and ReadinessPath are served on the health listen address for Kubernetes probes
+	LivenessPath  = "/healthz"
+	ReadinessPath = "/readyz"
+)
+
+var (
+	// errDrainTimeout is returned when workers are still stopping after the drain timeout
+	errDrainTimeout = errors.New("workers did not stop within the drain timeout")
+
+	// errStartWorkers is returned when a worker fails to start, possibly joined with errDrainTimeout from stopping the
+	// workers started before it
+	errStartWorkers = errors.New("failed to start workers")
+
+	// newWorker creates the workers started by the helper, tests replace it to avoid polling a real frontend
+	newWorker = worker.New
+
+	// drainGracePeriod is added to the drain timeout before giving up on worker.Stop, which itself waits up to the
+	// drain timeout for in-flight tasks
+	drainGracePeriod = 2 * time.Second
+)
+
+type (
+	// LifecycleConfig controls how RunWorkers reports worker health and shuts workers down
+	LifecycleConfig struct {
+		// DrainTimeout is how long in-flight activities and decisions get to finish on shutdown, defaults to 10s
+		DrainTimeout time.Duration `yaml:"drainTimeout"`
+		// HealthListenAddress serves the liveness and readiness probes when set, e.g. 0.0.0.0:8080
+		HealthListenAddress string `yaml:"healthListenAddress"`
+	}
+
+	// WorkerSpec describes one of the workers run by RunWorkers
+	WorkerSpec struct {
+		// Domain defaults to the configured domain
+		Domain   string
+		TaskList string
+		Options  worker.Options
+
+		// group provides the registrations of worker group specs, other specs use the helper's registrations
+		group *WorkerGroup
+	}
+
+	// healthServer answers liveness probes while the process runs and readiness probes while all workers are
+	// started and not draining
+	healthServer struct {
+		ready    atomic.Bool
+		server   *http.Server
+		listener net.Listener
+	}
+)
+
+// RunWorkers starts a worker for each spec and blocks until the process receives SIGINT or SIGTERM, then stops the
+// workers, giving in-flight tasks up to the configured drain timeout to finish. Workers that do not drain in time are
+// only logged, a worker that fails to start panics.
+func (h *SampleHelper) RunWorkers(specs ...WorkerSpec) {
+	err := h.TryRunWorkers(context.Background(), specs...)
+	if errors.Is(err, errDrainTimeout) && !errors.Is(err, errStartWorkers) {
+		h.Logger.Warn("Workers did not drain in time.", zap.Error(err))
+		return
+	}
+	if err != nil {
+		h.Logger.Error("Failed to run workers.", zap.Error(err))
+		panic("Failed to run workers")
+	}
+}
+
+// TryRunWorkers is RunWorkers returning an error instead of panicking. It also returns once ctx is done. The metric
+// scopes are flushed and the metrics endpoint is shut down once the workers stopped.
+func (h *SampleHelper) TryRunWorkers(ctx context.Context, specs ...WorkerSpec) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	defer func() {
+		if err := h.closeMetrics(); err != nil {
+			h.Logger.Warn("Failed to close metrics.", zap.Error(err))
+		}
+	}()
+
+	config := h.Config.Lifecycle
+	if config == nil {
+		config = &LifecycleConfig{}
+	}
+	drainTimeout := config.DrainTimeout
+	if drainTimeout <= 0 {
+		drainTimeout = defaultDrainTimeout
+	}
+
+	health := &healthServer{}
+	if config.HealthListenAddress != "" {
+		if err := health.start(config.HealthListenAddress, h.Logger); err != nil {
+			return err
+		}
+		h.health.Store(health)
+		defer func() {
+			h.health.Store((*healthServer)(nil))
+			if err := health.stop(); err != nil {
+				h.Logger.Warn("Failed to stop health server.", zap.Error(err))
+			}
+		}()
+	}
+
+	workers := make([]worker.Worker, 0, len(specs))
+	taskLists := make([]string, 0, len(specs))
+	for _, spec := range specs {
+		domain := spec.Domain
+		if domain == "" {
+			domain = h.Config.DomainName
+		}
+		if spec.Options.WorkerStopTimeout == 0 {
+			spec.Options.WorkerStopTimeout = drainTimeout
+		}
+		workflows, activities := h.workflowRegistries, h.activityRegistries
+		if spec.group != nil {
+			workflows, activities = spec.group.workflows, spec.group.activities
+		}
+		w, err := h.startWorker(domain, spec.TaskList, spec.Options, workflows, activities)
+		if err != nil {
+			return errors.Join(fmt.Errorf("task list %v: %w", spec.TaskList, err), stopWorkers(workers, drainTimeout))
+		}
+		workers = append(workers, w)
+		taskLists = append(taskLists, spec.TaskList)
+	}
+
+	health.ready.Store(true)
+	h.Logger.Info("Workers started, stop them with SIGINT or SIGTERM.", zap.Strings("TaskLists", taskLists))
+	<-ctx.Done()
+
+	health.ready.Store(false)
+	h.Logger.Info("Stopping workers.", zap.Strings("TaskLists", taskLists), zap.Duration("DrainTimeout", drainTimeout))
+	if err := stopWorkers(workers, drainTimeout); err != nil {
+		return err
+	}
+	h.Logger.Info("Workers stopped.")
+	return nil
+}
+
+// HealthAddr returns the address the health probes are served on, empty if RunWorkers is not serving them
+func (h *SampleHelper) HealthAddr() string {
+	health, _ := h.health.Load().(*healthServer)
+	if health == nil {
+		return ""
+	}
+	return health.listener.Addr().String()
+}
+
+// stopWorkers stops the workers concurrently and waits for them for at most the drain timeout plus a grace period
+func stopWorkers(workers []worker.Worker, drainTimeout time.Duration) error {
+	var wg sync.WaitGroup
+	for _, w := range workers {
+		wg.Add(1)
+		go func(w worker.Worker) {
+			defer wg.Done()
+			w.Stop()
+		}(w)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-time.After(drainTimeout + drainGracePeriod):
+		return fmt.Errorf("%w: %v", errDrainTimeout, drainTimeout)
+	}
+}
+
+func (s *healthServer) start(addr string, logger *zap.Logger) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen for health probes on %v: %w", addr, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(LivenessPath, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc(ReadinessPath, func(w http.ResponseWriter, r *http.Request) {
+		if !s.ready.Load() {
+			http.Error(w, "not ready", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+	s.listener = listener
+	s.server = &http.Server{Handler: mux}
+	go func() {
+		if err := s.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("Health server stopped.", zap.Error(err))
+		}
+	}()
+
+	logger.Info("Serving health probes.",
+		zap.String("Address", listener.Addr().String()),
+		zap.String("Liveness", LivenessPath),
+		zap.String("Readiness", ReadinessPath))
+	return nil
+}
+
+func (s *healthServer) stop() error {
+	ctx, cancel := context.WithTimeout(context.Background(), metricsShutdownTimeout)
+	defer cancel()
+	return s.server.Shutdown(ctx)
+}
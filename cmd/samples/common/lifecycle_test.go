@@ -0,0 +1,245 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally/prometheus"
+	"go.uber.org/cadence/.gen/go/cadence/workflowserviceclient"
+	"go.uber.org/cadence/activity"
+	"go.uber.org/cadence/worker"
+	"go.uber.org/cadence/workflow"
+	"go.uber.org/zap/zaptest"
+)
+
+// fakeWorker records how it was started and stopped instead of polling a frontend
+type fakeWorker struct {
+	worker.Worker
+
+	domain   string
+	taskList string
+	options  worker.Options
+	startErr error
+	stopTime time.Duration
+
+	mu         sync.Mutex
+	stopped    bool
+	workflows  []string
+	activities []string
+}
+
+func (w *fakeWorker) RegisterWorkflow(wf interface{}) {
+	w.workflows = append(w.workflows, getFunctionName(wf))
+}
+
+func (w *fakeWorker) RegisterWorkflowWithOptions(wf interface{}, options workflow.RegisterOptions) {
+	w.workflows = append(w.workflows, options.Name)
+}
+
+func (w *fakeWorker) RegisterActivity(a interface{}) {
+	w.activities = append(w.activities, getFunctionName(a))
+}
+
+func (w *fakeWorker) RegisterActivityWithOptions(a interface{}, options activity.RegisterOptions) {
+	w.activities = append(w.activities, options.Name)
+}
+
+func (w *fakeWorker) Start() error {
+	return w.startErr
+}
+
+func (w *fakeWorker) Stop() {
+	time.Sleep(w.stopTime)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.stopped = true
+}
+
+func (w *fakeWorker) isStopped() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.stopped
+}
+
+// fakeWorkers replaces newWorker for the duration of the test, configure lets a test adjust each worker
+func fakeWorkers(t *testing.T, configure func(*fakeWorker)) *[]*fakeWorker {
+	var mu sync.Mutex
+	workers := &[]*fakeWorker{}
+	newWorker = func(_ workflowserviceclient.Interface, domain, taskList string, options worker.Options) worker.Worker {
+		w := &fakeWorker{domain: domain, taskList: taskList, options: options}
+		if configure != nil {
+			configure(w)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		*workers = append(*workers, w)
+		return w
+	}
+	t.Cleanup(func() { newWorker = worker.New })
+	return workers
+}
+
+// getFunctionName returns the short name of a registered function
+func getFunctionName(fn interface{}) string {
+	name := runtime.FuncForPC(reflect.ValueOf(fn).Pointer()).Name()
+	return name[strings.LastIndex(name, ".")+1:]
+}
+
+func probe(t *testing.T, addr, path string) int {
+	resp, err := http.Get("http://" + addr + path)
+	require.NoError(t, err)
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestRunWorkersServesProbesAndDrains(t *testing.T) {
+	workers := fakeWorkers(t, nil)
+	h := &SampleHelper{
+		Logger: zaptest.NewLogger(t),
+		Config: Configuration{
+			DomainName: "cadence-samples",
+			Lifecycle: &LifecycleConfig{
+				DrainTimeout:        time.Second,
+				HealthListenAddress: "127.0.0.1:0",
+			},
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- h.TryRunWorkers(ctx,
+			WorkerSpec{TaskList: "shared-tl"},
+			WorkerSpec{Domain: "other-domain", TaskList: "host-tl", Options: worker.Options{WorkerStopTimeout: time.Minute}},
+		)
+	}()
+
+	require.Eventually(t, func() bool {
+		addr := h.HealthAddr()
+		return addr != "" && probe(t, addr, ReadinessPath) == http.StatusOK
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, http.StatusOK, probe(t, h.HealthAddr(), LivenessPath))
+
+	require.Len(t, *workers, 2)
+	assert.Equal(t, "cadence-samples", (*workers)[0].domain)
+	assert.Equal(t, "shared-tl", (*workers)[0].taskList)
+	assert.Equal(t, time.Second, (*workers)[0].options.WorkerStopTimeout)
+	assert.Equal(t, "other-domain", (*workers)[1].domain)
+	assert.Equal(t, "host-tl", (*workers)[1].taskList)
+	assert.Equal(t, time.Minute, (*workers)[1].options.WorkerStopTimeout)
+
+	cancel()
+	require.NoError(t, <-done)
+	for _, w := range *workers {
+		assert.True(t, w.isStopped(), w.taskList)
+	}
+	assert.Empty(t, h.HealthAddr())
+}
+
+func TestRunWorkersStopsOnSIGTERM(t *testing.T) {
+	workers := fakeWorkers(t, nil)
+	h := &SampleHelper{
+		Logger: zaptest.NewLogger(t),
+		Config: Configuration{Lifecycle: &LifecycleConfig{HealthListenAddress: "127.0.0.1:0"}},
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- h.TryRunWorkers(context.Background(), WorkerSpec{TaskList: "samples-tl"})
+	}()
+	require.Eventually(t, func() bool {
+		addr := h.HealthAddr()
+		return addr != "" && probe(t, addr, ReadinessPath) == http.StatusOK
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, syscall.Kill(syscall.Getpid(), syscall.SIGTERM))
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("workers were not stopped on SIGTERM")
+	}
+	require.Len(t, *workers, 1)
+	assert.True(t, (*workers)[0].isStopped())
+	assert.Equal(t, defaultDrainTimeout, (*workers)[0].options.WorkerStopTimeout)
+}
+
+func TestRunWorkersDrainTimeout(t *testing.T) {
+	drainGracePeriod = 0
+	t.Cleanup(func() { drainGracePeriod = 2 * time.Second })
+	fakeWorkers(t, func(w *fakeWorker) { w.stopTime = time.Second })
+	h := &SampleHelper{
+		Logger: zaptest.NewLogger(t),
+		Config: Configuration{Lifecycle: &LifecycleConfig{DrainTimeout: 10 * time.Millisecond}},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := h.TryRunWorkers(ctx, WorkerSpec{TaskList: "samples-tl"})
+	require.ErrorIs(t, err, errDrainTimeout)
+}
+
+func TestRunWorkersStartFailureStopsStartedWorkers(t *testing.T) {
+	startErr := errors.New("domain does not exist")
+	workers := fakeWorkers(t, func(w *fakeWorker) {
+		if w.taskList == "broken-tl" {
+			w.startErr = startErr
+		}
+	})
+	h := &SampleHelper{Logger: zaptest.NewLogger(t)}
+
+	err := h.TryRunWorkers(context.Background(), WorkerSpec{TaskList: "samples-tl"}, WorkerSpec{TaskList: "broken-tl"})
+	require.ErrorIs(t, err, startErr)
+	assert.Contains(t, err.Error(), "broken-tl")
+	require.Len(t, *workers, 2)
+	assert.True(t, (*workers)[0].isStopped())
+}
+
+func TestRunWorkersStartFailureWithDrainTimeoutPanics(t *testing.T) {
+	drainGracePeriod = 0
+	t.Cleanup(func() { drainGracePeriod = 2 * time.Second })
+	fakeWorkers(t, func(w *fakeWorker) {
+		w.stopTime = time.Second
+		if w.taskList == "broken-tl" {
+			w.startErr = errors.New("domain does not exist")
+		}
+	})
+	h := &SampleHelper{
+		Logger: zaptest.NewLogger(t),
+		Config: Configuration{Lifecycle: &LifecycleConfig{DrainTimeout: 10 * time.Millisecond}},
+	}
+
+	// The started worker does not drain in time, the start failure still fails the process
+	err := h.TryRunWorkers(context.Background(), WorkerSpec{TaskList: "samples-tl"}, WorkerSpec{TaskList: "broken-tl"})
+	require.ErrorIs(t, err, errDrainTimeout)
+	require.ErrorIs(t, err, errStartWorkers)
+	assert.Panics(t, func() {
+		h.RunWorkers(WorkerSpec{TaskList: "samples-tl"}, WorkerSpec{TaskList: "broken-tl"})
+	})
+}
+
+func TestRunWorkersClosesMetrics(t *testing.T) {
+	fakeWorkers(t, nil)
+	h := &SampleHelper{
+		Logger: zaptest.NewLogger(t),
+		Config: Configuration{Prometheus: &prometheus.Configuration{ListenAddress: "127.0.0.1:0"}},
+	}
+	h.SetupMetrics()
+	require.NotEmpty(t, h.MetricsAddr())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.NoError(t, h.TryRunWorkers(ctx, WorkerSpec{TaskList: "samples-tl"}))
+	assert.Empty(t, h.MetricsAddr())
+	require.NoError(t, h.Close())
+}
@@ -0,0 +1,94 @@
+package common
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	logEncodingJSON    = "json"
+	logEncodingConsole = "console"
+)
+
+type (
+	// LoggingConfig controls the logger built by SampleHelper and handed to workers. Without it samples log like
+	// zap.NewDevelopment.
+	LoggingConfig struct {
+		// Level is the minimum enabled level: debug, info, warn or error
+		Level string `yaml:"level"`
+		// Encoding is json or console, defaults to console
+		Encoding string `yaml:"encoding"`
+		// OutputPaths are the log sinks, defaults to stderr
+		OutputPaths      []string `yaml:"outputPaths"`
+		ErrorOutputPaths []string `yaml:"errorOutputPaths"`
+		// Sampling caps repeated messages per second, nil keeps the encoding's default
+		Sampling *LogSamplingConfig `yaml:"sampling"`
+		// Fields are added to every entry, values may reference environment variables, e.g. host: ${HOSTNAME}
+		Fields map[string]string `yaml:"fields"`
+	}
+
+	// LogSamplingConfig logs the first Initial entries with the same message each second and every Thereafter-th
+	// entry after that.
+	LogSamplingConfig struct {
+		Initial    int `yaml:"initial"`
+		Thereafter int `yaml:"thereafter"`
+	}
+)
+
+// NewLogger builds a zap logger from the logging config, a nil config gives a development logger.
+func NewLogger(config *LoggingConfig) (*zap.Logger, error) {
+	zapConfig, err := config.zapConfig()
+	if err != nil {
+		return nil, err
+	}
+	return zapConfig.Build()
+}
+
+func (c *LoggingConfig) zapConfig() (zap.Config, error) {
+	if c == nil {
+		return zap.NewDevelopmentConfig(), nil
+	}
+
+	var zapConfig zap.Config
+	switch strings.ToLower(c.Encoding) {
+	case "", logEncodingConsole:
+		zapConfig = zap.NewDevelopmentConfig()
+	case logEncodingJSON:
+		zapConfig = zap.NewProductionConfig()
+		zapConfig.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+	default:
+		return zap.Config{}, fmt.Errorf("unknown log encoding %q, expected %q or %q",
+			c.Encoding, logEncodingJSON, logEncodingConsole)
+	}
+
+	if c.Level != "" {
+		level, err := zap.ParseAtomicLevel(c.Level)
+		if err != nil {
+			return zap.Config{}, fmt.Errorf("invalid log level: %w", err)
+		}
+		zapConfig.Level = level
+	}
+	if len(c.OutputPaths) > 0 {
+		zapConfig.OutputPaths = c.OutputPaths
+	}
+	if len(c.ErrorOutputPaths) > 0 {
+		zapConfig.ErrorOutputPaths = c.ErrorOutputPaths
+	}
+	if c.Sampling != nil {
+		zapConfig.Sampling = &zap.SamplingConfig{
+			Initial:    c.Sampling.Initial,
+			Thereafter: c.Sampling.Thereafter,
+		}
+	}
+	if len(c.Fields) > 0 {
+		zapConfig.InitialFields = make(map[string]interface{}, len(c.Fields))
+		for k, v := range c.Fields {
+			zapConfig.InitialFields[k] = os.ExpandEnv(v)
+		}
+	}
+	return zapConfig, nil
+}
@@ -0,0 +1,53 @@
+package common
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewLoggerJSON(t *testing.T) {
+	t.Setenv("SAMPLES_TEST_HOST", "worker-1")
+	output := filepath.Join(t.TempDir(), "samples.log")
+
+	logger, err := NewLogger(&LoggingConfig{
+		Level:       "warn",
+		Encoding:    "json",
+		OutputPaths: []string{output},
+		Fields: map[string]string{
+			"service": "cadence-samples",
+			"host":    "${SAMPLES_TEST_HOST}",
+		},
+	})
+	require.NoError(t, err)
+
+	logger.Info("filtered by level")
+	logger.Warn("written")
+	require.NoError(t, logger.Sync())
+
+	data, err := os.ReadFile(output)
+	require.NoError(t, err)
+
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &entry), "expected a single JSON entry, got %s", data)
+	assert.Equal(t, "written", entry["msg"])
+	assert.Equal(t, "warn", entry["level"])
+	assert.Equal(t, "cadence-samples", entry["service"])
+	assert.Equal(t, "worker-1", entry["host"])
+}
+
+func TestNewLoggerInvalidConfig(t *testing.T) {
+	_, err := NewLogger(&LoggingConfig{Encoding: "xml"})
+	require.Error(t, err)
+
+	_, err = NewLogger(&LoggingConfig{Level: "loud"})
+	require.Error(t, err)
+
+	logger, err := NewLogger(nil)
+	require.NoError(t, err)
+	require.NotNil(t, logger)
+}
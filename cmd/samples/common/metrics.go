@@ -0,0 +1,193 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	prom "github.com/m3db/prometheus_client_golang/prometheus"
+	"github.com/uber-go/tally"
+	"github.com/uber-go/tally/prometheus"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultMetricsPath           = "/metrics"
+	defaultMetricsReportInterval = time.Second
+	defaultWorkerMetricsPrefix   = "Worker_"
+	metricsShutdownTimeout       = 5 * time.Second
+
+	// DomainTagName and TaskListTagName are the common tags added to sample metrics
+	DomainTagName   = "domain"
+	TaskListTagName = "tasklist"
+)
+
+type (
+	// MetricsConfig controls the tags and reporting of the metrics emitted by the samples. The Prometheus section of
+	// Configuration controls the scrape endpoint and the histogram buckets.
+	MetricsConfig struct {
+		// Tags are added to every metric on top of the domain tag
+		Tags map[string]string `yaml:"tags"`
+		// ReportInterval is how often metrics are flushed to the reporter, defaults to 1s
+		ReportInterval time.Duration `yaml:"reportInterval"`
+		// WorkerPrefix is prepended to the worker metric names, defaults to Worker_. An empty prefix keeps the names
+		// of the cadence client, e.g. for dashboards that query them.
+		WorkerPrefix *string `yaml:"workerPrefix"`
+	}
+
+	// metricsServer serves the Prometheus scrape endpoint owned by SampleHelper
+	metricsServer struct {
+		server   *http.Server
+		listener net.Listener
+		closers  []io.Closer
+	}
+)
+
+// SetupMetrics builds the worker and service metric scopes from the Prometheus and metrics config of h.Config and
+// starts serving them. Without Prometheus config both scopes are no-ops. When the scrape endpoint cannot listen, e.g.
+// because a worker of another sample holds the port, the failure is logged and the scopes report without it.
+// SetupServiceConfig calls it, samples that set up the helper themselves call it once Config and Logger are set.
+func (h *SampleHelper) SetupMetrics() {
+	h.ServiceMetricScope = tally.NoopScope
+	h.WorkerMetricScope = tally.NoopScope
+	if h.Config.Prometheus == nil {
+		return
+	}
+
+	registry := prom.NewRegistry()
+	reporter := newPrometheusReporter(*h.Config.Prometheus, registry, h.Logger)
+
+	tags := map[string]string{DomainTagName: h.Config.DomainName}
+	interval := defaultMetricsReportInterval
+	workerPrefix := defaultWorkerMetricsPrefix
+	if h.Config.Metrics != nil {
+		for k, v := range h.Config.Metrics.Tags {
+			tags[k] = v
+		}
+		if h.Config.Metrics.ReportInterval > 0 {
+			interval = h.Config.Metrics.ReportInterval
+		}
+		if h.Config.Metrics.WorkerPrefix != nil {
+			workerPrefix = *h.Config.Metrics.WorkerPrefix
+		}
+	}
+
+	var workerCloser, serviceCloser io.Closer
+	h.WorkerMetricScope, workerCloser = tally.NewRootScope(tally.ScopeOptions{
+		Prefix:          workerPrefix,
+		Tags:            tags,
+		CachedReporter:  reporter,
+		Separator:       prometheus.DefaultSeparator,
+		SanitizeOptions: &sanitizeOptions,
+	}, interval)
+
+	// NOTE: this must be a different scope with different prefix, otherwise the metric will conflict
+	h.ServiceMetricScope, serviceCloser = tally.NewRootScope(tally.ScopeOptions{
+		Prefix:          "Service_",
+		Tags:            tags,
+		CachedReporter:  reporter,
+		Separator:       prometheus.DefaultSeparator,
+		SanitizeOptions: &sanitizeOptions,
+	}, interval)
+
+	h.metrics = &metricsServer{closers: []io.Closer{workerCloser, serviceCloser}}
+	if err := h.metrics.start(*h.Config.Prometheus, reporter, h.Logger); err != nil {
+		h.Logger.Warn("Failed to serve prometheus metrics, continuing without the scrape endpoint.", zap.Error(err))
+	}
+}
+
+// MetricsAddr returns the address the Prometheus scrape endpoint listens on, empty if it is not running
+func (h *SampleHelper) MetricsAddr() string {
+	if h.metrics == nil || h.metrics.listener == nil {
+		return ""
+	}
+	return h.metrics.listener.Addr().String()
+}
+
+// newPrometheusReporter is prometheus.Configuration.NewReporter without its unmanaged HTTP listener, so that the
+// helper can own the scrape endpoint and shut it down.
+func newPrometheusReporter(config prometheus.Configuration, registry *prom.Registry, logger *zap.Logger) prometheus.Reporter {
+	opts := prometheus.Options{
+		Registerer: registry,
+		OnRegisterError: func(err error) {
+			logger.Warn("error in prometheus reporter", zap.Error(err))
+		},
+	}
+
+	switch config.TimerType {
+	case "summary":
+		opts.DefaultTimerType = prometheus.SummaryTimerType
+	case "histogram":
+		opts.DefaultTimerType = prometheus.HistogramTimerType
+	}
+	for _, bucket := range config.DefaultHistogramBuckets {
+		opts.DefaultHistogramBuckets = append(opts.DefaultHistogramBuckets, bucket.Upper)
+	}
+	if len(config.DefaultSummaryObjectives) > 0 {
+		opts.DefaultSummaryObjectives = make(map[float64]float64, len(config.DefaultSummaryObjectives))
+		for _, objective := range config.DefaultSummaryObjectives {
+			opts.DefaultSummaryObjectives[objective.Percentile] = objective.AllowedError
+		}
+	}
+	return prometheus.NewReporter(opts)
+}
+
+func (s *metricsServer) start(config prometheus.Configuration, reporter prometheus.Reporter, logger *zap.Logger) error {
+	addr := strings.TrimSpace(config.ListenAddress)
+	if addr == "" {
+		logger.Info("No prometheus listen address configured, metrics are not served.")
+		return nil
+	}
+
+	network := config.ListenNetwork
+	if network == "" {
+		network = "tcp"
+	}
+	path := defaultMetricsPath
+	if handlerPath := strings.TrimSpace(config.HandlerPath); handlerPath != "" {
+		path = handlerPath
+	}
+
+	listener, err := net.Listen(network, addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen for metrics on %v: %w", addr, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(path, reporter.HTTPHandler())
+	s.listener = listener
+	s.server = &http.Server{Handler: mux}
+	go func() {
+		if err := s.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("Metrics server stopped.", zap.Error(err))
+		}
+	}()
+
+	logger.Info("Serving prometheus metrics.",
+		zap.String("Address", listener.Addr().String()),
+		zap.String("Path", path))
+	return nil
+}
+
+// stop flushes the metric scopes and shuts down the scrape endpoint
+func (s *metricsServer) stop() error {
+	var errs []error
+	for _, closer := range s.closers {
+		if err := closer.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if s.server != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), metricsShutdownTimeout)
+		defer cancel()
+		if err := s.server.Shutdown(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
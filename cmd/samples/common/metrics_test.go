@@ -0,0 +1,121 @@
+package common
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+	"github.com/uber-go/tally/prometheus"
+	"go.uber.org/zap/zaptest"
+)
+
+func scrape(t *testing.T, addr string) string {
+	resp, err := http.Get("http://" + addr + "/metrics")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return string(body)
+}
+
+func TestSampleHelperServesMetrics(t *testing.T) {
+	h := &SampleHelper{
+		Logger: zaptest.NewLogger(t),
+		Config: Configuration{
+			DomainName: "cadence-samples",
+			Prometheus: &prometheus.Configuration{
+				ListenAddress:           "127.0.0.1:0",
+				TimerType:               "histogram",
+				DefaultHistogramBuckets: []prometheus.HistogramObjective{{Upper: 0.5}, {Upper: 5}},
+			},
+			Metrics: &MetricsConfig{
+				Tags:           map[string]string{"env": "test"},
+				ReportInterval: 10 * time.Millisecond,
+			},
+		},
+	}
+	h.SetupMetrics()
+	addr := h.MetricsAddr()
+	require.NotEmpty(t, addr)
+
+	scope := h.WorkerMetricScope.Tagged(map[string]string{TaskListTagName: "samples-tl"})
+	scope.Counter("poll").Inc(1)
+	scope.Timer("latency").Record(time.Second)
+
+	require.Eventually(t, func() bool {
+		body := scrape(t, addr)
+		return containsAll(body,
+			`Worker__poll{domain="cadence_samples",env="test",tasklist="samples_tl"} 1`,
+			`Worker__latency_bucket{domain="cadence_samples",env="test",tasklist="samples_tl",le="5"} 1`,
+		)
+	}, 5*time.Second, 20*time.Millisecond)
+
+	require.NoError(t, h.Close())
+	_, err := http.Get("http://" + addr + "/metrics")
+	require.Error(t, err)
+}
+
+func TestSampleHelperMetricsWithoutWorkerPrefix(t *testing.T) {
+	noPrefix := ""
+	h := &SampleHelper{
+		Logger: zaptest.NewLogger(t),
+		Config: Configuration{
+			DomainName: "cadence-samples",
+			Prometheus: &prometheus.Configuration{ListenAddress: "127.0.0.1:0"},
+			Metrics:    &MetricsConfig{ReportInterval: 10 * time.Millisecond, WorkerPrefix: &noPrefix},
+		},
+	}
+	h.SetupMetrics()
+	defer h.Close()
+	addr := h.MetricsAddr()
+	require.NotEmpty(t, addr)
+
+	h.WorkerMetricScope.Counter("cadence-worker-poller-count").Inc(1)
+	h.ServiceMetricScope.Counter("cadence-worker-poller-count").Inc(2)
+	require.Eventually(t, func() bool {
+		return containsAll(scrape(t, addr),
+			// At the start of a line, without a prefix
+			"\n"+`cadence_worker_poller_count{domain="cadence_samples"} 1`,
+			`Service__cadence_worker_poller_count{domain="cadence_samples"} 2`,
+		)
+	}, 5*time.Second, 20*time.Millisecond)
+}
+
+func TestSampleHelperWithoutPrometheus(t *testing.T) {
+	h := &SampleHelper{Logger: zaptest.NewLogger(t)}
+	h.SetupMetrics()
+	require.Empty(t, h.MetricsAddr())
+	require.NoError(t, h.Close())
+}
+
+func TestSampleHelperMetricsPortInUse(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	h := &SampleHelper{
+		Logger: zaptest.NewLogger(t),
+		Config: Configuration{Prometheus: &prometheus.Configuration{ListenAddress: listener.Addr().String()}},
+	}
+	// A trigger started while a worker holds the port keeps running without the scrape endpoint
+	h.SetupMetrics()
+	require.Empty(t, h.MetricsAddr())
+	require.NotEqual(t, tally.NoopScope, h.WorkerMetricScope)
+	h.WorkerMetricScope.Counter("poll").Inc(1)
+	require.NoError(t, h.Close())
+}
+
+func containsAll(s string, subs ...string) bool {
+	for _, sub := range subs {
+		if !strings.Contains(s, sub) {
+			return false
+		}
+	}
+	return true
+}
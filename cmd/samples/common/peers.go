@@ -0,0 +1,273 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/yarpc/api/peer"
+	"go.uber.org/yarpc/api/transport"
+	yarpcpeer "go.uber.org/yarpc/peer"
+	"go.uber.org/yarpc/peer/hostport"
+	"go.uber.org/yarpc/peer/pendingheap"
+	"go.uber.org/yarpc/peer/roundrobin"
+	"go.uber.org/yarpc/transport/grpc"
+	"go.uber.org/zap"
+)
+
+const (
+	// PeerChooserRoundRobin spreads requests over the available frontends in turn
+	PeerChooserRoundRobin = "round-robin"
+	// PeerChooserLeastPending sends each request to the available frontend with the fewest requests in flight
+	PeerChooserLeastPending = "least-pending"
+
+	dnsScheme                 = "dns:///"
+	defaultDNSRefreshInterval = 30 * time.Second
+)
+
+type (
+	// peerTarget is the parsed form of Configuration.HostNameAndPort
+	peerTarget struct {
+		// hostPorts are the static frontend addresses, empty for a DNS target
+		hostPorts []string
+		// dnsHost and dnsPort are set for a dns:///host:port target
+		dnsHost string
+		dnsPort string
+	}
+
+	// lookupHostFunc resolves a host name to its addresses, it matches net.Resolver.LookupHost
+	lookupHostFunc func(ctx context.Context, host string) ([]string, error)
+
+	// dnsUpdater periodically resolves a host name and keeps a peer list in sync with the result
+	dnsUpdater struct {
+		list       peer.List
+		host       string
+		port       string
+		interval   time.Duration
+		lookupHost lookupHostFunc
+		logger     *zap.Logger
+
+		mu      sync.Mutex
+		current map[string]struct{}
+		stopCh  chan struct{}
+		doneCh  chan struct{}
+	}
+)
+
+// parsePeerTarget parses a comma separated list of host:port values or a single dns:///host:port target.
+func parsePeerTarget(target string) (peerTarget, error) {
+	target = strings.TrimSpace(target)
+	if target == "" {
+		return peerTarget{}, fmt.Errorf("HostPort is empty")
+	}
+
+	if strings.HasPrefix(target, dnsScheme) {
+		host, port, err := net.SplitHostPort(strings.TrimPrefix(target, dnsScheme))
+		if err != nil {
+			return peerTarget{}, fmt.Errorf("invalid DNS target %q: %w", target, err)
+		}
+		return peerTarget{dnsHost: host, dnsPort: port}, nil
+	}
+
+	var hostPorts []string
+	for _, hp := range strings.Split(target, ",") {
+		hp = strings.TrimSpace(hp)
+		if hp == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(hp); err != nil {
+			return peerTarget{}, fmt.Errorf("invalid host:port %q: %w", hp, err)
+		}
+		hostPorts = append(hostPorts, hp)
+	}
+	if len(hostPorts) == 0 {
+		return peerTarget{}, fmt.Errorf("HostPort is empty")
+	}
+	return peerTarget{hostPorts: hostPorts}, nil
+}
+
+// isSingle reports whether the target is a single static address that needs no peer list
+func (t peerTarget) isSingle() bool {
+	return t.dnsHost == "" && len(t.hostPorts) == 1
+}
+
+// newPeerOutbound builds a gRPC outbound that spreads requests over the target's peers with the named chooser.
+// Peers whose connection is unavailable are skipped by the chooser until they become healthy again.
+func newPeerOutbound(
+	grpcTransport *grpc.Transport,
+	target peerTarget,
+	chooser string,
+	dnsRefreshInterval time.Duration,
+	logger *zap.Logger,
+) (*grpc.Outbound, error) {
+	var list peer.ChooserList
+	switch chooser {
+	case "", PeerChooserRoundRobin:
+		list = roundrobin.New(grpcTransport, roundrobin.Logger(logger))
+	case PeerChooserLeastPending:
+		list = pendingheap.New(grpcTransport, pendingheap.Logger(logger))
+	default:
+		return nil, fmt.Errorf("unknown peer chooser %q, expected %q or %q",
+			chooser, PeerChooserRoundRobin, PeerChooserLeastPending)
+	}
+
+	var binder peer.Binder
+	if target.dnsHost != "" {
+		binder = func(list peer.List) transport.Lifecycle {
+			return newDNSUpdater(list, target.dnsHost, target.dnsPort, dnsRefreshInterval, net.DefaultResolver.LookupHost, logger)
+		}
+	} else {
+		ids := make([]peer.Identifier, 0, len(target.hostPorts))
+		for _, hp := range target.hostPorts {
+			ids = append(ids, hostport.Identify(hp))
+		}
+		binder = yarpcpeer.BindPeers(ids)
+	}
+
+	return grpcTransport.NewOutbound(yarpcpeer.Bind(list, binder)), nil
+}
+
+func newDNSUpdater(
+	list peer.List,
+	host, port string,
+	interval time.Duration,
+	lookupHost lookupHostFunc,
+	logger *zap.Logger,
+) *dnsUpdater {
+	if interval <= 0 {
+		interval = defaultDNSRefreshInterval
+	}
+	return &dnsUpdater{
+		list:       list,
+		host:       host,
+		port:       port,
+		interval:   interval,
+		lookupHost: lookupHost,
+		logger:     logger,
+		current:    make(map[string]struct{}),
+	}
+}
+
+// Start resolves the host once, failing if that does not succeed, and then keeps refreshing in the background
+func (u *dnsUpdater) Start() error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.stopCh != nil {
+		return nil
+	}
+	if err := u.refreshLocked(); err != nil {
+		return err
+	}
+
+	u.stopCh = make(chan struct{})
+	u.doneCh = make(chan struct{})
+	go u.loop(u.stopCh, u.doneCh)
+	return nil
+}
+
+// Stop stops the background refresh and removes all peers it added
+func (u *dnsUpdater) Stop() error {
+	u.mu.Lock()
+	stopCh, doneCh := u.stopCh, u.doneCh
+	u.stopCh, u.doneCh = nil, nil
+	u.mu.Unlock()
+
+	if stopCh == nil {
+		return nil
+	}
+	close(stopCh)
+	<-doneCh
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.applyLocked(nil)
+}
+
+// IsRunning reports whether the background refresh is active
+func (u *dnsUpdater) IsRunning() bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.stopCh != nil
+}
+
+func (u *dnsUpdater) loop(stopCh, doneCh chan struct{}) {
+	defer close(doneCh)
+
+	ticker := time.NewTicker(u.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			u.mu.Lock()
+			if err := u.refreshLocked(); err != nil {
+				// Keep the last known peers, a failed lookup is usually transient
+				u.logger.Warn("Failed to refresh cadence frontend peers.", zap.String("Host", u.host), zap.Error(err))
+			}
+			u.mu.Unlock()
+		}
+	}
+}
+
+func (u *dnsUpdater) refreshLocked() error {
+	ctx, cancel := context.WithTimeout(context.Background(), u.interval)
+	defer cancel()
+
+	addrs, err := u.lookupHost(ctx, u.host)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %v: %w", u.host, err)
+	}
+	if len(addrs) == 0 {
+		return fmt.Errorf("no addresses found for %v", u.host)
+	}
+
+	hostPorts := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		hostPorts = append(hostPorts, net.JoinHostPort(addr, u.port))
+	}
+	return u.applyLocked(hostPorts)
+}
+
+// applyLocked replaces the current peers with hostPorts, only sending the difference to the peer list
+func (u *dnsUpdater) applyLocked(hostPorts []string) error {
+	next := make(map[string]struct{}, len(hostPorts))
+	for _, hp := range hostPorts {
+		next[hp] = struct{}{}
+	}
+
+	var updates peer.ListUpdates
+	for hp := range next {
+		if _, ok := u.current[hp]; !ok {
+			updates.Additions = append(updates.Additions, hostport.Identify(hp))
+		}
+	}
+	for hp := range u.current {
+		if _, ok := next[hp]; !ok {
+			updates.Removals = append(updates.Removals, hostport.Identify(hp))
+		}
+	}
+	if len(updates.Additions) == 0 && len(updates.Removals) == 0 {
+		return nil
+	}
+
+	sortIdentifiers(updates.Additions)
+	sortIdentifiers(updates.Removals)
+	if err := u.list.Update(updates); err != nil {
+		return err
+	}
+	u.logger.Info("Updated cadence frontend peers.",
+		zap.String("Host", u.host),
+		zap.Strings("Peers", hostPorts))
+	u.current = next
+	return nil
+}
+
+func sortIdentifiers(ids []peer.Identifier) {
+	sort.Slice(ids, func(i, j int) bool { return ids[i].Identifier() < ids[j].Identifier() })
+}
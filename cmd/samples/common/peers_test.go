@@ -0,0 +1,247 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apiv1 "github.com/uber/cadence-idl/go/proto/api/v1"
+	"go.uber.org/yarpc"
+	"go.uber.org/yarpc/api/peer"
+	"go.uber.org/yarpc/transport/grpc"
+	"go.uber.org/zap/zaptest"
+)
+
+// fakeFrontend is an in-process stand-in for cadence-frontend that only answers DescribeDomain
+type fakeFrontend struct {
+	apiv1.DomainAPIYARPCServer
+
+	addr       string
+	calls      int32
+	dispatcher *yarpc.Dispatcher
+}
+
+func (f *fakeFrontend) DescribeDomain(ctx context.Context, req *apiv1.DescribeDomainRequest) (*apiv1.DescribeDomainResponse, error) {
+	atomic.AddInt32(&f.calls, 1)
+	return &apiv1.DescribeDomainResponse{Domain: &apiv1.Domain{Name: req.GetName()}}, nil
+}
+
+func (f *fakeFrontend) callCount() int {
+	return int(atomic.LoadInt32(&f.calls))
+}
+
+func startFakeFrontend(t *testing.T) *fakeFrontend {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	f := &fakeFrontend{addr: listener.Addr().String()}
+	f.dispatcher = yarpc.NewDispatcher(yarpc.Config{
+		Name:     _cadenceFrontendService,
+		Inbounds: yarpc.Inbounds{grpc.NewTransport().NewInbound(listener)},
+	})
+	f.dispatcher.Register(apiv1.BuildDomainAPIYARPCProcedures(f))
+	require.NoError(t, f.dispatcher.Start())
+	t.Cleanup(func() { f.dispatcher.Stop() })
+	return f
+}
+
+func describe(builder *WorkflowClientBuilder) error {
+	domainClient, err := builder.BuildCadenceDomainClient()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err = domainClient.Describe(ctx, "cadence-samples")
+	return err
+}
+
+func TestParsePeerTarget(t *testing.T) {
+	tests := []struct {
+		target  string
+		want    peerTarget
+		wantErr bool
+	}{
+		{target: "localhost:7833", want: peerTarget{hostPorts: []string{"localhost:7833"}}},
+		{target: "a:7833, b:7833,", want: peerTarget{hostPorts: []string{"a:7833", "b:7833"}}},
+		{target: "dns:///cadence-frontend:7833", want: peerTarget{dnsHost: "cadence-frontend", dnsPort: "7833"}},
+		{target: "", wantErr: true},
+		{target: " , ", wantErr: true},
+		{target: "a:7833,b", wantErr: true},
+		{target: "dns:///cadence-frontend", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			got, err := parsePeerTarget(tt.target)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestBuilderSpreadsRequestsOverFrontends(t *testing.T) {
+	for _, chooser := range []string{PeerChooserRoundRobin, PeerChooserLeastPending} {
+		t.Run(chooser, func(t *testing.T) {
+			frontends := []*fakeFrontend{startFakeFrontend(t), startFakeFrontend(t), startFakeFrontend(t)}
+			hostPorts := make([]string, 0, len(frontends))
+			for _, f := range frontends {
+				hostPorts = append(hostPorts, f.addr)
+			}
+
+			builder := NewBuilder(zaptest.NewLogger(t)).
+				SetHostPort(strings.Join(hostPorts, ",")).
+				SetPeerChooser(chooser)
+			defer builder.Close()
+
+			// Wait for every connection to come up, requests only go to available peers
+			require.Eventually(t, func() bool {
+				if err := describe(builder); err != nil {
+					return false
+				}
+				for _, f := range frontends {
+					if f.callCount() == 0 {
+						return false
+					}
+				}
+				return true
+			}, 10*time.Second, 10*time.Millisecond)
+
+			// Remove one frontend, the remaining ones must keep serving once its connection is marked unavailable
+			frontends[0].dispatcher.Stop()
+			require.Eventually(t, func() bool {
+				before := frontends[0].callCount()
+				for i := 0; i < 10; i++ {
+					if err := describe(builder); err != nil {
+						return false
+					}
+				}
+				return frontends[0].callCount() == before
+			}, 10*time.Second, 50*time.Millisecond)
+		})
+	}
+}
+
+func TestBuilderResolvesDNSTarget(t *testing.T) {
+	frontend := startFakeFrontend(t)
+	_, port, err := net.SplitHostPort(frontend.addr)
+	require.NoError(t, err)
+
+	// localhost may also resolve to ::1 where nothing listens, that peer is simply never chosen
+	builder := NewBuilder(zaptest.NewLogger(t)).SetHostPort("dns:///localhost:" + port)
+	defer builder.Close()
+
+	require.Eventually(t, func() bool {
+		return describe(builder) == nil
+	}, 10*time.Second, 10*time.Millisecond)
+	require.NotZero(t, frontend.callCount())
+}
+
+func TestBuilderRejectsUnknownPeerChooser(t *testing.T) {
+	builder := NewBuilder(zaptest.NewLogger(t)).
+		SetHostPort("127.0.0.1:7833,127.0.0.1:7834").
+		SetPeerChooser("random")
+
+	_, err := builder.BuildServiceClient()
+	require.Error(t, err)
+}
+
+// recordingList is a peer.List that records every update it receives
+type recordingList struct {
+	mu      sync.Mutex
+	updates []peer.ListUpdates
+}
+
+func (l *recordingList) Update(updates peer.ListUpdates) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.updates = append(l.updates, updates)
+	return nil
+}
+
+func (l *recordingList) last() (added, removed []string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	u := l.updates[len(l.updates)-1]
+	for _, id := range u.Additions {
+		added = append(added, id.Identifier())
+	}
+	for _, id := range u.Removals {
+		removed = append(removed, id.Identifier())
+	}
+	return added, removed
+}
+
+func (l *recordingList) count() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.updates)
+}
+
+func TestDNSUpdater(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		addrs = []string{"10.0.0.1", "10.0.0.2"}
+		fail  bool
+	)
+	lookup := func(ctx context.Context, host string) ([]string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if fail {
+			return nil, errors.New("lookup failed")
+		}
+		return append([]string(nil), addrs...), nil
+	}
+	setAddrs := func(next []string, failNext bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		addrs, fail = next, failNext
+	}
+
+	list := &recordingList{}
+	updater := newDNSUpdater(list, "cadence-frontend", "7833", 10*time.Millisecond, lookup, zaptest.NewLogger(t))
+	require.NoError(t, updater.Start())
+	require.True(t, updater.IsRunning())
+
+	added, removed := list.last()
+	assert.Equal(t, []string{"10.0.0.1:7833", "10.0.0.2:7833"}, added)
+	assert.Empty(t, removed)
+
+	// A failed lookup keeps the last known peers
+	setAddrs(nil, true)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, 1, list.count())
+
+	setAddrs([]string{"10.0.0.2", "10.0.0.3"}, false)
+	require.Eventually(t, func() bool { return list.count() == 2 }, time.Second, 5*time.Millisecond)
+	added, removed = list.last()
+	assert.Equal(t, []string{"10.0.0.3:7833"}, added)
+	assert.Equal(t, []string{"10.0.0.1:7833"}, removed)
+
+	require.NoError(t, updater.Stop())
+	require.False(t, updater.IsRunning())
+	added, removed = list.last()
+	assert.Empty(t, added)
+	assert.Equal(t, []string{"10.0.0.2:7833", "10.0.0.3:7833"}, removed)
+}
+
+func TestDNSUpdaterFailsToStartWithoutAddresses(t *testing.T) {
+	lookup := func(ctx context.Context, host string) ([]string, error) {
+		return nil, fmt.Errorf("no such host %v", host)
+	}
+	updater := newDNSUpdater(&recordingList{}, "cadence-frontend", "7833", time.Second, lookup, zaptest.NewLogger(t))
+	require.Error(t, updater.Start())
+	require.False(t, updater.IsRunning())
+}
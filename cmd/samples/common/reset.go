@@ -0,0 +1,164 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pborman/uuid"
+	"go.uber.org/cadence/.gen/go/shared"
+	"go.uber.org/cadence/client"
+)
+
+// ErrNoResetPoint is returned when the history has no decision to reset to
+var ErrNoResetPoint = errors.New("no completed decision to reset to")
+
+// ResetPoint selects the completed decision a workflow is reset to. The selected decision and the events after it
+// are discarded and the workflow makes that decision again, e.g. with fixed code. The zero value selects the last
+// completed decision. Only one of the fields is used, in the order they are listed.
+type ResetPoint struct {
+	// EventID selects the DecisionTaskCompleted event with this ID
+	EventID int64 `json:",omitempty"`
+	// BinaryChecksum selects the first decision completed by the worker binary with this checksum, e.g. a bad deploy
+	BinaryChecksum string `json:",omitempty"`
+	// After selects the first decision completed at or after this time
+	After time.Time
+	// EventType selects the last decision completed before the first event of this type, e.g. ActivityTaskFailed
+	EventType string `json:",omitempty"`
+}
+
+// String describes the reset point for logs and reports
+func (p ResetPoint) String() string {
+	switch {
+	case p.EventID > 0:
+		return fmt.Sprintf("decision %d", p.EventID)
+	case p.BinaryChecksum != "":
+		return "first decision of binary " + p.BinaryChecksum
+	case !p.After.IsZero():
+		return "first decision after " + p.After.Format(time.RFC3339)
+	case p.EventType != "":
+		return "last decision before " + p.EventType
+	default:
+		return "last decision"
+	}
+}
+
+// FindResetEventID returns the ID of the DecisionTaskCompleted event the reset point selects in the history
+func FindResetEventID(events []*shared.HistoryEvent, point ResetPoint) (int64, error) {
+	if point.EventID > 0 {
+		for _, event := range events {
+			if event.GetEventId() == point.EventID {
+				if event.GetEventType() != shared.EventTypeDecisionTaskCompleted {
+					return 0, fmt.Errorf("event %d is %v, not a completed decision", point.EventID, event.GetEventType())
+				}
+				return point.EventID, nil
+			}
+		}
+		return 0, fmt.Errorf("event %d is not in the history", point.EventID)
+	}
+
+	if point.BinaryChecksum != "" || !point.After.IsZero() {
+		after := point.After.UnixNano()
+		for _, event := range events {
+			if event.GetEventType() != shared.EventTypeDecisionTaskCompleted {
+				continue
+			}
+			if point.BinaryChecksum != "" {
+				if event.DecisionTaskCompletedEventAttributes.GetBinaryChecksum() == point.BinaryChecksum {
+					return event.GetEventId(), nil
+				}
+			} else if event.GetTimestamp() >= after {
+				return event.GetEventId(), nil
+			}
+		}
+		return 0, fmt.Errorf("%w: %v", ErrNoResetPoint, point)
+	}
+
+	var eventType *shared.EventType
+	if point.EventType != "" {
+		var t shared.EventType
+		if err := t.UnmarshalText([]byte(point.EventType)); err != nil {
+			return 0, fmt.Errorf("unknown event type %q: %w", point.EventType, err)
+		}
+		eventType = &t
+	}
+
+	var decisionID int64
+	for _, event := range events {
+		if eventType != nil && event.GetEventType() == *eventType {
+			if decisionID == 0 {
+				return 0, fmt.Errorf("%w: %v", ErrNoResetPoint, point)
+			}
+			return decisionID, nil
+		}
+		if event.GetEventType() == shared.EventTypeDecisionTaskCompleted {
+			decisionID = event.GetEventId()
+		}
+	}
+	if eventType != nil {
+		return 0, fmt.Errorf("history has no %v event", point.EventType)
+	}
+	if decisionID == 0 {
+		return 0, fmt.Errorf("%w: %v", ErrNoResetPoint, point)
+	}
+	return decisionID, nil
+}
+
+// ResolveResetPoint returns the run and the DecisionTaskCompleted event ID the reset point selects, an empty runID
+// selects the current run. ResetWorkflow uses it, dry runs can report what a reset would do.
+func ResolveResetPoint(ctx context.Context, c client.Client, workflowID, runID string, point ResetPoint) (string, int64, error) {
+	if runID == "" {
+		// pin the reset to the run whose history selects the event
+		resp, err := c.DescribeWorkflowExecution(ctx, workflowID, "")
+		if err != nil {
+			return "", 0, fmt.Errorf("failed to describe workflow %v: %w", workflowID, err)
+		}
+		runID = resp.GetWorkflowExecutionInfo().GetExecution().GetRunId()
+	}
+	events, err := FetchHistory(ctx, c, workflowID, runID)
+	if err != nil {
+		return "", 0, err
+	}
+	eventID, err := FindResetEventID(events, point)
+	if err != nil {
+		return "", 0, fmt.Errorf("workflow %v: %w", workflowID, err)
+	}
+	return runID, eventID, nil
+}
+
+// ResetWorkflow resets the given run to the reset point and returns the run ID of the new run. Signals received
+// after the reset point are applied to the new run again. Resetting the same run to the same event again, e.g. from
+// a retried activity, returns the run of the first reset instead of resetting it twice.
+func ResetWorkflow(
+	ctx context.Context,
+	c client.Client,
+	domain, workflowID, runID, reason string,
+	point ResetPoint,
+) (string, error) {
+	runID, eventID, err := ResolveResetPoint(ctx, c, workflowID, runID, point)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := c.ResetWorkflow(ctx, &shared.ResetWorkflowExecutionRequest{
+		Domain: StringPtr(domain),
+		WorkflowExecution: &shared.WorkflowExecution{
+			WorkflowId: StringPtr(workflowID),
+			RunId:      StringPtr(runID),
+		},
+		Reason:                StringPtr(reason),
+		DecisionFinishEventId: Int64Ptr(eventID),
+		RequestId:             StringPtr(resetRequestID(workflowID, runID, eventID)),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to reset workflow %v to event %d: %w", workflowID, eventID, err)
+	}
+	return resp.GetRunId(), nil
+}
+
+// resetRequestID derives the request ID of a reset from the run and the event it is reset to, the server
+// deduplicates resets with the same request ID
+func resetRequestID(workflowID, runID string, eventID int64) string {
+	return uuid.NewSHA1(uuid.NameSpace_OID, []byte(fmt.Sprintf("%v/%v/%d", workflowID, runID, eventID))).String()
+}
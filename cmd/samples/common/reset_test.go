@@ -0,0 +1,89 @@
+package common
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/cadence/.gen/go/shared"
+)
+
+func TestFindResetEventID(t *testing.T) {
+	event := func(id int64, eventType shared.EventType) *shared.HistoryEvent {
+		return &shared.HistoryEvent{EventId: Int64Ptr(id), EventType: &eventType}
+	}
+	events := []*shared.HistoryEvent{
+		event(1, shared.EventTypeWorkflowExecutionStarted),
+		event(2, shared.EventTypeDecisionTaskScheduled),
+		event(3, shared.EventTypeDecisionTaskStarted),
+		event(4, shared.EventTypeDecisionTaskCompleted),
+		event(5, shared.EventTypeActivityTaskScheduled),
+		event(6, shared.EventTypeActivityTaskStarted),
+		event(7, shared.EventTypeActivityTaskFailed),
+		event(8, shared.EventTypeDecisionTaskScheduled),
+		event(9, shared.EventTypeDecisionTaskStarted),
+		event(10, shared.EventTypeDecisionTaskCompleted),
+	}
+
+	id, err := FindResetEventID(events, ResetPoint{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), id)
+
+	id, err = FindResetEventID(events, ResetPoint{EventType: "ActivityTaskFailed"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), id)
+
+	id, err = FindResetEventID(events, ResetPoint{EventID: 4})
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), id)
+
+	_, err = FindResetEventID(events, ResetPoint{EventID: 5})
+	assert.ErrorContains(t, err, "event 5 is ActivityTaskScheduled, not a completed decision")
+	_, err = FindResetEventID(events, ResetPoint{EventType: "TimerFired"})
+	assert.ErrorContains(t, err, "history has no TimerFired event")
+	_, err = FindResetEventID(events, ResetPoint{EventType: "NotAnEvent"})
+	assert.ErrorContains(t, err, `unknown event type "NotAnEvent"`)
+	_, err = FindResetEventID(events[:3], ResetPoint{})
+	assert.ErrorIs(t, err, ErrNoResetPoint)
+}
+
+func TestFindResetEventIDByBinaryChecksumAndTime(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	decision := func(id int64, minutes int, checksum string) *shared.HistoryEvent {
+		return &shared.HistoryEvent{
+			EventId:   Int64Ptr(id),
+			Timestamp: Int64Ptr(start.Add(time.Duration(minutes) * time.Minute).UnixNano()),
+			EventType: shared.EventTypeDecisionTaskCompleted.Ptr(),
+			DecisionTaskCompletedEventAttributes: &shared.DecisionTaskCompletedEventAttributes{
+				BinaryChecksum: StringPtr(checksum),
+			},
+		}
+	}
+	events := []*shared.HistoryEvent{
+		decision(4, 0, "good"),
+		decision(10, 5, "good"),
+		decision(16, 10, "bad"),
+		decision(22, 15, "bad"),
+	}
+
+	id, err := FindResetEventID(events, ResetPoint{BinaryChecksum: "bad"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(16), id)
+
+	id, err = FindResetEventID(events, ResetPoint{After: start.Add(3 * time.Minute)})
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), id)
+
+	_, err = FindResetEventID(events, ResetPoint{BinaryChecksum: "unknown"})
+	assert.ErrorIs(t, err, ErrNoResetPoint)
+	_, err = FindResetEventID(events, ResetPoint{After: start.Add(time.Hour)})
+	assert.ErrorIs(t, err, ErrNoResetPoint)
+}
+
+func TestResetRequestID(t *testing.T) {
+	id := resetRequestID("trip-1", "run-1", 4)
+	assert.Equal(t, id, resetRequestID("trip-1", "run-1", 4))
+	assert.NotEqual(t, id, resetRequestID("trip-1", "run-2", 4))
+	assert.NotEqual(t, id, resetRequestID("trip-1", "run-1", 10))
+}
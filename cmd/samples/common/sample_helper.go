@@ -2,14 +2,14 @@ package common
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"io/ioutil"
+	"sync/atomic"
 	"time"
 
 	"github.com/opentracing/opentracing-go"
 	"go.uber.org/cadence/.gen/go/shared"
 
-	prom "github.com/m3db/prometheus_client_golang/prometheus"
 	"github.com/uber-go/tally"
 	"github.com/uber-go/tally/prometheus"
 	"go.uber.org/cadence/.gen/go/cadence/workflowserviceclient"
@@ -19,13 +19,15 @@ import (
 	"go.uber.org/cadence/worker"
 	"go.uber.org/cadence/workflow"
 	"go.uber.org/zap"
-	"gopkg.in/yaml.v2"
 )
 
 const (
 	defaultConfigFile = "config/development.yaml"
 )
 
+// errQueryFailed marks query errors that the panicking ConsistentQueryWorkflow wrapper treats as fatal
+var errQueryFailed = errors.New("failed to query workflow")
+
 type (
 	// SampleHelper class for workflow sample helper.
 	SampleHelper struct {
@@ -34,6 +36,7 @@ type (
 		ServiceMetricScope tally.Scope
 		Logger             *zap.Logger
 		Config             Configuration
+		ConfigReport       *ConfigReport
 		Builder            *WorkflowClientBuilder
 		DataConverter      encoded.DataConverter
 		CtxPropagators     []workflow.ContextPropagator
@@ -41,15 +44,30 @@ type (
 		activityRegistries []registryOption
 		Tracer             opentracing.Tracer
 
-		configFile string
+		configFile   string
+		metrics      *metricsServer
+		health       atomic.Value // *healthServer
+		workerGroups []*WorkerGroup
 	}
 
 	// Configuration for running samples.
 	Configuration struct {
-		DomainName      string                    `yaml:"domain"`
-		ServiceName     string                    `yaml:"service"`
-		HostNameAndPort string                    `yaml:"host"`
-		Prometheus      *prometheus.Configuration `yaml:"prometheus"`
+		DomainName  string `yaml:"domain"`
+		ServiceName string `yaml:"service"`
+		// HostNameAndPort is a single host:port, a comma separated list of host:port values or a dns:///host:port target
+		HostNameAndPort string `yaml:"host"`
+		// PeerChooser selects how requests are spread over several frontends, round-robin (default) or least-pending
+		PeerChooser string `yaml:"peerChooser"`
+		// DNSRefreshInterval controls how often a dns:/// target is resolved again
+		DNSRefreshInterval time.Duration             `yaml:"dnsRefreshInterval"`
+		Prometheus         *prometheus.Configuration `yaml:"prometheus"`
+		// AutoRegisterDomain registers the domain on startup when it does not exist yet
+		AutoRegisterDomain *DomainRegistrationConfig `yaml:"autoRegisterDomain"`
+		Logging            *LoggingConfig            `yaml:"logging"`
+		Metrics            *MetricsConfig            `yaml:"metrics"`
+		Lifecycle          *LifecycleConfig          `yaml:"lifecycle"`
+		// WorkerGroups overrides the task list and worker options of the named worker groups
+		WorkerGroups map[string]*WorkerGroupConfig `yaml:"workerGroups"`
 	}
 
 	registryOption struct {
@@ -78,7 +96,7 @@ var (
 	}
 )
 
-// SetConfigFile sets the config file path
+// SetConfigFile sets the config file path, overriding the default config/development.yaml lookup
 func (h *SampleHelper) SetConfigFile(configFile string) {
 	h.configFile = configFile
 }
@@ -89,62 +107,28 @@ func (h *SampleHelper) SetupServiceConfig() {
 		return
 	}
 
-	if h.configFile == "" {
-		h.configFile = defaultConfigFile
-	}
-	// Initialize developer config for running samples
-	configData, err := ioutil.ReadFile(h.configFile)
+	config, report, err := ConfigLoader{File: h.configFile}.Load()
 	if err != nil {
-		panic(fmt.Sprintf("Failed to log config file: %v, Error: %v", defaultConfigFile, err))
-	}
-
-	if err := yaml.Unmarshal(configData, &h.Config); err != nil {
 		panic(fmt.Sprintf("Error initializing configuration: %v", err))
 	}
+	h.Config = config
+	h.ConfigReport = report
 
 	// Initialize logger for running samples
-	logger, err := zap.NewDevelopment()
+	logger, err := NewLogger(h.Config.Logging)
 	if err != nil {
 		panic(err)
 	}
 
 	logger.Info("Logger created.")
+	logger.Info("Configuration loaded.", zap.String("File", report.File), zap.Any("Sources", report.Sources))
 	h.Logger = logger
-	h.ServiceMetricScope = tally.NoopScope
-	h.WorkerMetricScope = tally.NoopScope
-
-	if h.Config.Prometheus != nil {
-		reporter, err := h.Config.Prometheus.NewReporter(
-			prometheus.ConfigurationOptions{
-				Registry: prom.NewRegistry(),
-				OnError: func(err error) {
-					logger.Warn("error in prometheus reporter", zap.Error(err))
-				},
-			},
-		)
-		if err != nil {
-			panic(err)
-		}
+	h.SetupMetrics()
 
-		h.WorkerMetricScope, _ = tally.NewRootScope(tally.ScopeOptions{
-			Prefix:          "Worker_",
-			Tags:            map[string]string{},
-			CachedReporter:  reporter,
-			Separator:       prometheus.DefaultSeparator,
-			SanitizeOptions: &sanitizeOptions,
-		}, 1*time.Second)
-
-		// NOTE: this must be a different scope with different prefix, otherwise the metric will conflict
-		h.ServiceMetricScope, _ = tally.NewRootScope(tally.ScopeOptions{
-			Prefix:          "Service_",
-			Tags:            map[string]string{},
-			CachedReporter:  reporter,
-			Separator:       prometheus.DefaultSeparator,
-			SanitizeOptions: &sanitizeOptions,
-		}, 1*time.Second)
-	}
 	h.Builder = NewBuilder(logger).
 		SetHostPort(h.Config.HostNameAndPort).
+		SetPeerChooser(h.Config.PeerChooser).
+		SetDNSRefreshInterval(h.Config.DNSRefreshInterval).
 		SetDomain(h.Config.DomainName).
 		SetMetricsScope(h.ServiceMetricScope).
 		SetDataConverter(h.DataConverter).
@@ -156,12 +140,17 @@ func (h *SampleHelper) SetupServiceConfig() {
 	}
 	h.Service = service
 
-	domainClient, _ := h.Builder.BuildCadenceDomainClient()
-	_, err = domainClient.Describe(context.Background(), h.Config.DomainName)
+	domainClient, err := h.Builder.BuildCadenceDomainClient()
+	if err != nil {
+		panic(err)
+	}
+	workflowClient, err := h.Builder.BuildCadenceClient()
 	if err != nil {
-		logger.Fatal("Domain doesn't exist", zap.String("Domain", h.Config.DomainName), zap.Error(err))
-	} else {
-		logger.Info("Domain successfully registered.", zap.String("Domain", h.Config.DomainName))
+		panic(err)
+	}
+	err = EnsureDomain(context.Background(), domainClient, workflowClient, h.Config.DomainName, h.Config.AutoRegisterDomain, logger)
+	if err != nil {
+		logger.Fatal("Failed to set up domain.", zap.String("Domain", h.Config.DomainName), zap.Error(err))
 	}
 
 	h.workflowRegistries = make([]registryOption, 0, 1)
@@ -184,40 +173,59 @@ func (h *SampleHelper) StartWorkflowWithCtx(
 	workflow interface{},
 	args ...interface{},
 ) *workflow.Execution {
+	we, err := h.TryStartWorkflow(ctx, options, workflow, args...)
+	if err != nil {
+		h.Logger.Error("Failed to create workflow", zap.Error(err))
+		panic("Failed to create workflow.")
+	}
+	return we
+}
+
+// TryStartWorkflow starts a workflow with the provided context and returns an error instead of panicking
+func (h *SampleHelper) TryStartWorkflow(
+	ctx context.Context,
+	options client.StartWorkflowOptions,
+	workflow interface{},
+	args ...interface{},
+) (*workflow.Execution, error) {
 	workflowClient, err := h.Builder.BuildCadenceClient()
 	if err != nil {
-		h.Logger.Error("Failed to build cadence client.", zap.Error(err))
-		panic(err)
+		return nil, fmt.Errorf("failed to build cadence client: %w", err)
 	}
 
 	we, err := workflowClient.StartWorkflow(ctx, options, workflow, args...)
 	if err != nil {
-		h.Logger.Error("Failed to create workflow", zap.Error(err))
-		panic("Failed to create workflow.")
-	} else {
-		h.Logger.Info("Started Workflow", zap.String("WorkflowID", we.ID), zap.String("RunID", we.RunID))
-		return we
+		return nil, fmt.Errorf("failed to start workflow: %w", err)
 	}
+	h.Logger.Info("Started Workflow", zap.String("WorkflowID", we.ID), zap.String("RunID", we.RunID))
+	return we, nil
 }
 
 // SignalWithStartWorkflowWithCtx signals workflow and starts it if it's not yet started
 func (h *SampleHelper) SignalWithStartWorkflowWithCtx(ctx context.Context, workflowID string, signalName string, signalArg interface{},
 	options client.StartWorkflowOptions, workflow interface{}, workflowArgs ...interface{}) *workflow.Execution {
+	we, err := h.TrySignalWithStartWorkflow(ctx, workflowID, signalName, signalArg, options, workflow, workflowArgs...)
+	if err != nil {
+		h.Logger.Error("Failed to signal with start workflow", zap.Error(err))
+		panic("Failed to signal with start workflow.")
+	}
+	return we
+}
+
+// TrySignalWithStartWorkflow signals workflow and starts it if it's not yet started, returning an error instead of panicking
+func (h *SampleHelper) TrySignalWithStartWorkflow(ctx context.Context, workflowID string, signalName string, signalArg interface{},
+	options client.StartWorkflowOptions, workflow interface{}, workflowArgs ...interface{}) (*workflow.Execution, error) {
 	workflowClient, err := h.Builder.BuildCadenceClient()
 	if err != nil {
-		h.Logger.Error("Failed to build cadence client.", zap.Error(err))
-		panic(err)
+		return nil, fmt.Errorf("failed to build cadence client: %w", err)
 	}
 
 	we, err := workflowClient.SignalWithStartWorkflow(ctx, workflowID, signalName, signalArg, options, workflow, workflowArgs...)
 	if err != nil {
-		h.Logger.Error("Failed to signal with start workflow", zap.Error(err))
-		panic("Failed to signal with start workflow.")
-
-	} else {
-		h.Logger.Info("Signaled and started Workflow", zap.String("WorkflowID", we.ID), zap.String("RunID", we.RunID))
+		return nil, fmt.Errorf("failed to signal with start workflow: %w", err)
 	}
-	return we
+	h.Logger.Info("Signaled and started Workflow", zap.String("WorkflowID", we.ID), zap.String("RunID", we.RunID))
+	return we, nil
 }
 
 func (h *SampleHelper) RegisterWorkflow(workflow interface{}) {
@@ -244,28 +252,45 @@ func (h *SampleHelper) RegisterActivityWithAlias(activity interface{}, alias str
 	h.activityRegistries = append(h.activityRegistries, registryOption)
 }
 
-// StartWorkers starts workflow worker and activity worker based on configured options.
+// StartWorkers starts workflow worker and activity worker based on configured options. Workers without a logger in
+// their options use the helper's logger, and metrics reported through WorkerMetricScope are tagged with the task list.
 func (h *SampleHelper) StartWorkers(domainName string, groupName string, options worker.Options) worker.Worker {
-	worker := worker.New(h.Service, domainName, groupName, options)
-	h.registerWorkflowAndActivity(worker)
-
-	err := worker.Start()
+	worker, err := h.TryStartWorkers(domainName, groupName, options)
 	if err != nil {
 		h.Logger.Error("Failed to start workers.", zap.Error(err))
 		panic("Failed to start workers")
 	}
-
 	return worker
 }
 
-func (h *SampleHelper) QueryWorkflow(workflowID, runID, queryType string, args ...interface{}) {
-	workflowClient, err := h.Builder.BuildCadenceClient()
-	if err != nil {
-		h.Logger.Error("Failed to build cadence client.", zap.Error(err))
-		panic(err)
+// TryStartWorkers starts workflow worker and activity worker based on configured options and returns an error
+// instead of panicking.
+func (h *SampleHelper) TryStartWorkers(domainName string, groupName string, options worker.Options) (worker.Worker, error) {
+	return h.startWorker(domainName, groupName, options, h.workflowRegistries, h.activityRegistries)
+}
+
+func (h *SampleHelper) startWorker(
+	domainName, taskList string,
+	options worker.Options,
+	workflows, activities []registryOption,
+) (worker.Worker, error) {
+	if options.Logger == nil {
+		options.Logger = h.Logger
+	}
+	if options.MetricsScope != nil && options.MetricsScope == h.WorkerMetricScope {
+		options.MetricsScope = options.MetricsScope.Tagged(map[string]string{TaskListTagName: taskList})
 	}
+	worker := newWorker(h.Service, domainName, taskList, options)
+	registerWorkflowAndActivity(worker, workflows, activities)
 
-	resp, err := workflowClient.QueryWorkflow(context.Background(), workflowID, runID, queryType, args...)
+	if err := worker.Start(); err != nil {
+		return nil, fmt.Errorf("%w: %w", errStartWorkers, err)
+	}
+	return worker, nil
+}
+
+func (h *SampleHelper) QueryWorkflow(workflowID, runID, queryType string, args ...interface{}) {
+	resp, err := h.TryQueryWorkflow(context.Background(), workflowID, runID, queryType, args...)
 	if err != nil {
 		h.Logger.Error("Failed to query workflow", zap.Error(err))
 		panic("Failed to query workflow.")
@@ -277,18 +302,55 @@ func (h *SampleHelper) QueryWorkflow(workflowID, runID, queryType string, args .
 	h.Logger.Info("Received query result", zap.Any("Result", result))
 }
 
+// TryQueryWorkflow queries a workflow and returns the encoded query result, leaving decoding to the caller
+func (h *SampleHelper) TryQueryWorkflow(
+	ctx context.Context,
+	workflowID, runID, queryType string,
+	args ...interface{},
+) (encoded.Value, error) {
+	workflowClient, err := h.Builder.BuildCadenceClient()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build cadence client: %w", err)
+	}
+
+	resp, err := workflowClient.QueryWorkflow(ctx, workflowID, runID, queryType, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query workflow: %w", err)
+	}
+	return resp, nil
+}
+
 func (h *SampleHelper) ConsistentQueryWorkflow(
 	valuePtr interface{},
 	workflowID, runID, queryType string,
 	args ...interface{},
+) error {
+	err := h.TryConsistentQueryWorkflow(context.Background(), valuePtr, workflowID, runID, queryType, args...)
+	if errors.Is(err, errQueryFailed) {
+		h.Logger.Error("Failed to query workflow", zap.Error(err))
+		panic("Failed to query workflow.")
+	}
+	if err != nil {
+		h.Logger.Error("Failed to decode query result", zap.Error(err))
+		return err
+	}
+	h.Logger.Info("Received consistent query result.", zap.Any("Result", valuePtr))
+	return nil
+}
+
+// TryConsistentQueryWorkflow queries a workflow with strong consistency and decodes the result into valuePtr
+func (h *SampleHelper) TryConsistentQueryWorkflow(
+	ctx context.Context,
+	valuePtr interface{},
+	workflowID, runID, queryType string,
+	args ...interface{},
 ) error {
 	workflowClient, err := h.Builder.BuildCadenceClient()
 	if err != nil {
-		h.Logger.Error("Failed to build cadence client.", zap.Error(err))
-		panic(err)
+		return fmt.Errorf("%w: failed to build cadence client: %w", errQueryFailed, err)
 	}
 
-	resp, err := workflowClient.QueryWorkflowWithOptions(context.Background(),
+	resp, err := workflowClient.QueryWorkflowWithOptions(ctx,
 		&client.QueryWorkflowWithOptionsRequest{
 			WorkflowID:            workflowID,
 			RunID:                 runID,
@@ -297,53 +359,86 @@ func (h *SampleHelper) ConsistentQueryWorkflow(
 			Args:                  args,
 		})
 	if err != nil {
-		h.Logger.Error("Failed to query workflow", zap.Error(err))
-		panic("Failed to query workflow.")
+		return fmt.Errorf("%w: %w", errQueryFailed, err)
 	}
 	if err := resp.QueryResult.Get(&valuePtr); err != nil {
-		h.Logger.Error("Failed to decode query result", zap.Error(err))
+		return fmt.Errorf("failed to decode query result: %w", err)
 	}
-	h.Logger.Info("Received consistent query result.", zap.Any("Result", valuePtr))
-	return err
+	return nil
 }
 
 func (h *SampleHelper) SignalWorkflow(workflowID, signal string, data interface{}) {
-	workflowClient, err := h.Builder.BuildCadenceClient()
-	if err != nil {
-		h.Logger.Error("Failed to build cadence client.", zap.Error(err))
-		panic(err)
-	}
-
-	err = workflowClient.SignalWorkflow(context.Background(), workflowID, "", signal, data)
+	err := h.TrySignalWorkflow(context.Background(), workflowID, "", signal, data)
 	if err != nil {
 		h.Logger.Error("Failed to signal workflow", zap.Error(err))
 		panic("Failed to signal workflow.")
 	}
 }
 
-func (h *SampleHelper) CancelWorkflow(workflowID string) {
+// TrySignalWorkflow signals the given run of a workflow, an empty runID targets the current run
+func (h *SampleHelper) TrySignalWorkflow(ctx context.Context, workflowID, runID, signal string, data interface{}) error {
 	workflowClient, err := h.Builder.BuildCadenceClient()
 	if err != nil {
-		h.Logger.Error("Failed to build cadence client.", zap.Error(err))
-		panic(err)
+		return fmt.Errorf("failed to build cadence client: %w", err)
 	}
 
-	err = workflowClient.CancelWorkflow(context.Background(), workflowID, "")
+	if err := workflowClient.SignalWorkflow(ctx, workflowID, runID, signal, data); err != nil {
+		return fmt.Errorf("failed to signal workflow: %w", err)
+	}
+	return nil
+}
+
+func (h *SampleHelper) CancelWorkflow(workflowID string) {
+	err := h.TryCancelWorkflow(context.Background(), workflowID, "")
 	if err != nil {
 		h.Logger.Error("Failed to cancel workflow", zap.Error(err))
 		panic("Failed to cancel workflow.")
 	}
 }
 
-func (h *SampleHelper) registerWorkflowAndActivity(worker worker.Worker) {
-	for _, w := range h.workflowRegistries {
+// TryCancelWorkflow requests cancellation of the given run of a workflow, an empty runID targets the current run
+func (h *SampleHelper) TryCancelWorkflow(ctx context.Context, workflowID, runID string) error {
+	workflowClient, err := h.Builder.BuildCadenceClient()
+	if err != nil {
+		return fmt.Errorf("failed to build cadence client: %w", err)
+	}
+
+	if err := workflowClient.CancelWorkflow(ctx, workflowID, runID); err != nil {
+		return fmt.Errorf("failed to cancel workflow: %w", err)
+	}
+	return nil
+}
+
+// Close releases the cadence clients cached by the helper, stops the RPC dispatcher they share and shuts down the
+// metrics endpoint
+func (h *SampleHelper) Close() error {
+	var errs []error
+	if h.Builder != nil {
+		errs = append(errs, h.Builder.Close())
+	}
+	errs = append(errs, h.closeMetrics())
+	return errors.Join(errs...)
+}
+
+// closeMetrics flushes the metric scopes and shuts down the metrics endpoint, later calls are no-ops
+func (h *SampleHelper) closeMetrics() error {
+	if h.metrics == nil {
+		return nil
+	}
+	err := h.metrics.stop()
+	h.metrics = nil
+	return err
+}
+
+func registerWorkflowAndActivity(worker worker.Worker, workflows, activities []registryOption) {
+	for _, w := range workflows {
 		if len(w.alias) == 0 {
 			worker.RegisterWorkflow(w.registry)
 		} else {
 			worker.RegisterWorkflowWithOptions(w.registry, workflow.RegisterOptions{Name: w.alias})
 		}
 	}
-	for _, act := range h.activityRegistries {
+	for _, act := range activities {
 		if len(act.alias) == 0 {
 			worker.RegisterActivity(act.registry)
 		} else {
@@ -0,0 +1,122 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/cadence/client"
+	"go.uber.org/cadence/encoded"
+	"go.uber.org/cadence/workflow"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// fakeFailingClient fails every call made by the SampleHelper client operations with err
+type fakeFailingClient struct {
+	client.Client
+
+	err         error
+	queryResult encoded.Value
+}
+
+func (c *fakeFailingClient) StartWorkflow(ctx context.Context, options client.StartWorkflowOptions, wf interface{}, args ...interface{}) (*workflow.Execution, error) {
+	return nil, c.err
+}
+
+func (c *fakeFailingClient) SignalWithStartWorkflow(ctx context.Context, workflowID, signalName string, signalArg interface{},
+	options client.StartWorkflowOptions, wf interface{}, workflowArgs ...interface{}) (*workflow.Execution, error) {
+	return nil, c.err
+}
+
+func (c *fakeFailingClient) QueryWorkflow(ctx context.Context, workflowID, runID, queryType string, args ...interface{}) (encoded.Value, error) {
+	return nil, c.err
+}
+
+func (c *fakeFailingClient) QueryWorkflowWithOptions(ctx context.Context, request *client.QueryWorkflowWithOptionsRequest) (*client.QueryWorkflowWithOptionsResponse, error) {
+	if c.queryResult != nil {
+		return &client.QueryWorkflowWithOptionsResponse{QueryResult: c.queryResult}, nil
+	}
+	return nil, c.err
+}
+
+func (c *fakeFailingClient) SignalWorkflow(ctx context.Context, workflowID, runID, signalName string, arg interface{}) error {
+	return c.err
+}
+
+func (c *fakeFailingClient) CancelWorkflow(ctx context.Context, workflowID, runID string, opts ...client.CancelOption) error {
+	return c.err
+}
+
+// tryOperations calls every Try variant of the helper and returns their errors by name
+func tryOperations(h *SampleHelper) map[string]error {
+	ctx := context.Background()
+	var result int
+	_, startErr := h.TryStartWorkflow(ctx, client.StartWorkflowOptions{ID: "wf-1"}, "greeter")
+	_, signalWithStartErr := h.TrySignalWithStartWorkflow(ctx, "wf-1", "greet", "hi", client.StartWorkflowOptions{}, "greeter")
+	_, queryErr := h.TryQueryWorkflow(ctx, "wf-1", "", "state")
+	return map[string]error{
+		"start":             startErr,
+		"signal with start": signalWithStartErr,
+		"query":             queryErr,
+		"consistent query":  h.TryConsistentQueryWorkflow(ctx, &result, "wf-1", "", "state"),
+		"signal":            h.TrySignalWorkflow(ctx, "wf-1", "", "greet", "hi"),
+		"cancel":            h.TryCancelWorkflow(ctx, "wf-1", ""),
+	}
+}
+
+func TestTryOperationsReturnClientErrors(t *testing.T) {
+	clientErr := errors.New("frontend unavailable")
+	h := &SampleHelper{
+		Logger:  zaptest.NewLogger(t),
+		Builder: &WorkflowClientBuilder{client: &fakeFailingClient{err: clientErr}},
+	}
+
+	for name, err := range tryOperations(h) {
+		assert.ErrorIs(t, err, clientErr, name)
+	}
+}
+
+func TestTryOperationsReturnBuildErrors(t *testing.T) {
+	// Without a host the builder cannot create a client
+	h := &SampleHelper{
+		Logger:  zaptest.NewLogger(t),
+		Builder: NewBuilder(zaptest.NewLogger(t)),
+	}
+
+	for name, err := range tryOperations(h) {
+		require.Error(t, err, name)
+		assert.Contains(t, err.Error(), "failed to build cadence client", name)
+	}
+}
+
+func TestConsistentQueryWorkflow(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	workflowClient := &fakeFailingClient{err: errors.New("frontend unavailable")}
+	h := &SampleHelper{
+		Logger:  zap.New(core),
+		Builder: &WorkflowClientBuilder{client: workflowClient},
+	}
+	var result int
+
+	workflowClient.queryResult = &fakeValue{value: 3}
+	require.NoError(t, h.ConsistentQueryWorkflow(&result, "wf-1", "", "state"))
+	assert.Equal(t, 3, result)
+	assert.Equal(t, 1, logs.FilterMessage("Received consistent query result.").Len())
+
+	// A result that does not decode is returned and not reported as received
+	logs.TakeAll()
+	workflowClient.queryResult = &fakeValue{value: "three"}
+	require.Error(t, h.ConsistentQueryWorkflow(&result, "wf-1", "", "state"))
+	assert.Equal(t, 0, logs.FilterMessage("Received consistent query result.").Len())
+	assert.Equal(t, 1, logs.FilterMessage("Failed to decode query result").Len())
+
+	// A failed query is fatal
+	workflowClient.queryResult = nil
+	assert.PanicsWithValue(t, "Failed to query workflow.", func() {
+		_ = h.ConsistentQueryWorkflow(&result, "wf-1", "", "state")
+	})
+}
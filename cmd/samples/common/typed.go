@@ -0,0 +1,279 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+
+	"go.uber.org/cadence/client"
+	"go.uber.org/cadence/workflow"
+)
+
+var (
+	workflowContextType = reflect.TypeOf((*workflow.Context)(nil)).Elem()
+	contextType         = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType           = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+type (
+	// WorkflowType is a typed reference to a workflow that takes In and returns Out. Get one from RegisterTypedWorkflow
+	// so that the name always matches the registration, or from WorkflowTypeOf or NewWorkflowType for workflows
+	// registered elsewhere and check it with CheckTypedRegistrations.
+	WorkflowType[In, Out any] struct {
+		Name string
+	}
+
+	// ActivityType is a typed reference to an activity that takes In and returns Out
+	ActivityType[In, Out any] struct {
+		Name string
+	}
+
+	// SignalType is a typed reference to a signal carrying T
+	SignalType[T any] struct {
+		Name string
+	}
+
+	// QueryType is a typed reference to a query answered with T
+	QueryType[T any] struct {
+		Name string
+	}
+
+	// TypedRun is a handle to a workflow started with StartTyped
+	TypedRun[Out any] struct {
+		ID    string
+		RunID string
+
+		client client.Client
+	}
+
+	// TypedFuture is a workflow.Future that decodes its result into T
+	TypedFuture[T any] struct {
+		workflow.Future
+	}
+
+	// TypedRegistration is a typed workflow or activity reference that CheckTypedRegistrations can verify
+	TypedRegistration interface {
+		registrationKind() string
+		registrationName() string
+		checkSignature(fn reflect.Type) error
+	}
+)
+
+// NewWorkflowType returns a typed reference to the workflow registered under name
+func NewWorkflowType[In, Out any](name string) WorkflowType[In, Out] {
+	return WorkflowType[In, Out]{Name: name}
+}
+
+// WorkflowTypeOf returns a typed reference to a workflow registered without an alias, named like the cadence client
+// names it
+func WorkflowTypeOf[In, Out any](fn func(workflow.Context, In) (Out, error)) WorkflowType[In, Out] {
+	return WorkflowType[In, Out]{Name: functionName(fn)}
+}
+
+// ActivityTypeOf returns a typed reference to an activity registered without an alias, named like the cadence client
+// names it
+func ActivityTypeOf[In, Out any](fn func(context.Context, In) (Out, error)) ActivityType[In, Out] {
+	return ActivityType[In, Out]{Name: functionName(fn)}
+}
+
+// NewActivityType returns a typed reference to the activity registered under name
+func NewActivityType[In, Out any](name string) ActivityType[In, Out] {
+	return ActivityType[In, Out]{Name: name}
+}
+
+// NewSignalType returns a typed reference to the signal with the given name
+func NewSignalType[T any](name string) SignalType[T] {
+	return SignalType[T]{Name: name}
+}
+
+// NewQueryType returns a typed reference to the query with the given name
+func NewQueryType[T any](name string) QueryType[T] {
+	return QueryType[T]{Name: name}
+}
+
+// RegisterTypedWorkflow registers the workflow under name, or under its function name like RegisterWorkflow when
+// name is empty, and returns a reference that can only be started with the workflow's input type.
+func RegisterTypedWorkflow[In, Out any](
+	h *SampleHelper,
+	fn func(workflow.Context, In) (Out, error),
+	name string,
+) WorkflowType[In, Out] {
+	h.RegisterWorkflowWithAlias(fn, name)
+	if name == "" {
+		name = functionName(fn)
+	}
+	return WorkflowType[In, Out]{Name: name}
+}
+
+// RegisterTypedActivity registers the activity under name, or under its function name like RegisterActivity when
+// name is empty, and returns a reference that can only be executed with the activity's input type.
+func RegisterTypedActivity[In, Out any](
+	h *SampleHelper,
+	fn func(context.Context, In) (Out, error),
+	name string,
+) ActivityType[In, Out] {
+	h.RegisterActivityWithAlias(fn, name)
+	if name == "" {
+		name = functionName(fn)
+	}
+	return ActivityType[In, Out]{Name: name}
+}
+
+// CheckTypedRegistrations verifies that every reference names a workflow or activity registered on the helper or on
+// one of its worker groups and that the registered function takes and returns the reference's types. Run it before
+// starting workers so that a renamed function or changed signature fails at startup instead of in workflow history.
+func (h *SampleHelper) CheckTypedRegistrations(refs ...TypedRegistration) error {
+	workflows, activities := h.workflowRegistries, h.activityRegistries
+	for _, g := range h.workerGroups {
+		workflows = append(workflows[:len(workflows):len(workflows)], g.workflows...)
+		activities = append(activities[:len(activities):len(activities)], g.activities...)
+	}
+
+	var errs []error
+	for _, ref := range refs {
+		registries := activities
+		if ref.registrationKind() == "workflow" {
+			registries = workflows
+		}
+
+		fn, ok := findRegistration(registries, ref.registrationName())
+		if !ok {
+			errs = append(errs, fmt.Errorf("%v %v is not registered", ref.registrationKind(), ref.registrationName()))
+			continue
+		}
+		if err := ref.checkSignature(reflect.TypeOf(fn)); err != nil {
+			errs = append(errs, fmt.Errorf("%v %v: %w", ref.registrationKind(), ref.registrationName(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// StartTyped starts the workflow with a typed input and returns a handle whose Get returns the typed result
+func StartTyped[In, Out any](
+	ctx context.Context,
+	h *SampleHelper,
+	options client.StartWorkflowOptions,
+	wf WorkflowType[In, Out],
+	in In,
+) (*TypedRun[Out], error) {
+	we, err := h.TryStartWorkflow(ctx, options, wf.Name, in)
+	if err != nil {
+		return nil, err
+	}
+	workflowClient, err := h.Builder.BuildCadenceClient()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build cadence client: %w", err)
+	}
+	return &TypedRun[Out]{ID: we.ID, RunID: we.RunID, client: workflowClient}, nil
+}
+
+// Get blocks until the workflow completes and returns its result
+func (r *TypedRun[Out]) Get(ctx context.Context) (Out, error) {
+	var out Out
+	err := r.client.GetWorkflow(ctx, r.ID, r.RunID).Get(ctx, &out)
+	return out, err
+}
+
+// SignalTyped sends a typed signal to the given run of a workflow, an empty runID targets the current run
+func SignalTyped[T any](ctx context.Context, h *SampleHelper, workflowID, runID string, signal SignalType[T], value T) error {
+	return h.TrySignalWorkflow(ctx, workflowID, runID, signal.Name, value)
+}
+
+// QueryTyped queries the given run of a workflow and decodes the typed result
+func QueryTyped[T any](ctx context.Context, h *SampleHelper, workflowID, runID string, query QueryType[T]) (T, error) {
+	var result T
+	resp, err := h.TryQueryWorkflow(ctx, workflowID, runID, query.Name)
+	if err != nil {
+		return result, err
+	}
+	if err := resp.Get(&result); err != nil {
+		return result, fmt.Errorf("failed to decode query result: %w", err)
+	}
+	return result, nil
+}
+
+// ExecuteTypedActivity executes the activity from workflow code with a typed input
+func ExecuteTypedActivity[In, Out any](ctx workflow.Context, activity ActivityType[In, Out], in In) TypedFuture[Out] {
+	return TypedFuture[Out]{Future: workflow.ExecuteActivity(ctx, activity.Name, in)}
+}
+
+// ExecuteTypedChildWorkflow executes the workflow as a child from workflow code with a typed input
+func ExecuteTypedChildWorkflow[In, Out any](ctx workflow.Context, wf WorkflowType[In, Out], in In) TypedFuture[Out] {
+	return TypedFuture[Out]{Future: workflow.ExecuteChildWorkflow(ctx, wf.Name, in)}
+}
+
+// GetTyped blocks until the future is ready and returns its typed value
+func (f TypedFuture[T]) GetTyped(ctx workflow.Context) (T, error) {
+	var value T
+	err := f.Future.Get(ctx, &value)
+	return value, err
+}
+
+// Receive blocks until the signal arrives and returns its typed value
+func (s SignalType[T]) Receive(ctx workflow.Context) T {
+	var value T
+	workflow.GetSignalChannel(ctx, s.Name).Receive(ctx, &value)
+	return value
+}
+
+// ReceiveAsync returns the next buffered signal value without blocking, ok is false when there is none
+func (s SignalType[T]) ReceiveAsync(ctx workflow.Context) (value T, ok bool) {
+	ok = workflow.GetSignalChannel(ctx, s.Name).ReceiveAsync(&value)
+	return value, ok
+}
+
+// Channel returns the underlying signal channel, e.g. to add it to a workflow.Selector
+func (s SignalType[T]) Channel(ctx workflow.Context) workflow.Channel {
+	return workflow.GetSignalChannel(ctx, s.Name)
+}
+
+// SetHandler answers the query from workflow code with a typed value
+func (q QueryType[T]) SetHandler(ctx workflow.Context, handler func() (T, error)) error {
+	return workflow.SetQueryHandler(ctx, q.Name, handler)
+}
+
+func (w WorkflowType[In, Out]) registrationKind() string { return "workflow" }
+func (w WorkflowType[In, Out]) registrationName() string { return w.Name }
+
+func (w WorkflowType[In, Out]) checkSignature(fn reflect.Type) error {
+	return checkSignature(fn, workflowContextType, reflect.TypeOf((*In)(nil)).Elem(), reflect.TypeOf((*Out)(nil)).Elem())
+}
+
+func (a ActivityType[In, Out]) registrationKind() string { return "activity" }
+func (a ActivityType[In, Out]) registrationName() string { return a.Name }
+
+func (a ActivityType[In, Out]) checkSignature(fn reflect.Type) error {
+	return checkSignature(fn, contextType, reflect.TypeOf((*In)(nil)).Elem(), reflect.TypeOf((*Out)(nil)).Elem())
+}
+
+// checkSignature verifies that fn is func(ctx, In) (Out, error)
+func checkSignature(fn, ctx, in, out reflect.Type) error {
+	want := reflect.FuncOf([]reflect.Type{ctx, in}, []reflect.Type{out, errorType}, false)
+	if fn.Kind() != reflect.Func || fn != want {
+		return fmt.Errorf("registered function is %v, expected %v", fn, want)
+	}
+	return nil
+}
+
+// findRegistration returns the function registered under name, using the same default names as the cadence client
+func findRegistration(registries []registryOption, name string) (interface{}, bool) {
+	for _, r := range registries {
+		registered := r.alias
+		if registered == "" {
+			registered = functionName(r.registry)
+		}
+		if registered == name {
+			return r.registry, true
+		}
+	}
+	return nil, false
+}
+
+// functionName returns the name the cadence client registers a function under when no alias is given
+func functionName(fn interface{}) string {
+	fullName := runtime.FuncForPC(reflect.ValueOf(fn).Pointer()).Name()
+	return strings.TrimSuffix(fullName, "-fm")
+}
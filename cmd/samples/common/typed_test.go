@@ -0,0 +1,209 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/cadence/activity"
+	"go.uber.org/cadence/client"
+	"go.uber.org/cadence/encoded"
+	"go.uber.org/cadence/testsuite"
+	"go.uber.org/cadence/workflow"
+	"go.uber.org/zap/zaptest"
+)
+
+type (
+	greetRequest struct {
+		Name string
+	}
+
+	greetResult struct {
+		Greeting string
+		Count    int
+	}
+)
+
+var (
+	greetSignal = NewSignalType[string]("greet")
+	greetQuery  = NewQueryType[int]("greeted")
+)
+
+func typedGreetActivity(ctx context.Context, name string) (string, error) {
+	return "Hello " + name + "!", nil
+}
+
+func typedGreetWorkflow(ctx workflow.Context, request greetRequest) (greetResult, error) {
+	ctx = workflow.WithActivityOptions(ctx, workflow.ActivityOptions{
+		ScheduleToStartTimeout: time.Minute,
+		StartToCloseTimeout:    time.Minute,
+	})
+
+	count := 0
+	if err := greetQuery.SetHandler(ctx, func() (int, error) { return count, nil }); err != nil {
+		return greetResult{}, err
+	}
+
+	greeting, err := ExecuteTypedActivity(ctx, NewActivityType[string, string]("greet-activity"), request.Name).GetTyped(ctx)
+	if err != nil {
+		return greetResult{}, err
+	}
+	count++
+
+	suffix := greetSignal.Receive(ctx)
+	return greetResult{Greeting: greeting + suffix, Count: count}, nil
+}
+
+func untypedWorkflow(ctx workflow.Context, name string, times int) error {
+	return nil
+}
+
+func TestTypedWorkflowHelpers(t *testing.T) {
+	var s testsuite.WorkflowTestSuite
+	env := s.NewTestWorkflowEnvironment()
+	env.RegisterWorkflow(typedGreetWorkflow)
+	env.RegisterActivityWithOptions(typedGreetActivity, activity.RegisterOptions{Name: "greet-activity"})
+
+	env.RegisterDelayedCallback(func() {
+		result, err := env.QueryWorkflow(greetQuery.Name)
+		require.NoError(t, err)
+		var count int
+		require.NoError(t, result.Get(&count))
+		assert.Equal(t, 1, count)
+
+		env.SignalWorkflow(greetSignal.Name, " Welcome.")
+	}, time.Minute)
+	env.ExecuteWorkflow(typedGreetWorkflow, greetRequest{Name: "Cadence"})
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+	var result greetResult
+	require.NoError(t, env.GetWorkflowResult(&result))
+	assert.Equal(t, greetResult{Greeting: "Hello Cadence! Welcome.", Count: 1}, result)
+}
+
+func TestCheckTypedRegistrations(t *testing.T) {
+	h := &SampleHelper{}
+	wf := RegisterTypedWorkflow(h, typedGreetWorkflow, "")
+	act := RegisterTypedActivity(h, typedGreetActivity, "greet-activity")
+	h.RegisterWorkflow(untypedWorkflow)
+
+	assert.Equal(t, "github.com/uber-common/cadence-samples/cmd/samples/common.typedGreetWorkflow", wf.Name)
+	assert.Equal(t, "greet-activity", act.Name)
+	assert.Equal(t, wf, WorkflowTypeOf(typedGreetWorkflow))
+	assert.Equal(t, "github.com/uber-common/cadence-samples/cmd/samples/common.typedGreetActivity", ActivityTypeOf(typedGreetActivity).Name)
+	require.NoError(t, h.CheckTypedRegistrations(wf, act))
+
+	err := h.CheckTypedRegistrations(
+		NewWorkflowType[string, string](wf.Name),
+		NewActivityType[string, string]("missing-activity"),
+		NewWorkflowType[string, int](functionName(untypedWorkflow)),
+	)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "registered function is func(internal.Context, common.greetRequest) (common.greetResult, error)")
+	assert.Contains(t, err.Error(), "activity missing-activity is not registered")
+	assert.Contains(t, err.Error(), "common.untypedWorkflow: registered function is func(internal.Context, string, int) error")
+}
+
+func TestCheckTypedRegistrationsOfWorkerGroups(t *testing.T) {
+	h := &SampleHelper{}
+	h.WorkerGroup("host").
+		RegisterWorkflow(typedGreetWorkflow).
+		RegisterActivityWithAlias(typedGreetActivity, "greet-activity")
+
+	require.NoError(t, h.CheckTypedRegistrations(
+		WorkflowTypeOf(typedGreetWorkflow),
+		NewActivityType[string, string]("greet-activity"),
+	))
+	err := h.CheckTypedRegistrations(NewActivityType[string, int]("greet-activity"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "activity greet-activity: registered function is")
+}
+
+// fakeTypedClient answers the calls made by the typed client helpers
+type fakeTypedClient struct {
+	client.Client
+
+	startArgs  []interface{}
+	signal     string
+	signalArgs interface{}
+	result     interface{}
+}
+
+func (c *fakeTypedClient) StartWorkflow(ctx context.Context, options client.StartWorkflowOptions, wf interface{}, args ...interface{}) (*workflow.Execution, error) {
+	c.startArgs = append([]interface{}{wf}, args...)
+	return &workflow.Execution{ID: options.ID, RunID: "run-1"}, nil
+}
+
+func (c *fakeTypedClient) GetWorkflow(ctx context.Context, workflowID, runID string) client.WorkflowRun {
+	return &fakeRun{result: fakeValue{value: c.result}}
+}
+
+func (c *fakeTypedClient) SignalWorkflow(ctx context.Context, workflowID, runID, signalName string, arg interface{}) error {
+	c.signal = signalName
+	c.signalArgs = arg
+	return nil
+}
+
+func (c *fakeTypedClient) QueryWorkflow(ctx context.Context, workflowID, runID, queryType string, args ...interface{}) (encoded.Value, error) {
+	return &fakeValue{value: c.result}, nil
+}
+
+// fakeValue is an encoded value that round trips its value through JSON
+type fakeValue struct {
+	value interface{}
+}
+
+func (v *fakeValue) HasValue() bool {
+	return v.value != nil
+}
+
+func (v *fakeValue) Get(valuePtr interface{}) error {
+	data, err := json.Marshal(v.value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, valuePtr)
+}
+
+type fakeRun struct {
+	client.WorkflowRun
+	result fakeValue
+}
+
+func (r *fakeRun) Get(ctx context.Context, valuePtr interface{}) error {
+	return r.result.Get(valuePtr)
+}
+
+func TestTypedClientHelpers(t *testing.T) {
+	workflowClient := &fakeTypedClient{}
+	h := &SampleHelper{
+		Logger:  zaptest.NewLogger(t),
+		Builder: &WorkflowClientBuilder{client: workflowClient},
+	}
+	wf := NewWorkflowType[greetRequest, greetResult]("greeter")
+	ctx := context.Background()
+
+	run, err := StartTyped(ctx, h, client.StartWorkflowOptions{ID: "greeter-1"}, wf, greetRequest{Name: "Cadence"})
+	require.NoError(t, err)
+	assert.Equal(t, "greeter-1", run.ID)
+	assert.Equal(t, "run-1", run.RunID)
+	assert.Equal(t, []interface{}{"greeter", greetRequest{Name: "Cadence"}}, workflowClient.startArgs)
+
+	workflowClient.result = greetResult{Greeting: "Hello Cadence!", Count: 1}
+	result, err := run.Get(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, greetResult{Greeting: "Hello Cadence!", Count: 1}, result)
+
+	require.NoError(t, SignalTyped(ctx, h, run.ID, "", greetSignal, "hi"))
+	assert.Equal(t, "greet", workflowClient.signal)
+	assert.Equal(t, "hi", workflowClient.signalArgs)
+
+	workflowClient.result = 3
+	count, err := QueryTyped(ctx, h, run.ID, run.RunID, greetQuery)
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+}
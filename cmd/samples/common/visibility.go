@@ -0,0 +1,365 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/cadence/.gen/go/shared"
+	"go.uber.org/cadence/client"
+)
+
+const defaultListPageSize = 100
+
+type (
+	// ExecutionFilter selects the executions returned by the list, scan and count helpers. Zero values do not filter.
+	ExecutionFilter struct {
+		// Query is a visibility query such as `CustomKeywordField = "keyword1"`, only used by the query based helpers
+		// and combined with the other filters using AND
+		Query string
+		// WorkflowType and WorkflowID match the workflow type name and workflow ID. The open and closed listings
+		// accept only one of them.
+		WorkflowType string
+		WorkflowID   string
+		// CloseStatus limits the result to executions closed with this status, the open listing ignores it
+		CloseStatus *shared.WorkflowExecutionCloseStatus
+		// OnlyOpen limits query based results to executions that are still running
+		OnlyOpen bool
+		// StartedAfter and StartedBefore bound the start time of the executions
+		StartedAfter  time.Time
+		StartedBefore time.Time
+
+		// PageSize is the number of executions fetched per request, defaults to 100
+		PageSize int32
+		// PageToken resumes a listing from ExecutionIterator.NextPageToken of an earlier listing
+		PageToken []byte
+	}
+
+	// ExecutionIterator pages through a listing transparently, fetching the next page only once the current one is
+	// consumed. Use it like the cadence client's HistoryEventIterator:
+	//
+	//	for it.HasNext() {
+	//		execution, err := it.Next()
+	//		...
+	//	}
+	ExecutionIterator struct {
+		ctx   context.Context
+		fetch pageFetcher
+
+		page      []*shared.WorkflowExecutionInfo
+		pageToken []byte
+		started   bool
+		done      bool
+		err       error
+	}
+
+	pageFetcher func(ctx context.Context, pageToken []byte) ([]*shared.WorkflowExecutionInfo, []byte, error)
+)
+
+// ListOpenExecutions lists the running executions in the domain matching the filter
+func ListOpenExecutions(ctx context.Context, c client.Client, domain string, filter ExecutionFilter) *ExecutionIterator {
+	if err := filter.checkListFilter(); err != nil {
+		return failedIterator(err)
+	}
+	startTimeFilter := filter.startTimeFilter()
+	return newExecutionIterator(ctx, filter.PageToken, func(ctx context.Context, pageToken []byte) ([]*shared.WorkflowExecutionInfo, []byte, error) {
+		resp, err := c.ListOpenWorkflow(ctx, &shared.ListOpenWorkflowExecutionsRequest{
+			Domain:          StringPtr(domain),
+			MaximumPageSize: Int32Ptr(filter.pageSize()),
+			NextPageToken:   pageToken,
+			StartTimeFilter: startTimeFilter,
+			ExecutionFilter: filter.executionFilter(),
+			TypeFilter:      filter.typeFilter(),
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to list open workflows: %w", err)
+		}
+		return resp.Executions, resp.NextPageToken, nil
+	})
+}
+
+// ListClosedExecutions lists the closed executions in the domain matching the filter
+func ListClosedExecutions(ctx context.Context, c client.Client, domain string, filter ExecutionFilter) *ExecutionIterator {
+	if err := filter.checkListFilter(); err != nil {
+		return failedIterator(err)
+	}
+	if filter.CloseStatus != nil && (filter.WorkflowType != "" || filter.WorkflowID != "") {
+		return failedIterator(errors.New("closed workflows can be filtered by only one of close status, workflow type and workflow ID"))
+	}
+	startTimeFilter := filter.startTimeFilter()
+	return newExecutionIterator(ctx, filter.PageToken, func(ctx context.Context, pageToken []byte) ([]*shared.WorkflowExecutionInfo, []byte, error) {
+		resp, err := c.ListClosedWorkflow(ctx, &shared.ListClosedWorkflowExecutionsRequest{
+			Domain:          StringPtr(domain),
+			MaximumPageSize: Int32Ptr(filter.pageSize()),
+			NextPageToken:   pageToken,
+			StartTimeFilter: startTimeFilter,
+			ExecutionFilter: filter.executionFilter(),
+			TypeFilter:      filter.typeFilter(),
+			StatusFilter:    filter.CloseStatus,
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to list closed workflows: %w", err)
+		}
+		return resp.Executions, resp.NextPageToken, nil
+	})
+}
+
+// QueryExecutions lists the executions in the domain matching the filter with a visibility query, ordered by start
+// time. It needs advanced visibility.
+func QueryExecutions(ctx context.Context, c client.Client, domain string, filter ExecutionFilter) *ExecutionIterator {
+	query := filter.VisibilityQuery()
+	return newExecutionIterator(ctx, filter.PageToken, func(ctx context.Context, pageToken []byte) ([]*shared.WorkflowExecutionInfo, []byte, error) {
+		resp, err := c.ListWorkflow(ctx, filter.listRequest(domain, query, pageToken))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to list workflows: %w", err)
+		}
+		return resp.Executions, resp.NextPageToken, nil
+	})
+}
+
+// ScanExecutions is QueryExecutions without ordering, which is faster for large result sets
+func ScanExecutions(ctx context.Context, c client.Client, domain string, filter ExecutionFilter) *ExecutionIterator {
+	query := filter.VisibilityQuery()
+	return newExecutionIterator(ctx, filter.PageToken, func(ctx context.Context, pageToken []byte) ([]*shared.WorkflowExecutionInfo, []byte, error) {
+		resp, err := c.ScanWorkflow(ctx, filter.listRequest(domain, query, pageToken))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to scan workflows: %w", err)
+		}
+		return resp.Executions, resp.NextPageToken, nil
+	})
+}
+
+// CountExecutions counts the executions in the domain matching the filter with a visibility query
+func CountExecutions(ctx context.Context, c client.Client, domain string, filter ExecutionFilter) (int64, error) {
+	resp, err := c.CountWorkflow(ctx, &shared.CountWorkflowExecutionsRequest{
+		Domain: StringPtr(domain),
+		Query:  StringPtr(filter.VisibilityQuery()),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to count workflows: %w", err)
+	}
+	return resp.GetCount(), nil
+}
+
+// ListOpenExecutions lists the running executions in the configured domain, see ListOpenExecutions
+func (h *SampleHelper) ListOpenExecutions(ctx context.Context, filter ExecutionFilter) *ExecutionIterator {
+	workflowClient, err := h.Builder.BuildCadenceClient()
+	if err != nil {
+		return failedIterator(fmt.Errorf("failed to build cadence client: %w", err))
+	}
+	return ListOpenExecutions(ctx, workflowClient, h.Config.DomainName, filter)
+}
+
+// ListClosedExecutions lists the closed executions in the configured domain, see ListClosedExecutions
+func (h *SampleHelper) ListClosedExecutions(ctx context.Context, filter ExecutionFilter) *ExecutionIterator {
+	workflowClient, err := h.Builder.BuildCadenceClient()
+	if err != nil {
+		return failedIterator(fmt.Errorf("failed to build cadence client: %w", err))
+	}
+	return ListClosedExecutions(ctx, workflowClient, h.Config.DomainName, filter)
+}
+
+// QueryExecutions lists the executions in the configured domain matching a visibility query, see QueryExecutions
+func (h *SampleHelper) QueryExecutions(ctx context.Context, filter ExecutionFilter) *ExecutionIterator {
+	workflowClient, err := h.Builder.BuildCadenceClient()
+	if err != nil {
+		return failedIterator(fmt.Errorf("failed to build cadence client: %w", err))
+	}
+	return QueryExecutions(ctx, workflowClient, h.Config.DomainName, filter)
+}
+
+// ScanExecutions scans the executions in the configured domain matching a visibility query, see ScanExecutions
+func (h *SampleHelper) ScanExecutions(ctx context.Context, filter ExecutionFilter) *ExecutionIterator {
+	workflowClient, err := h.Builder.BuildCadenceClient()
+	if err != nil {
+		return failedIterator(fmt.Errorf("failed to build cadence client: %w", err))
+	}
+	return ScanExecutions(ctx, workflowClient, h.Config.DomainName, filter)
+}
+
+// CountExecutions counts the executions in the configured domain matching a visibility query
+func (h *SampleHelper) CountExecutions(ctx context.Context, filter ExecutionFilter) (int64, error) {
+	workflowClient, err := h.Builder.BuildCadenceClient()
+	if err != nil {
+		return 0, fmt.Errorf("failed to build cadence client: %w", err)
+	}
+	return CountExecutions(ctx, workflowClient, h.Config.DomainName, filter)
+}
+
+// VisibilityQuery combines the query and the other filters into one visibility query
+func (f ExecutionFilter) VisibilityQuery() string {
+	var clauses []string
+	if f.Query != "" {
+		clauses = append(clauses, "("+f.Query+")")
+	}
+	if f.WorkflowType != "" {
+		clauses = append(clauses, "WorkflowType = "+strconv.Quote(f.WorkflowType))
+	}
+	if f.WorkflowID != "" {
+		clauses = append(clauses, "WorkflowID = "+strconv.Quote(f.WorkflowID))
+	}
+	if f.OnlyOpen {
+		clauses = append(clauses, "CloseTime = missing")
+	}
+	if f.CloseStatus != nil {
+		clauses = append(clauses, fmt.Sprintf("CloseStatus = %d", int32(*f.CloseStatus)))
+	}
+	if !f.StartedAfter.IsZero() {
+		clauses = append(clauses, fmt.Sprintf("StartTime >= %d", f.StartedAfter.UnixNano()))
+	}
+	if !f.StartedBefore.IsZero() {
+		clauses = append(clauses, fmt.Sprintf("StartTime <= %d", f.StartedBefore.UnixNano()))
+	}
+	return strings.Join(clauses, " AND ")
+}
+
+func (f ExecutionFilter) checkListFilter() error {
+	if f.Query != "" {
+		return errors.New("visibility queries need QueryExecutions or ScanExecutions")
+	}
+	if f.WorkflowType != "" && f.WorkflowID != "" {
+		return errors.New("workflows can be listed by only one of workflow type and workflow ID")
+	}
+	return nil
+}
+
+func (f ExecutionFilter) pageSize() int32 {
+	if f.PageSize > 0 {
+		return f.PageSize
+	}
+	return defaultListPageSize
+}
+
+// startTimeFilter is required by the open and closed listings, an unbounded end is fixed to now so that every page
+// of the listing uses the same range
+func (f ExecutionFilter) startTimeFilter() *shared.StartTimeFilter {
+	latest := f.StartedBefore
+	if latest.IsZero() {
+		latest = time.Now()
+	}
+	var earliest int64
+	if !f.StartedAfter.IsZero() {
+		earliest = f.StartedAfter.UnixNano()
+	}
+	return &shared.StartTimeFilter{
+		EarliestTime: Int64Ptr(earliest),
+		LatestTime:   Int64Ptr(latest.UnixNano()),
+	}
+}
+
+func (f ExecutionFilter) typeFilter() *shared.WorkflowTypeFilter {
+	if f.WorkflowType == "" {
+		return nil
+	}
+	return &shared.WorkflowTypeFilter{Name: StringPtr(f.WorkflowType)}
+}
+
+func (f ExecutionFilter) executionFilter() *shared.WorkflowExecutionFilter {
+	if f.WorkflowID == "" {
+		return nil
+	}
+	return &shared.WorkflowExecutionFilter{WorkflowId: StringPtr(f.WorkflowID)}
+}
+
+func (f ExecutionFilter) listRequest(domain, query string, pageToken []byte) *shared.ListWorkflowExecutionsRequest {
+	return &shared.ListWorkflowExecutionsRequest{
+		Domain:        StringPtr(domain),
+		PageSize:      Int32Ptr(f.pageSize()),
+		NextPageToken: pageToken,
+		Query:         StringPtr(query),
+	}
+}
+
+func newExecutionIterator(ctx context.Context, pageToken []byte, fetch pageFetcher) *ExecutionIterator {
+	return &ExecutionIterator{ctx: ctx, fetch: fetch, pageToken: pageToken}
+}
+
+func failedIterator(err error) *ExecutionIterator {
+	return &ExecutionIterator{started: true, done: true, err: err}
+}
+
+// HasNext returns whether there is another execution or an error to return from Next, fetching the next page when
+// the current one is consumed
+func (it *ExecutionIterator) HasNext() bool {
+	for len(it.page) == 0 && it.err == nil && !it.done && (!it.started || len(it.pageToken) > 0) {
+		it.started = true
+		page, pageToken, err := it.fetch(it.ctx, it.pageToken)
+		if err != nil {
+			// keep the token of the failed page so that the listing can be resumed from it
+			it.err = err
+			it.done = true
+			break
+		}
+		it.page, it.pageToken = page, pageToken
+	}
+	return len(it.page) > 0 || it.err != nil
+}
+
+// Next returns the next execution, or the error that ended the listing
+func (it *ExecutionIterator) Next() (*shared.WorkflowExecutionInfo, error) {
+	if !it.HasNext() {
+		return nil, errors.New("no more executions")
+	}
+	if it.err != nil {
+		err := it.err
+		it.err = nil
+		return nil, err
+	}
+	execution := it.page[0]
+	it.page = it.page[1:]
+	return execution, nil
+}
+
+// NextPage returns the rest of the current page, fetching the next page when the current one is consumed, and no
+// executions once the listing ends. Together with NextPageToken it lets a caller hand out one page at a time.
+func (it *ExecutionIterator) NextPage() ([]*shared.WorkflowExecutionInfo, error) {
+	if !it.HasNext() {
+		return nil, nil
+	}
+	if it.err != nil {
+		err := it.err
+		it.err = nil
+		return nil, err
+	}
+	page := it.page
+	it.page = nil
+	return page, nil
+}
+
+// NextPageToken returns the token of the page after the one being consumed, or of the page that failed, and is empty
+// once the last page is fetched. Pass it as ExecutionFilter.PageToken to resume the listing, e.g. from activity
+// heartbeat details.
+func (it *ExecutionIterator) NextPageToken() []byte {
+	return it.pageToken
+}
+
+// Stream sends the executions on the returned channel until the listing ends, ctx is done or a page fails. The
+// channel is closed at the end, after which Err returns the error that ended the listing, if any.
+func (it *ExecutionIterator) Stream(ctx context.Context) <-chan *shared.WorkflowExecutionInfo {
+	executions := make(chan *shared.WorkflowExecutionInfo)
+	go func() {
+		defer close(executions)
+		for it.HasNext() {
+			execution, err := it.Next()
+			if err != nil {
+				it.err = err
+				return
+			}
+			select {
+			case executions <- execution:
+			case <-ctx.Done():
+				it.err = ctx.Err()
+				return
+			}
+		}
+	}()
+	return executions
+}
+
+// Err returns the error that ended a Stream
+func (it *ExecutionIterator) Err() error {
+	return it.err
+}
@@ -0,0 +1,198 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/cadence/.gen/go/shared"
+	"go.uber.org/cadence/client"
+	"go.uber.org/zap/zaptest"
+)
+
+// fakeVisibilityClient serves its executions in pages and records the requests it received
+type fakeVisibilityClient struct {
+	client.Client
+
+	executions []*shared.WorkflowExecutionInfo
+	failAfter  int
+	count      int64
+
+	openRequests   []*shared.ListOpenWorkflowExecutionsRequest
+	closedRequests []*shared.ListClosedWorkflowExecutionsRequest
+	queries        []string
+}
+
+func newFakeVisibilityClient(n int) *fakeVisibilityClient {
+	c := &fakeVisibilityClient{failAfter: -1}
+	for i := 0; i < n; i++ {
+		c.executions = append(c.executions, &shared.WorkflowExecutionInfo{
+			Execution: &shared.WorkflowExecution{WorkflowId: StringPtr(fmt.Sprintf("wf-%d", i))},
+		})
+	}
+	return c
+}
+
+// page returns the executions after the offset encoded in the page token
+func (c *fakeVisibilityClient) page(pageSize int32, pageToken []byte) ([]*shared.WorkflowExecutionInfo, []byte, error) {
+	offset := 0
+	if len(pageToken) > 0 {
+		offset, _ = strconv.Atoi(string(pageToken))
+	}
+	if c.failAfter >= 0 && offset >= c.failAfter {
+		return nil, nil, errors.New("visibility store unavailable")
+	}
+	end := offset + int(pageSize)
+	if end >= len(c.executions) {
+		return c.executions[offset:], nil, nil
+	}
+	return c.executions[offset:end], []byte(strconv.Itoa(end)), nil
+}
+
+func (c *fakeVisibilityClient) ListOpenWorkflow(ctx context.Context, request *shared.ListOpenWorkflowExecutionsRequest) (*shared.ListOpenWorkflowExecutionsResponse, error) {
+	c.openRequests = append(c.openRequests, request)
+	executions, token, err := c.page(request.GetMaximumPageSize(), request.NextPageToken)
+	if err != nil {
+		return nil, err
+	}
+	return &shared.ListOpenWorkflowExecutionsResponse{Executions: executions, NextPageToken: token}, nil
+}
+
+func (c *fakeVisibilityClient) ListClosedWorkflow(ctx context.Context, request *shared.ListClosedWorkflowExecutionsRequest) (*shared.ListClosedWorkflowExecutionsResponse, error) {
+	c.closedRequests = append(c.closedRequests, request)
+	executions, token, err := c.page(request.GetMaximumPageSize(), request.NextPageToken)
+	if err != nil {
+		return nil, err
+	}
+	return &shared.ListClosedWorkflowExecutionsResponse{Executions: executions, NextPageToken: token}, nil
+}
+
+func (c *fakeVisibilityClient) ListWorkflow(ctx context.Context, request *shared.ListWorkflowExecutionsRequest) (*shared.ListWorkflowExecutionsResponse, error) {
+	c.queries = append(c.queries, request.GetQuery())
+	executions, token, err := c.page(request.GetPageSize(), request.NextPageToken)
+	if err != nil {
+		return nil, err
+	}
+	return &shared.ListWorkflowExecutionsResponse{Executions: executions, NextPageToken: token}, nil
+}
+
+func (c *fakeVisibilityClient) ScanWorkflow(ctx context.Context, request *shared.ListWorkflowExecutionsRequest) (*shared.ListWorkflowExecutionsResponse, error) {
+	return c.ListWorkflow(ctx, request)
+}
+
+func (c *fakeVisibilityClient) CountWorkflow(ctx context.Context, request *shared.CountWorkflowExecutionsRequest) (*shared.CountWorkflowExecutionsResponse, error) {
+	c.queries = append(c.queries, request.GetQuery())
+	return &shared.CountWorkflowExecutionsResponse{Count: Int64Ptr(c.count)}, nil
+}
+
+func workflowIDs(t *testing.T, it *ExecutionIterator) []string {
+	var ids []string
+	for it.HasNext() {
+		execution, err := it.Next()
+		require.NoError(t, err)
+		ids = append(ids, execution.Execution.GetWorkflowId())
+	}
+	return ids
+}
+
+func TestListOpenExecutionsPagesTransparently(t *testing.T) {
+	workflowClient := newFakeVisibilityClient(5)
+	it := ListOpenExecutions(context.Background(), workflowClient, "samples-domain", ExecutionFilter{
+		WorkflowType: "TripWorkflow",
+		PageSize:     2,
+	})
+
+	assert.Equal(t, []string{"wf-0", "wf-1", "wf-2", "wf-3", "wf-4"}, workflowIDs(t, it))
+	assert.Empty(t, it.NextPageToken())
+	require.Len(t, workflowClient.openRequests, 3)
+	first := workflowClient.openRequests[0]
+	assert.Equal(t, "samples-domain", first.GetDomain())
+	assert.Equal(t, "TripWorkflow", first.TypeFilter.GetName())
+	assert.Nil(t, first.ExecutionFilter)
+	assert.Equal(t, int64(0), first.StartTimeFilter.GetEarliestTime())
+	// every page lists the same time range
+	assert.Equal(t, first.StartTimeFilter, workflowClient.openRequests[2].StartTimeFilter)
+}
+
+func TestListClosedExecutionsResumesFromPageToken(t *testing.T) {
+	workflowClient := newFakeVisibilityClient(5)
+	started := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	it := ListClosedExecutions(context.Background(), workflowClient, "samples-domain", ExecutionFilter{
+		CloseStatus:  shared.WorkflowExecutionCloseStatusFailed.Ptr(),
+		StartedAfter: started,
+		PageSize:     2,
+		PageToken:    []byte("2"),
+	})
+
+	assert.Equal(t, []string{"wf-2", "wf-3", "wf-4"}, workflowIDs(t, it))
+	require.Len(t, workflowClient.closedRequests, 2)
+	assert.Equal(t, shared.WorkflowExecutionCloseStatusFailed, workflowClient.closedRequests[0].GetStatusFilter())
+	assert.Equal(t, started.UnixNano(), workflowClient.closedRequests[0].StartTimeFilter.GetEarliestTime())
+
+	it = ListClosedExecutions(context.Background(), workflowClient, "samples-domain", ExecutionFilter{
+		CloseStatus:  shared.WorkflowExecutionCloseStatusFailed.Ptr(),
+		WorkflowType: "TripWorkflow",
+	})
+	require.True(t, it.HasNext())
+	_, err := it.Next()
+	require.Error(t, err)
+	assert.False(t, it.HasNext())
+}
+
+func TestQueryExecutionsStreamsAndReportsErrors(t *testing.T) {
+	workflowClient := newFakeVisibilityClient(5)
+	workflowClient.failAfter = 4
+	it := QueryExecutions(context.Background(), workflowClient, "samples-domain", ExecutionFilter{
+		Query:        `CustomKeywordField = "keyword1"`,
+		WorkflowType: "TripWorkflow",
+		OnlyOpen:     true,
+		PageSize:     2,
+	})
+
+	var ids []string
+	for execution := range it.Stream(context.Background()) {
+		ids = append(ids, execution.Execution.GetWorkflowId())
+	}
+	assert.Equal(t, []string{"wf-0", "wf-1", "wf-2", "wf-3"}, ids)
+	require.ErrorContains(t, it.Err(), "visibility store unavailable")
+	// the page that failed can be retried from the token
+	assert.Equal(t, "4", string(it.NextPageToken()))
+	assert.Equal(t, `(CustomKeywordField = "keyword1") AND WorkflowType = "TripWorkflow" AND CloseTime = missing`, workflowClient.queries[0])
+}
+
+func TestVisibilityQuery(t *testing.T) {
+	assert.Equal(t, "", ExecutionFilter{}.VisibilityQuery())
+	assert.Equal(t,
+		`WorkflowID = "trip-1" AND CloseStatus = 1 AND StartTime >= 1000 AND StartTime <= 2000`,
+		ExecutionFilter{
+			WorkflowID:    "trip-1",
+			CloseStatus:   shared.WorkflowExecutionCloseStatusFailed.Ptr(),
+			StartedAfter:  time.Unix(0, 1000),
+			StartedBefore: time.Unix(0, 2000),
+		}.VisibilityQuery())
+}
+
+func TestSampleHelperCountExecutions(t *testing.T) {
+	workflowClient := newFakeVisibilityClient(0)
+	workflowClient.count = 42
+	h := &SampleHelper{
+		Logger:  zaptest.NewLogger(t),
+		Config:  Configuration{DomainName: "samples-domain"},
+		Builder: &WorkflowClientBuilder{client: workflowClient},
+	}
+
+	count, err := h.CountExecutions(context.Background(), ExecutionFilter{WorkflowType: "TripWorkflow"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), count)
+	assert.Equal(t, []string{`WorkflowType = "TripWorkflow"`}, workflowClient.queries)
+
+	it := h.ListOpenExecutions(context.Background(), ExecutionFilter{Query: "WorkflowType = 'x'"})
+	require.True(t, it.HasNext())
+	_, err = it.Next()
+	require.Error(t, err)
+}
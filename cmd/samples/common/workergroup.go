@@ -0,0 +1,204 @@
+package common
+
+import (
+	"context"
+	"fmt"
+
+	"go.uber.org/cadence/encoded"
+	"go.uber.org/cadence/worker"
+	"go.uber.org/zap"
+)
+
+type (
+	// WorkerGroup is a named set of workflow and activity registrations that runs on its own task list with its own
+	// worker options, so that one process can host e.g. a shared task list next to a host specific one. Groups are
+	// created with SampleHelper.WorkerGroup and run with RunWorkerGroups.
+	WorkerGroup struct {
+		name       string
+		domain     string
+		taskList   string
+		options    worker.Options
+		workflows  []registryOption
+		activities []registryOption
+	}
+
+	// WorkerGroupConfig overrides the code defaults of a worker group from the config file, zero values keep them
+	WorkerGroupConfig struct {
+		TaskList                               string  `yaml:"taskList"`
+		MaxConcurrentActivityExecutionSize     int     `yaml:"maxConcurrentActivityExecutionSize"`
+		MaxConcurrentDecisionTaskExecutionSize int     `yaml:"maxConcurrentDecisionTaskExecutionSize"`
+		MaxConcurrentSessionExecutionSize      int     `yaml:"maxConcurrentSessionExecutionSize"`
+		WorkerActivitiesPerSecond              float64 `yaml:"workerActivitiesPerSecond"`
+		TaskListActivitiesPerSecond            float64 `yaml:"taskListActivitiesPerSecond"`
+		WorkerDecisionTasksPerSecond           float64 `yaml:"workerDecisionTasksPerSecond"`
+		EnableSessionWorker                    *bool   `yaml:"enableSessionWorker"`
+		DisableStickyExecution                 *bool   `yaml:"disableStickyExecution"`
+	}
+)
+
+// WorkerGroup returns the worker group with the given name, creating it on first use. A new group polls the task
+// list with the group's name.
+func (h *SampleHelper) WorkerGroup(name string) *WorkerGroup {
+	if g := h.findWorkerGroup(name); g != nil {
+		return g
+	}
+
+	g := &WorkerGroup{name: name, taskList: name}
+	h.workerGroups = append(h.workerGroups, g)
+	return g
+}
+
+// RunWorkerGroups runs the named worker groups, or every group in creation order when no name is given, until the
+// process receives SIGINT or SIGTERM. See RunWorkers.
+func (h *SampleHelper) RunWorkerGroups(names ...string) {
+	specs, err := h.workerGroupSpecs(names)
+	if err != nil {
+		h.Logger.Error("Failed to run worker groups.", zap.Error(err))
+		panic("Failed to run worker groups")
+	}
+	h.RunWorkers(specs...)
+}
+
+// TryRunWorkerGroups is RunWorkerGroups returning an error instead of panicking. It also returns once ctx is done.
+func (h *SampleHelper) TryRunWorkerGroups(ctx context.Context, names ...string) error {
+	specs, err := h.workerGroupSpecs(names)
+	if err != nil {
+		return err
+	}
+	return h.TryRunWorkers(ctx, specs...)
+}
+
+func (h *SampleHelper) workerGroupSpecs(names []string) ([]WorkerSpec, error) {
+	groups := h.workerGroups
+	if len(names) > 0 {
+		groups = make([]*WorkerGroup, 0, len(names))
+		for _, name := range names {
+			g := h.findWorkerGroup(name)
+			if g == nil {
+				return nil, fmt.Errorf("unknown worker group %q", name)
+			}
+			groups = append(groups, g)
+		}
+	}
+
+	specs := make([]WorkerSpec, 0, len(groups))
+	for _, g := range groups {
+		spec := g.spec(h.Config.WorkerGroups[g.name])
+		if spec.Options.MetricsScope == nil {
+			spec.Options.MetricsScope = h.WorkerMetricScope
+		}
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
+func (h *SampleHelper) findWorkerGroup(name string) *WorkerGroup {
+	for _, g := range h.workerGroups {
+		if g.name == name {
+			return g
+		}
+	}
+	return nil
+}
+
+// Name returns the name the group was created with
+func (g *WorkerGroup) Name() string {
+	return g.name
+}
+
+// TaskList returns the task list the group polls
+func (g *WorkerGroup) TaskList() string {
+	return g.taskList
+}
+
+// SetDomain sets the domain the group polls, defaults to the configured domain
+func (g *WorkerGroup) SetDomain(domain string) *WorkerGroup {
+	g.domain = domain
+	return g
+}
+
+// SetTaskList sets the task list the group polls, defaults to the group name
+func (g *WorkerGroup) SetTaskList(taskList string) *WorkerGroup {
+	g.taskList = taskList
+	return g
+}
+
+// SetOptions replaces the worker options of the group. Options without a logger or metric scope use the helper's,
+// options without a data converter keep the one set by SetDataConverter.
+func (g *WorkerGroup) SetOptions(options worker.Options) *WorkerGroup {
+	if options.DataConverter == nil {
+		options.DataConverter = g.options.DataConverter
+	}
+	g.options = options
+	return g
+}
+
+// SetDataConverter sets the data converter the group's workflows and activities use
+func (g *WorkerGroup) SetDataConverter(dataConverter encoded.DataConverter) *WorkerGroup {
+	g.options.DataConverter = dataConverter
+	return g
+}
+
+// RegisterWorkflow registers a workflow on the group only
+func (g *WorkerGroup) RegisterWorkflow(workflow interface{}) *WorkerGroup {
+	return g.RegisterWorkflowWithAlias(workflow, "")
+}
+
+// RegisterWorkflowWithAlias registers a workflow under the given name on the group only
+func (g *WorkerGroup) RegisterWorkflowWithAlias(workflow interface{}, alias string) *WorkerGroup {
+	g.workflows = append(g.workflows, registryOption{registry: workflow, alias: alias})
+	return g
+}
+
+// RegisterActivity registers an activity on the group only
+func (g *WorkerGroup) RegisterActivity(activity interface{}) *WorkerGroup {
+	return g.RegisterActivityWithAlias(activity, "")
+}
+
+// RegisterActivityWithAlias registers an activity under the given name on the group only
+func (g *WorkerGroup) RegisterActivityWithAlias(activity interface{}, alias string) *WorkerGroup {
+	g.activities = append(g.activities, registryOption{registry: activity, alias: alias})
+	return g
+}
+
+// spec applies the config overrides to the group and describes the worker RunWorkers starts for it
+func (g *WorkerGroup) spec(config *WorkerGroupConfig) WorkerSpec {
+	spec := WorkerSpec{
+		Domain:   g.domain,
+		TaskList: g.taskList,
+		Options:  g.options,
+		group:    g,
+	}
+	if config == nil {
+		return spec
+	}
+
+	if config.TaskList != "" {
+		spec.TaskList = config.TaskList
+	}
+	if config.MaxConcurrentActivityExecutionSize > 0 {
+		spec.Options.MaxConcurrentActivityExecutionSize = config.MaxConcurrentActivityExecutionSize
+	}
+	if config.MaxConcurrentDecisionTaskExecutionSize > 0 {
+		spec.Options.MaxConcurrentDecisionTaskExecutionSize = config.MaxConcurrentDecisionTaskExecutionSize
+	}
+	if config.MaxConcurrentSessionExecutionSize > 0 {
+		spec.Options.MaxConcurrentSessionExecutionSize = config.MaxConcurrentSessionExecutionSize
+	}
+	if config.WorkerActivitiesPerSecond > 0 {
+		spec.Options.WorkerActivitiesPerSecond = config.WorkerActivitiesPerSecond
+	}
+	if config.TaskListActivitiesPerSecond > 0 {
+		spec.Options.TaskListActivitiesPerSecond = config.TaskListActivitiesPerSecond
+	}
+	if config.WorkerDecisionTasksPerSecond > 0 {
+		spec.Options.WorkerDecisionTasksPerSecond = config.WorkerDecisionTasksPerSecond
+	}
+	if config.EnableSessionWorker != nil {
+		spec.Options.EnableSessionWorker = *config.EnableSessionWorker
+	}
+	if config.DisableStickyExecution != nil {
+		spec.Options.DisableStickyExecution = *config.DisableStickyExecution
+	}
+	return spec
+}
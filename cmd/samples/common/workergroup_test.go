@@ -0,0 +1,115 @@
+package common
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/cadence/encoded"
+	"go.uber.org/cadence/worker"
+	"go.uber.org/zap/zaptest"
+)
+
+func sharedWorkflow()      {}
+func downloadActivity()    {}
+func processFileActivity() {}
+
+type testDataConverter struct {
+	encoded.DataConverter
+}
+
+func TestRunWorkerGroups(t *testing.T) {
+	workers := fakeWorkers(t, nil)
+	enabled := true
+	h := &SampleHelper{
+		Logger: zaptest.NewLogger(t),
+		Config: Configuration{
+			DomainName: "cadence-samples",
+			WorkerGroups: map[string]*WorkerGroupConfig{
+				"host": {
+					TaskList:                           "host-1",
+					MaxConcurrentActivityExecutionSize: 2,
+					WorkerActivitiesPerSecond:          5,
+					EnableSessionWorker:                &enabled,
+				},
+			},
+		},
+	}
+	dataConverter := &testDataConverter{}
+
+	h.WorkerGroup("shared").
+		SetOptions(worker.Options{MaxConcurrentActivityExecutionSize: 10}).
+		RegisterWorkflow(sharedWorkflow).
+		RegisterActivityWithAlias(downloadActivity, "download")
+	h.WorkerGroup("host").
+		SetDomain("host-domain").
+		SetOptions(worker.Options{DisableWorkflowWorker: true, MaxConcurrentActivityExecutionSize: 100}).
+		SetDataConverter(dataConverter).
+		RegisterActivity(processFileActivity)
+	// Registrations outside of groups are not used by group workers
+	h.RegisterActivity(downloadActivity)
+	assert.Same(t, h.WorkerGroup("host"), h.WorkerGroup("host"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	require.NoError(t, h.TryRunWorkerGroups(ctx))
+
+	require.Len(t, *workers, 2)
+	shared, host := (*workers)[0], (*workers)[1]
+
+	assert.Equal(t, "cadence-samples", shared.domain)
+	assert.Equal(t, "shared", shared.taskList)
+	assert.Equal(t, 10, shared.options.MaxConcurrentActivityExecutionSize)
+	assert.Equal(t, []string{"sharedWorkflow"}, shared.workflows)
+	assert.Equal(t, []string{"download"}, shared.activities)
+	assert.Nil(t, shared.options.DataConverter)
+
+	assert.Equal(t, "host-domain", host.domain)
+	assert.Equal(t, "host-1", host.taskList)
+	assert.True(t, host.options.DisableWorkflowWorker)
+	assert.True(t, host.options.EnableSessionWorker)
+	assert.Equal(t, 2, host.options.MaxConcurrentActivityExecutionSize)
+	assert.Equal(t, 5.0, host.options.WorkerActivitiesPerSecond)
+	assert.Same(t, dataConverter, host.options.DataConverter)
+	assert.Empty(t, host.workflows)
+	assert.Equal(t, []string{"processFileActivity"}, host.activities)
+
+	for _, w := range *workers {
+		assert.True(t, w.isStopped(), w.taskList)
+	}
+}
+
+func TestRunWorkerGroupsByName(t *testing.T) {
+	workers := fakeWorkers(t, nil)
+	h := &SampleHelper{Logger: zaptest.NewLogger(t)}
+	h.WorkerGroup("shared")
+	h.WorkerGroup("host")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.NoError(t, h.TryRunWorkerGroups(ctx, "host"))
+	require.Len(t, *workers, 1)
+	assert.Equal(t, "host", (*workers)[0].taskList)
+
+	err := h.TryRunWorkerGroups(ctx, "missing")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `unknown worker group "missing"`)
+}
+
+func TestWorkerGroupSetOptionsKeepsDataConverter(t *testing.T) {
+	h := &SampleHelper{Logger: zaptest.NewLogger(t)}
+	dataConverter := &testDataConverter{}
+
+	g := h.WorkerGroup("host").
+		SetDataConverter(dataConverter).
+		SetOptions(worker.Options{MaxConcurrentActivityExecutionSize: 100})
+	assert.Same(t, dataConverter, g.options.DataConverter)
+	assert.Equal(t, 100, g.options.MaxConcurrentActivityExecutionSize)
+
+	// A converter in the options replaces the one set before
+	other := &testDataConverter{}
+	g.SetOptions(worker.Options{DataConverter: other})
+	assert.Same(t, other, g.options.DataConverter)
+}
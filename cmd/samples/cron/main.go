@@ -18,7 +18,7 @@ const (
 
 // This needs to be done as part of a bootstrap step when the process starts.
 // The workers are supposed to be long running.
-func startWorkers(h *common.SampleHelper) {
+func runWorkers(h *common.SampleHelper) {
 	// Configure worker options.
 	workerOptions := worker.Options{
 		MetricsScope: h.WorkerMetricScope,
@@ -27,7 +27,7 @@ func startWorkers(h *common.SampleHelper) {
 			WorkflowExecutionAlreadyCompletedErrorEnabled: true,
 		},
 	}
-	h.StartWorkers(h.Config.DomainName, ApplicationName, workerOptions)
+	h.RunWorkers(common.WorkerSpec{TaskList: ApplicationName, Options: workerOptions})
 }
 
 //
@@ -60,11 +60,7 @@ func main() {
 	case "worker":
 		h.RegisterWorkflow(sampleCronWorkflow)
 		h.RegisterActivity(sampleCronActivity)
-		startWorkers(&h)
-
-		// The workers are supposed to be long running process that should not exit.
-		// Use select{} to block indefinitely for samples, you can quit by CMD+C.
-		select {}
+		runWorkers(&h)
 	case "trigger":
 		startWorkflow(&h, cron)
 	}
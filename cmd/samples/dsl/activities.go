@@ -1,9 +1,36 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"reflect"
 )
 
+var contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+
+// activities are the activities DSL workflows invoke by name. The worker registers them under these names and
+// documents are validated against their signatures before they start.
+var activities = map[string]interface{}{
+	"main.sampleActivity1":      sampleActivity1,
+	"main.sampleActivity2":      sampleActivity2,
+	"main.sampleActivity3":      sampleActivity3,
+	"main.sampleActivity4":      sampleActivity4,
+	"main.sampleActivity5":      sampleActivity5,
+	"main.sampleItemsActivity":  sampleItemsActivity,
+	"main.sampleNotifyActivity": sampleNotifyActivity,
+}
+
+// Item is returned by sampleItemsActivity
+type Item struct {
+	ID    string `json:"id"`
+	Index int    `json:"index"`
+}
+
+// ItemList is the result of sampleItemsActivity
+type ItemList struct {
+	Items []Item `json:"items"`
+}
+
 func sampleActivity1(input []string) (string, error) {
 	name := "sampleActivity1"
 	fmt.Printf("Run %s with input %v \n", name, input)
@@ -33,3 +60,42 @@ func sampleActivity5(input []string) (string, error) {
 	fmt.Printf("Run %s with input %v \n", name, input)
 	return "Result_" + name, nil
 }
+
+// sampleItemsActivity takes typed arguments and returns an object, see workflow4.yaml
+func sampleItemsActivity(prefix string, count int) (ItemList, error) {
+	fmt.Printf("Run sampleItemsActivity with prefix %v and count %v \n", prefix, count)
+	var list ItemList
+	for i := 0; i < count; i++ {
+		list.Items = append(list.Items, Item{ID: fmt.Sprintf("%s-%d", prefix, i), Index: i})
+	}
+	return list, nil
+}
+
+func sampleNotifyActivity(message string, urgent bool) (bool, error) {
+	fmt.Printf("Run sampleNotifyActivity with message %q, urgent %v \n", message, urgent)
+	return true, nil
+}
+
+// activityParams returns the parameter types of an activity function without its context.Context
+func activityParams(fn interface{}) []reflect.Type {
+	fnType := reflect.TypeOf(fn)
+	var params []reflect.Type
+	for i := 0; i < fnType.NumIn(); i++ {
+		if i == 0 && fnType.In(i) == contextType {
+			continue
+		}
+		params = append(params, fnType.In(i))
+	}
+	return params
+}
+
+// takesStringSlice reports whether an activity gets its arguments as a single []string, like the sample activities.
+// Activities missing from the registry are invoked that way too.
+func takesStringSlice(name string) bool {
+	fn, ok := activities[name]
+	if !ok {
+		return true
+	}
+	params := activityParams(fn)
+	return len(params) == 1 && params[0] == reflect.TypeOf([]string(nil))
+}
@@ -0,0 +1,446 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.uber.org/cadence/workflow"
+)
+
+// defaultMaxIterations caps a While loop that does not set MaxIterations
+const defaultMaxIterations = 100
+
+type (
+	// Condition is a test over the bindings. Every part that is set has to hold: the Expr, the Variable test, then
+	// All, Any and Not. Expr is an expression like len(items) > 3. Variable is a binding name or a ${} expression,
+	// Equals, NotEquals and In compare its value formatted as a string; without them it holds when the value is
+	// truthy, i.e. not null, false, 0, "", "false" or empty.
+	Condition struct {
+		Expr      string
+		Variable  string
+		Equals    *string
+		NotEquals *string
+		In        []string
+		All       []*Condition
+		Any       []*Condition
+		Not       *Condition
+	}
+
+	// If runs Then when the Condition holds, otherwise Else if it is set.
+	If struct {
+		Condition *Condition
+		Then      *Statement
+		Else      *Statement
+	}
+
+	// Switch runs the first Case that lists the value of Variable, a binding name or a ${} expression, or Default if
+	// none does.
+	Switch struct {
+		Variable string
+		Cases    []*Case
+		Default  *Statement
+	}
+
+	// Case is a branch of a Switch.
+	Case struct {
+		Values []string
+		Body   *Statement
+	}
+
+	// ForEach runs Body for each item of the list in Variable, a binding name or a ${} expression, with the item bound
+	// to As; a string is split at commas. Parallel runs up to MaxConcurrency items at a time, unbounded when it is 0;
+	// each parallel item gets a copy of the bindings, so results bound in Body are not visible after the loop. A
+	// sequential loop continues as new after every ContinueAsNewAfter items.
+	ForEach struct {
+		Variable           string
+		As                 string
+		Body               *Statement
+		Parallel           bool
+		MaxConcurrency     int
+		ContinueAsNewAfter int
+	}
+
+	// While runs Body as long as the Condition holds, failing after MaxIterations iterations (100 by default). It
+	// continues as new after every ContinueAsNewAfter iterations.
+	While struct {
+		Condition          *Condition
+		Body               *Statement
+		MaxIterations      int
+		ContinueAsNewAfter int
+	}
+
+	// Checkpoint is where a loop continued as new: the branch taken at each Sequence, If and Switch on the way to
+	// the loop, and the iteration the new run resumes the loop at.
+	Checkpoint struct {
+		Path      []int
+		Iteration int
+	}
+
+	// runState is shared by the statements of one workflow run.
+	runState struct {
+		workflow Workflow
+		// resume is the checkpoint the run still has to reach, nil once the loop resumed
+		resume *Checkpoint
+	}
+
+	dslContextKey int
+)
+
+const (
+	runStateKey dslContextKey = iota
+	pathKey
+	nestedKey
+	sagaKey
+	policyKey
+	// documentKey is the DocumentRef a run of registryDSLWorkflow resolved
+	documentKey
+)
+
+var errContinueAsNewNotSupported = errors.New(
+	"continueAsNewAfter is only supported on loops of a DSL workflow outside of parallel blocks, try blocks and other loops")
+
+// errContinueAsNewWithCompensations fails a loop that would continue as new with compensations pending, the new run
+// could not undo the steps
+var errContinueAsNewWithCompensations = errors.New(
+	"continueAsNewAfter cannot continue the workflow as new after a step with a compensation completed")
+
+func (c *Condition) evaluate(bindings map[string]interface{}) (bool, error) {
+	if c.Expr != "" {
+		value, err := expandTemplate(wrapExpression(c.Expr), bindings)
+		if err != nil {
+			return false, err
+		}
+		if !truthy(value) {
+			return false, nil
+		}
+	}
+	if c.Variable != "" {
+		value, err := resolve(c.Variable, bindings)
+		if err != nil {
+			return false, err
+		}
+		s := formatValue(value)
+		switch {
+		case c.Equals != nil:
+			if s != *c.Equals {
+				return false, nil
+			}
+		case c.NotEquals != nil:
+			if s == *c.NotEquals {
+				return false, nil
+			}
+		case c.In != nil:
+			if !contains(c.In, s) {
+				return false, nil
+			}
+		default:
+			if !truthy(value) {
+				return false, nil
+			}
+		}
+	}
+	for _, all := range c.All {
+		if ok, err := all.evaluate(bindings); err != nil || !ok {
+			return false, err
+		}
+	}
+	if len(c.Any) > 0 {
+		anyHolds := false
+		for _, any := range c.Any {
+			ok, err := any.evaluate(bindings)
+			if err != nil {
+				return false, err
+			}
+			if ok {
+				anyHolds = true
+				break
+			}
+		}
+		if !anyHolds {
+			return false, nil
+		}
+	}
+	if c.Not != nil {
+		ok, err := c.Not.evaluate(bindings)
+		if err != nil || ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// wrapExpression puts an expression that is not written as a ${} template into one
+func wrapExpression(expr string) string {
+	if isTemplate(expr) {
+		return expr
+	}
+	return "${" + expr + "}"
+}
+
+func (i If) execute(ctx workflow.Context, bindings map[string]interface{}) error {
+	branch, ok := resumeStep(ctx)
+	if !ok {
+		branch = 1
+		holds, err := evaluateOptional(i.Condition, bindings)
+		if err != nil {
+			return err
+		}
+		if holds {
+			branch = 0
+		}
+	}
+	ctx = withPathStep(ctx, branch)
+	if branch == 0 {
+		return executeOptional(ctx, i.Then, bindings)
+	}
+	return executeOptional(ctx, i.Else, bindings)
+}
+
+func (s Switch) execute(ctx workflow.Context, bindings map[string]interface{}) error {
+	branch, ok := resumeStep(ctx)
+	if !ok {
+		branch = len(s.Cases)
+		resolved, err := resolve(s.Variable, bindings)
+		if err != nil {
+			return err
+		}
+		value := formatValue(resolved)
+		for i, c := range s.Cases {
+			if contains(c.Values, value) {
+				branch = i
+				break
+			}
+		}
+	}
+	ctx = withPathStep(ctx, branch)
+	if branch < len(s.Cases) {
+		return executeOptional(ctx, s.Cases[branch].Body, bindings)
+	}
+	return executeOptional(ctx, s.Default, bindings)
+}
+
+func (f ForEach) execute(ctx workflow.Context, bindings map[string]interface{}) error {
+	items, err := f.items(bindings)
+	if err != nil {
+		return err
+	}
+	if f.Parallel {
+		if f.ContinueAsNewAfter > 0 {
+			return errContinueAsNewNotSupported
+		}
+		return f.executeParallel(ctx, bindings, items)
+	}
+	if f.ContinueAsNewAfter > 0 && !canContinueAsNew(ctx) {
+		return errContinueAsNewNotSupported
+	}
+
+	start := resumeIteration(ctx)
+	bodyCtx := workflow.WithValue(ctx, nestedKey, true)
+	for i := start; i < len(items); i++ {
+		if f.ContinueAsNewAfter > 0 && i > start && (i-start)%f.ContinueAsNewAfter == 0 {
+			return continueAsNew(ctx, bindings, i)
+		}
+		if f.As != "" {
+			bindings[f.As] = items[i]
+		}
+		if err := executeOptional(bodyCtx, f.Body, bindings); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f ForEach) executeParallel(ctx workflow.Context, bindings map[string]interface{}, items []interface{}) error {
+	// Like a Parallel block, the first failing item cancels the others
+	childCtx, cancelHandler := workflow.WithCancel(ctx)
+	childCtx = workflow.WithValue(childCtx, nestedKey, true)
+	selector := workflow.NewSelector(ctx)
+	var itemErr error
+	pending := 0
+	for _, item := range items {
+		if f.MaxConcurrency > 0 && pending == f.MaxConcurrency {
+			selector.Select(ctx) // wait for a running item to make room
+			pending--
+			if itemErr != nil {
+				return itemErr
+			}
+		}
+
+		itemBindings := copyBindings(bindings)
+		if f.As != "" {
+			itemBindings[f.As] = item
+		}
+		selector.AddFuture(executeAsync(f.Body, childCtx, itemBindings), func(future workflow.Future) {
+			if err := future.Get(ctx, nil); err != nil {
+				cancelHandler()
+				itemErr = err
+			}
+		})
+		pending++
+	}
+
+	for ; pending > 0; pending-- {
+		selector.Select(ctx)
+		if itemErr != nil {
+			return itemErr
+		}
+	}
+	return nil
+}
+
+func (w While) execute(ctx workflow.Context, bindings map[string]interface{}) error {
+	if w.ContinueAsNewAfter > 0 && !canContinueAsNew(ctx) {
+		return errContinueAsNewNotSupported
+	}
+	maxIterations := w.MaxIterations
+	if maxIterations <= 0 {
+		maxIterations = defaultMaxIterations
+	}
+
+	start := resumeIteration(ctx)
+	bodyCtx := workflow.WithValue(ctx, nestedKey, true)
+	for i := start; ; i++ {
+		holds, err := evaluateOptional(w.Condition, bindings)
+		if err != nil {
+			return err
+		}
+		if !holds {
+			return nil
+		}
+		if i >= maxIterations {
+			return fmt.Errorf("while loop exceeded %d iterations", maxIterations)
+		}
+		if w.ContinueAsNewAfter > 0 && i > start && (i-start)%w.ContinueAsNewAfter == 0 {
+			return continueAsNew(ctx, bindings, i)
+		}
+		if err := executeOptional(bodyCtx, w.Body, bindings); err != nil {
+			return err
+		}
+	}
+}
+
+// items returns the list in Variable, a string is split at commas
+func (f ForEach) items(bindings map[string]interface{}) ([]interface{}, error) {
+	value, err := resolve(f.Variable, bindings)
+	if err != nil {
+		return nil, err
+	}
+	switch value := value.(type) {
+	case []interface{}:
+		return value, nil
+	case string:
+		var items []interface{}
+		for _, item := range splitList(value) {
+			items = append(items, item)
+		}
+		return items, nil
+	case nil:
+		return nil, nil
+	}
+	return nil, fmt.Errorf("foreach over %v, which is a %v and not a list", f.Variable, typeName(value))
+}
+
+// evaluateOptional evaluates a condition, a missing condition holds
+func evaluateOptional(c *Condition, bindings map[string]interface{}) (bool, error) {
+	if c == nil {
+		return true, nil
+	}
+	return c.evaluate(bindings)
+}
+
+func executeOptional(ctx workflow.Context, s *Statement, bindings map[string]interface{}) error {
+	if s == nil {
+		return nil
+	}
+	return s.execute(ctx, bindings)
+}
+
+// withPathStep records the branch taken at a Sequence, If or Switch, a loop that continues as new saves the path
+// so the new run takes the same branches back to it
+func withPathStep(ctx workflow.Context, step int) workflow.Context {
+	parent, _ := ctx.Value(pathKey).([]int)
+	path := make([]int, len(parent), len(parent)+1)
+	copy(path, parent)
+	return workflow.WithValue(ctx, pathKey, append(path, step))
+}
+
+// resumeStep returns the branch the checkpoint took at this statement while a continued run is on its way back to
+// the loop
+func resumeStep(ctx workflow.Context) (int, bool) {
+	state, _ := ctx.Value(runStateKey).(*runState)
+	if state == nil || state.resume == nil {
+		return 0, false
+	}
+	path, _ := ctx.Value(pathKey).([]int)
+	if len(path) >= len(state.resume.Path) {
+		return 0, false
+	}
+	return state.resume.Path[len(path)], true
+}
+
+// resumeIteration returns the iteration a continued run resumes the loop at, 0 for a loop that did not continue
+func resumeIteration(ctx workflow.Context) int {
+	state, _ := ctx.Value(runStateKey).(*runState)
+	if state == nil || state.resume == nil {
+		return 0
+	}
+	path, _ := ctx.Value(pathKey).([]int)
+	if len(path) != len(state.resume.Path) {
+		return 0
+	}
+	iteration := state.resume.Iteration
+	state.resume = nil
+	return iteration
+}
+
+func canContinueAsNew(ctx workflow.Context) bool {
+	state, _ := ctx.Value(runStateKey).(*runState)
+	nested, _ := ctx.Value(nestedKey).(bool)
+	return state != nil && !nested
+}
+
+func continueAsNew(ctx workflow.Context, bindings map[string]interface{}, iteration int) error {
+	if compensations, ok := ctx.Value(sagaKey).(*saga); ok && len(compensations.compensations) > 0 {
+		return errContinueAsNewWithCompensations
+	}
+	state := ctx.Value(runStateKey).(*runState)
+	path, _ := ctx.Value(pathKey).([]int)
+	next := state.workflow
+	next.Variables = copyBindings(bindings)
+	next.Checkpoint = &Checkpoint{Path: path, Iteration: iteration}
+	workflow.GetLogger(ctx).Info("DSL Workflow continues as new.")
+	if ref, ok := ctx.Value(documentKey).(DocumentRef); ok {
+		// A run of a registry document loads the same version again
+		ref.Variables, ref.Checkpoint = next.Variables, next.Checkpoint
+		return workflow.NewContinueAsNewError(ctx, registryDSLWorkflow, ref)
+	}
+	return workflow.NewContinueAsNewError(ctx, simpleDSLWorkflow, next)
+}
+
+func copyBindings(bindings map[string]interface{}) map[string]interface{} {
+	c := make(map[string]interface{}, len(bindings))
+	for k, v := range bindings {
+		c[k] = v
+	}
+	return c
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/cadence/activity"
+	"go.uber.org/cadence/testsuite"
+	"go.uber.org/cadence/workflow"
+)
+
+// activityRecorder records the input of every activity call, the result is the joined input unless results lists
+// one for the call
+type activityRecorder struct {
+	sync.Mutex
+	calls   []string
+	results []string
+}
+
+func (r *activityRecorder) activity(input []string) (string, error) {
+	r.Lock()
+	defer r.Unlock()
+	call := strings.Join(input, ",")
+	r.calls = append(r.calls, call)
+	if len(r.results) > 0 {
+		result := r.results[0]
+		r.results = r.results[1:]
+		return result, nil
+	}
+	return call, nil
+}
+
+func newRecorderEnv(recorder *activityRecorder) *testsuite.TestWorkflowEnvironment {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	env.RegisterActivityWithOptions(recorder.activity, activity.RegisterOptions{Name: "recordActivity"})
+	env.SetTestTimeout(10 * time.Second)
+	return env
+}
+
+func executeStatement(env *testsuite.TestWorkflowEnvironment, s Statement, bindings map[string]interface{}) {
+	env.ExecuteWorkflow(func(ctx workflow.Context) error {
+		ctx = workflow.WithActivityOptions(ctx, workflow.ActivityOptions{
+			ScheduleToStartTimeout: time.Minute,
+			StartToCloseTimeout:    time.Minute,
+		})
+		return s.execute(ctx, bindings)
+	})
+}
+
+func record(args ...string) *Statement {
+	return &Statement{Activity: &ActivityInvocation{Name: "recordActivity", Arguments: args}}
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
+
+func TestIfAndSwitch(t *testing.T) {
+	tests := []struct {
+		name      string
+		statement Statement
+		want      []string
+	}{
+		{
+			name: "if then",
+			statement: Statement{If: &If{
+				Condition: &Condition{Variable: "env", Equals: stringPtr("prod")},
+				Then:      record("then"),
+				Else:      record("else"),
+			}},
+			want: []string{"prod"},
+		},
+		{
+			name: "if else",
+			statement: Statement{If: &If{
+				Condition: &Condition{All: []*Condition{{Variable: "approved"}, {Variable: "env", In: []string{"dev"}}}},
+				Then:      record("then"),
+				Else:      record("else"),
+			}},
+			want: []string{"nope"},
+		},
+		{
+			name: "if without else",
+			statement: Statement{If: &If{
+				Condition: &Condition{Not: &Condition{Variable: "env", NotEquals: stringPtr("prod")}},
+				Then:      record("approved"),
+			}},
+			want: []string{"false"},
+		},
+		{
+			name: "switch case",
+			statement: Statement{Switch: &Switch{
+				Variable: "env",
+				Cases: []*Case{
+					{Values: []string{"dev", "staging"}, Body: record("then")},
+					{Values: []string{"prod"}, Body: record("approved")},
+				},
+				Default: record("else"),
+			}},
+			want: []string{"false"},
+		},
+		{
+			name: "switch default",
+			statement: Statement{Switch: &Switch{
+				Variable: "approved",
+				Cases:    []*Case{{Values: []string{"true"}, Body: record("then")}},
+				Default:  record("else"),
+			}},
+			want: []string{"nope"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := &activityRecorder{}
+			env := newRecorderEnv(recorder)
+			bindings := map[string]interface{}{"env": "prod", "approved": "false", "then": "prod", "else": "nope"}
+			executeStatement(env, tt.statement, bindings)
+
+			require.True(t, env.IsWorkflowCompleted())
+			require.NoError(t, env.GetWorkflowError())
+			assert.Equal(t, tt.want, recorder.calls)
+		})
+	}
+}
+
+func TestForEach(t *testing.T) {
+	for _, parallel := range []bool{false, true} {
+		recorder := &activityRecorder{}
+		env := newRecorderEnv(recorder)
+		statement := Statement{ForEach: &ForEach{
+			Variable:       "hosts",
+			As:             "host",
+			Parallel:       parallel,
+			MaxConcurrency: 2,
+			Body:           record("host", "action"),
+		}}
+		executeStatement(env, statement, map[string]interface{}{"hosts": "a, b,c,", "action": "drain"})
+
+		require.True(t, env.IsWorkflowCompleted())
+		require.NoError(t, env.GetWorkflowError())
+		assert.ElementsMatch(t, []string{"a,drain", "b,drain", "c,drain"}, recorder.calls)
+	}
+}
+
+func TestWhileIterationCap(t *testing.T) {
+	recorder := &activityRecorder{results: []string{"pending", "done"}}
+	env := newRecorderEnv(recorder)
+	body := record("status")
+	body.Activity.Result = "status"
+	statement := Statement{While: &While{
+		Condition: &Condition{Variable: "status", NotEquals: stringPtr("done")},
+		Body:      body,
+	}}
+	executeStatement(env, statement, map[string]interface{}{"status": "new"})
+	require.NoError(t, env.GetWorkflowError())
+	assert.Equal(t, []string{"new", "pending"}, recorder.calls)
+
+	recorder = &activityRecorder{}
+	env = newRecorderEnv(recorder)
+	statement.While.MaxIterations = 3
+	executeStatement(env, statement, map[string]interface{}{"status": "new"})
+	require.Error(t, env.GetWorkflowError())
+	assert.Contains(t, env.GetWorkflowError().Error(), "while loop exceeded 3 iterations")
+	assert.Len(t, recorder.calls, 3)
+}
+
+func TestLoopContinueAsNew(t *testing.T) {
+	dslWorkflow := Workflow{
+		Variables: map[string]interface{}{"hosts": "a,b,c", "step": "start"},
+		Root: Statement{Sequence: &Sequence{Elements: []*Statement{
+			record("step"),
+			{If: &If{
+				Condition: &Condition{Variable: "hosts"},
+				Then: &Statement{ForEach: &ForEach{
+					Variable:           "hosts",
+					As:                 "host",
+					Body:               record("host"),
+					ContinueAsNewAfter: 2,
+				}},
+			}},
+			record("host"),
+		}}},
+	}
+
+	recorder := &activityRecorder{}
+	env := newRecorderEnv(recorder)
+	env.ExecuteWorkflow(simpleDSLWorkflow, dslWorkflow)
+	var continueAsNew *workflow.ContinueAsNewError
+	require.True(t, errors.As(env.GetWorkflowError(), &continueAsNew))
+	assert.Equal(t, []string{"start", "a", "b"}, recorder.calls)
+
+	next := continueAsNew.Args()[0].(Workflow)
+	assert.Equal(t, &Checkpoint{Path: []int{1, 0}, Iteration: 2}, next.Checkpoint)
+	assert.Equal(t, "b", next.Variables["host"])
+
+	// The next run resumes the loop at c and carries on with the rest of the sequence
+	recorder = &activityRecorder{}
+	env = newRecorderEnv(recorder)
+	env.ExecuteWorkflow(simpleDSLWorkflow, next)
+	require.NoError(t, env.GetWorkflowError())
+	assert.Equal(t, []string{"c", "c"}, recorder.calls)
+}
+
+func TestContinueAsNewKeepsQueries(t *testing.T) {
+	dslWorkflow := Workflow{
+		Variables: map[string]interface{}{"hosts": "a,b,c", "host": "none"},
+		Root: Statement{Sequence: &Sequence{Elements: []*Statement{
+			{Query: &Query{Name: "host", Variable: "host"}},
+			{Sequence: &Sequence{Elements: []*Statement{
+				{Query: &Query{Name: "hosts", Variable: "hosts"}},
+			}}},
+			{ForEach: &ForEach{
+				Variable:           "hosts",
+				As:                 "host",
+				Body:               &Statement{Sleep: &Sleep{Duration: "1h"}},
+				ContinueAsNewAfter: 2,
+			}},
+		}}},
+	}
+
+	env := newRecorderEnv(&activityRecorder{})
+	env.ExecuteWorkflow(simpleDSLWorkflow, dslWorkflow)
+	var continueAsNew *workflow.ContinueAsNewError
+	require.True(t, errors.As(env.GetWorkflowError(), &continueAsNew))
+	next := continueAsNew.Args()[0].(Workflow)
+
+	// The next run resumes the loop and still answers the queries registered before it
+	env = newRecorderEnv(&activityRecorder{})
+	env.RegisterDelayedCallback(func() {
+		for name, expected := range map[string]string{"host": "c", "hosts": "a,b,c"} {
+			result, err := env.QueryWorkflow(name)
+			require.NoError(t, err)
+			var value string
+			require.NoError(t, result.Get(&value))
+			assert.Equal(t, expected, value, name)
+		}
+	}, 30*time.Minute)
+	env.ExecuteWorkflow(simpleDSLWorkflow, next)
+	require.NoError(t, env.GetWorkflowError())
+}
+
+func TestContinueAsNewInParallel(t *testing.T) {
+	recorder := &activityRecorder{}
+	env := newRecorderEnv(recorder)
+	env.ExecuteWorkflow(simpleDSLWorkflow, Workflow{
+		Variables: map[string]interface{}{"hosts": "a,b,c"},
+		Root: Statement{Parallel: &Parallel{Branches: []*Statement{
+			{ForEach: &ForEach{Variable: "hosts", Body: record("hosts"), ContinueAsNewAfter: 1}},
+		}}},
+	})
+	require.Error(t, env.GetWorkflowError())
+	assert.Contains(t, env.GetWorkflowError().Error(), errContinueAsNewNotSupported.Error())
+	assert.Empty(t, recorder.calls)
+}
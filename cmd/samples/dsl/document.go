@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"gopkg.in/yaml.v2"
+)
+
+// parseWorkflow decodes a YAML or JSON DSL document, ignoring fields it does not know. See decodeWorkflow.
+func parseWorkflow(data []byte) (Workflow, error) {
+	return decodeWorkflow(data, false)
+}
+
+// decodeWorkflow decodes a DSL document. A document that starts with { is JSON, any other is YAML; both use the
+// lowercased field names, e.g. continueasnewafter, see dsl.schema.json. Strict decoding rejects fields the document
+// types do not have, which the default decoding drops silently, and duplicate YAML keys. Variables are converted into
+// JSON values, the YAML decoder returns objects with interface{} keys that cannot be sent as workflow input.
+func decodeWorkflow(data []byte, strict bool) (Workflow, error) {
+	var w Workflow
+	if isJSON(data) {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		if strict {
+			decoder.DisallowUnknownFields()
+		}
+		if err := decoder.Decode(&w); err != nil {
+			return Workflow{}, fmt.Errorf("failed to unmarshal dsl config: %w", err)
+		}
+	} else {
+		unmarshal := yaml.Unmarshal
+		if strict {
+			unmarshal = yaml.UnmarshalStrict
+		}
+		if err := unmarshal(data, &w); err != nil {
+			return Workflow{}, fmt.Errorf("failed to unmarshal dsl config: %w", err)
+		}
+	}
+	normalizeVariables(&w)
+	return w, nil
+}
+
+func isJSON(data []byte) bool {
+	trimmed := bytes.TrimSpace(data)
+	return len(trimmed) > 0 && trimmed[0] == '{'
+}
+
+func normalizeVariables(w *Workflow) {
+	for k, v := range w.Variables {
+		w.Variables[k] = normalizeValue(v)
+	}
+	for _, doc := range w.Documents {
+		normalizeVariables(doc)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeJSONAndYAML(t *testing.T) {
+	yamlData, err := os.ReadFile("workflow1.yaml")
+	require.NoError(t, err)
+	jsonData, err := os.ReadFile("workflow1.json")
+	require.NoError(t, err)
+
+	fromYAML, err := decodeWorkflow(yamlData, true)
+	require.NoError(t, err)
+	fromJSON, err := decodeWorkflow(jsonData, true)
+	require.NoError(t, err)
+	assert.Equal(t, fromYAML, fromJSON)
+	assert.Equal(t, "main.sampleActivity1", fromJSON.Root.Sequence.Elements[0].Activity.Name)
+}
+
+func TestDecodeStrict(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{
+			name: "yaml",
+			data: `
+root:
+  activity:
+    name: main.sampleActivity1
+    argument: [arg1]
+`,
+			want: "field argument not found in type main.ActivityInvocation",
+		},
+		{
+			name: "yaml duplicate key",
+			data: `
+root:
+  activity:
+    name: main.sampleActivity1
+    name: main.sampleActivity2
+`,
+			want: "field name already set in type main.ActivityInvocation",
+		},
+		{
+			name: "json",
+			data: `{"root": {"sequence": {"elements": [], "options": {"local": true}}}}`,
+			want: `unknown field "options"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decodeWorkflow([]byte(tt.data), false)
+			require.NoError(t, err)
+
+			_, err = decodeWorkflow([]byte(tt.data), true)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.want)
+		})
+	}
+}
+
+func TestDecodeJSONVariables(t *testing.T) {
+	w, err := decodeWorkflow([]byte(`{
+		"variables": {"count": 3, "item": {"id": "a", "tags": ["x"]}},
+		"root": {"activity": {"name": "main.sampleItemsActivity", "arguments": ["item", "count"]}}
+	}`), true)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"count": float64(3),
+		"item":  map[string]interface{}{"id": "a", "tags": []interface{}{"x"}},
+	}, w.Variables)
+}
@@ -0,0 +1,803 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// The expression language reads bindings and computes values for arguments, conditions and result extraction.
+// Values are JSON values: nil, bool, float64, string, []interface{} and map[string]interface{}. It has no side
+// effects and no access to time or randomness, so evaluating an expression is deterministic.
+//
+//	expr    := or
+//	or      := and { "||" and }
+//	and     := cmp { "&&" cmp }
+//	cmp     := sum [ ( "==" | "!=" | "<" | "<=" | ">" | ">=" ) sum ]
+//	sum     := product { ( "+" | "-" ) product }
+//	product := unary { ( "*" | "/" | "%" ) unary }
+//	unary   := ( "!" | "-" ) unary | postfix
+//	postfix := primary { "." ident | "[" expr "]" }
+//	primary := number | string | "true" | "false" | "null" | ident | ident "(" [ expr { "," expr } ] ")" |
+//	           "(" expr ")" | "[" [ expr { "," expr } ] "]"
+//
+// The functions are len(value), contains(list or string or object, value), string(value) and number(value).
+
+type (
+	expression interface {
+		eval(bindings map[string]interface{}) (interface{}, error)
+	}
+
+	literalExpr  struct{ value interface{} }
+	variableExpr struct{ name string }
+	fieldExpr    struct {
+		target expression
+		field  string
+	}
+	indexExpr struct{ target, index expression }
+	listExpr  struct{ elements []expression }
+	callExpr  struct {
+		name string
+		args []expression
+	}
+	unaryExpr struct {
+		op      string
+		operand expression
+	}
+	binaryExpr struct {
+		op          string
+		left, right expression
+	}
+
+	token struct {
+		kind  tokenKind
+		text  string
+		value interface{}
+		pos   int
+	}
+
+	tokenKind int
+
+	parser struct {
+		source string
+		tokens []token
+		pos    int
+	}
+)
+
+const (
+	tokenEOF tokenKind = iota
+	tokenNumber
+	tokenString
+	tokenIdent
+	tokenOperator
+)
+
+var operators = []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "+", "-", "*", "/", "%", "!", ".", ",", "(", ")", "[", "]"}
+
+// parseExpression parses an expression without the ${} around it
+func parseExpression(source string) (expression, error) {
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{source: source, tokens: tokens}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, p.errorf(t, "unexpected %q", t.text)
+	}
+	return expr, nil
+}
+
+// evaluate parses and evaluates an expression
+func evaluate(source string, bindings map[string]interface{}) (interface{}, error) {
+	expr, err := parseExpression(source)
+	if err != nil {
+		return nil, err
+	}
+	return expr.eval(bindings)
+}
+
+// isTemplate reports whether s contains an expression in ${}
+func isTemplate(s string) bool {
+	return strings.Contains(s, "${")
+}
+
+// parseTemplate splits s into its text and the expressions in ${}, calling fn for each part in order
+func parseTemplate(s string, fn func(text string, expr expression) error) error {
+	for len(s) > 0 {
+		start := strings.Index(s, "${")
+		if start < 0 {
+			return fn(s, nil)
+		}
+		if start > 0 {
+			if err := fn(s[:start], nil); err != nil {
+				return err
+			}
+		}
+		end := strings.Index(s[start:], "}")
+		if end < 0 {
+			return fmt.Errorf("unterminated ${ in %q", s)
+		}
+		expr, err := parseExpression(s[start+2 : start+end])
+		if err != nil {
+			return err
+		}
+		if err := fn("", expr); err != nil {
+			return err
+		}
+		s = s[start+end+1:]
+	}
+	return nil
+}
+
+// expandTemplate evaluates the expressions in s. A string that is a single ${} expression keeps the type of its
+// value, otherwise the values are formatted into the string.
+func expandTemplate(s string, bindings map[string]interface{}) (interface{}, error) {
+	trimmed := strings.TrimSpace(s)
+	if strings.HasPrefix(trimmed, "${") && strings.Index(trimmed, "}") == len(trimmed)-1 {
+		return evaluate(trimmed[2:len(trimmed)-1], bindings)
+	}
+
+	var b strings.Builder
+	err := parseTemplate(s, func(text string, expr expression) error {
+		if expr == nil {
+			b.WriteString(text)
+			return nil
+		}
+		value, err := expr.eval(bindings)
+		if err != nil {
+			return err
+		}
+		b.WriteString(formatValue(value))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return b.String(), nil
+}
+
+// resolve returns the value a reference stands for: the binding it names, or the value of a ${} template
+func resolve(ref string, bindings map[string]interface{}) (interface{}, error) {
+	if isTemplate(ref) {
+		return expandTemplate(ref, bindings)
+	}
+	return bindings[ref], nil
+}
+
+func tokenize(source string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(source); {
+		c := rune(source[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case unicode.IsDigit(c):
+			start := i
+			for i < len(source) && (unicode.IsDigit(rune(source[i])) || source[i] == '.') {
+				i++
+			}
+			value, err := strconv.ParseFloat(source[start:i], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %q at %d in %q", source[start:i], start, source)
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: source[start:i], value: value, pos: start})
+		case c == '"' || c == '\'':
+			start := i
+			i++
+			var b strings.Builder
+			for i < len(source) && rune(source[i]) != c {
+				if source[i] == '\\' && i+1 < len(source) {
+					i++
+				}
+				b.WriteByte(source[i])
+				i++
+			}
+			if i >= len(source) {
+				return nil, fmt.Errorf("unterminated string at %d in %q", start, source)
+			}
+			i++
+			tokens = append(tokens, token{kind: tokenString, text: source[start:i], value: b.String(), pos: start})
+		case c == '_' || unicode.IsLetter(c):
+			start := i
+			for i < len(source) && (source[i] == '_' || unicode.IsLetter(rune(source[i])) || unicode.IsDigit(rune(source[i]))) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: source[start:i], pos: start})
+		default:
+			matched := false
+			for _, op := range operators {
+				if strings.HasPrefix(source[i:], op) {
+					tokens = append(tokens, token{kind: tokenOperator, text: op, pos: i})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("unexpected %q at %d in %q", c, i, source)
+			}
+		}
+	}
+	return append(tokens, token{kind: tokenEOF, pos: len(source)}), nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+// accept consumes the next token if it is one of the operators
+func (p *parser) accept(ops ...string) (string, bool) {
+	t := p.peek()
+	if t.kind != tokenOperator {
+		return "", false
+	}
+	for _, op := range ops {
+		if t.text == op {
+			p.pos++
+			return op, true
+		}
+	}
+	return "", false
+}
+
+func (p *parser) expect(op string) error {
+	if _, ok := p.accept(op); !ok {
+		t := p.peek()
+		return p.errorf(t, "expected %q", op)
+	}
+	return nil
+}
+
+func (p *parser) errorf(t token, format string, args ...interface{}) error {
+	return fmt.Errorf("%s at %d in %q", fmt.Sprintf(format, args...), t.pos, p.source)
+}
+
+func (p *parser) parseBinary(next func() (expression, error), ops ...string) (expression, error) {
+	left, err := next()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.accept(ops...)
+		if !ok {
+			return left, nil
+		}
+		right, err := next()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op: op, left: left, right: right}
+	}
+}
+
+func (p *parser) parseOr() (expression, error) {
+	return p.parseBinary(p.parseAnd, "||")
+}
+
+func (p *parser) parseAnd() (expression, error) {
+	return p.parseBinary(p.parseComparison, "&&")
+}
+
+func (p *parser) parseComparison() (expression, error) {
+	left, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	op, ok := p.accept("==", "!=", "<=", ">=", "<", ">")
+	if !ok {
+		return left, nil
+	}
+	right, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	return &binaryExpr{op: op, left: left, right: right}, nil
+}
+
+func (p *parser) parseSum() (expression, error) {
+	return p.parseBinary(p.parseProduct, "+", "-")
+}
+
+func (p *parser) parseProduct() (expression, error) {
+	return p.parseBinary(p.parseUnary, "*", "/", "%")
+}
+
+func (p *parser) parseUnary() (expression, error) {
+	if op, ok := p.accept("!", "-"); ok {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryExpr{op: op, operand: operand}, nil
+	}
+	return p.parsePostfix()
+}
+
+func (p *parser) parsePostfix() (expression, error) {
+	expr, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.accept("."); ok {
+			t := p.next()
+			if t.kind != tokenIdent {
+				return nil, p.errorf(t, "expected field name")
+			}
+			expr = &fieldExpr{target: expr, field: t.text}
+			continue
+		}
+		if _, ok := p.accept("["); ok {
+			index, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			expr = &indexExpr{target: expr, index: index}
+			continue
+		}
+		return expr, nil
+	}
+}
+
+func (p *parser) parsePrimary() (expression, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenNumber, tokenString:
+		return &literalExpr{value: t.value}, nil
+	case tokenIdent:
+		switch t.text {
+		case "true":
+			return &literalExpr{value: true}, nil
+		case "false":
+			return &literalExpr{value: false}, nil
+		case "null":
+			return &literalExpr{value: nil}, nil
+		}
+		if _, ok := p.accept("("); ok {
+			if _, ok := functions[t.text]; !ok {
+				return nil, p.errorf(t, "unknown function %v", t.text)
+			}
+			args, err := p.parseList(")")
+			if err != nil {
+				return nil, err
+			}
+			return &callExpr{name: t.text, args: args}, nil
+		}
+		return &variableExpr{name: t.text}, nil
+	case tokenOperator:
+		switch t.text {
+		case "(":
+			expr, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			return expr, p.expect(")")
+		case "[":
+			elements, err := p.parseList("]")
+			if err != nil {
+				return nil, err
+			}
+			return &listExpr{elements: elements}, nil
+		}
+	case tokenEOF:
+		return nil, p.errorf(t, "unexpected end of expression")
+	}
+	return nil, p.errorf(t, "unexpected %q", t.text)
+}
+
+func (p *parser) parseList(end string) ([]expression, error) {
+	var list []expression
+	if _, ok := p.accept(end); ok {
+		return list, nil
+	}
+	for {
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, expr)
+		if _, ok := p.accept(","); !ok {
+			return list, p.expect(end)
+		}
+	}
+}
+
+func (e *literalExpr) eval(map[string]interface{}) (interface{}, error) {
+	return e.value, nil
+}
+
+func (e *variableExpr) eval(bindings map[string]interface{}) (interface{}, error) {
+	value, ok := bindings[e.name]
+	if !ok {
+		return nil, fmt.Errorf("unbound variable %v", e.name)
+	}
+	return value, nil
+}
+
+func (e *fieldExpr) eval(bindings map[string]interface{}) (interface{}, error) {
+	target, err := e.target.eval(bindings)
+	if err != nil {
+		return nil, err
+	}
+	object, ok := target.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("cannot read field %v of %v", e.field, typeName(target))
+	}
+	return object[e.field], nil
+}
+
+func (e *indexExpr) eval(bindings map[string]interface{}) (interface{}, error) {
+	target, err := e.target.eval(bindings)
+	if err != nil {
+		return nil, err
+	}
+	index, err := e.index.eval(bindings)
+	if err != nil {
+		return nil, err
+	}
+	switch target := target.(type) {
+	case []interface{}:
+		i, ok := index.(float64)
+		if !ok || i != math.Trunc(i) {
+			return nil, fmt.Errorf("list index %v is not an integer", formatValue(index))
+		}
+		if i < 0 || int(i) >= len(target) {
+			return nil, fmt.Errorf("list index %v out of range [0:%d]", i, len(target))
+		}
+		return target[int(i)], nil
+	case map[string]interface{}:
+		key, ok := index.(string)
+		if !ok {
+			return nil, fmt.Errorf("object key %v is not a string", formatValue(index))
+		}
+		return target[key], nil
+	default:
+		return nil, fmt.Errorf("cannot index %v", typeName(target))
+	}
+}
+
+func (e *listExpr) eval(bindings map[string]interface{}) (interface{}, error) {
+	list := make([]interface{}, 0, len(e.elements))
+	for _, element := range e.elements {
+		value, err := element.eval(bindings)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, value)
+	}
+	return list, nil
+}
+
+func (e *callExpr) eval(bindings map[string]interface{}) (interface{}, error) {
+	args := make([]interface{}, 0, len(e.args))
+	for _, arg := range e.args {
+		value, err := arg.eval(bindings)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, value)
+	}
+	fn := functions[e.name]
+	if len(args) != fn.arity {
+		return nil, fmt.Errorf("%v takes %d arguments, got %d", e.name, fn.arity, len(args))
+	}
+	return fn.call(args)
+}
+
+func (e *unaryExpr) eval(bindings map[string]interface{}) (interface{}, error) {
+	value, err := e.operand.eval(bindings)
+	if err != nil {
+		return nil, err
+	}
+	if e.op == "!" {
+		return !truthy(value), nil
+	}
+	n, ok := value.(float64)
+	if !ok {
+		return nil, fmt.Errorf("cannot negate %v", typeName(value))
+	}
+	return -n, nil
+}
+
+func (e *binaryExpr) eval(bindings map[string]interface{}) (interface{}, error) {
+	left, err := e.left.eval(bindings)
+	if err != nil {
+		return nil, err
+	}
+	// && and || only evaluate the right side when it decides the result
+	switch e.op {
+	case "&&":
+		if !truthy(left) {
+			return false, nil
+		}
+		right, err := e.right.eval(bindings)
+		return truthy(right), err
+	case "||":
+		if truthy(left) {
+			return true, nil
+		}
+		right, err := e.right.eval(bindings)
+		return truthy(right), err
+	}
+
+	right, err := e.right.eval(bindings)
+	if err != nil {
+		return nil, err
+	}
+	switch e.op {
+	case "==":
+		return reflect.DeepEqual(left, right), nil
+	case "!=":
+		return !reflect.DeepEqual(left, right), nil
+	case "+":
+		if l, ok := left.(string); ok {
+			return l + formatValue(right), nil
+		}
+	}
+
+	if l, ok := left.(string); ok {
+		if r, ok := right.(string); ok {
+			switch e.op {
+			case "<":
+				return l < r, nil
+			case "<=":
+				return l <= r, nil
+			case ">":
+				return l > r, nil
+			case ">=":
+				return l >= r, nil
+			}
+		}
+	}
+
+	l, lok := left.(float64)
+	r, rok := right.(float64)
+	if !lok || !rok {
+		return nil, fmt.Errorf("cannot apply %v to %v and %v", e.op, typeName(left), typeName(right))
+	}
+	switch e.op {
+	case "<":
+		return l < r, nil
+	case "<=":
+		return l <= r, nil
+	case ">":
+		return l > r, nil
+	case ">=":
+		return l >= r, nil
+	case "+":
+		return l + r, nil
+	case "-":
+		return l - r, nil
+	case "*":
+		return l * r, nil
+	case "/":
+		if r == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return l / r, nil
+	default: // %
+		if r == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return math.Mod(l, r), nil
+	}
+}
+
+// variableNames adds the names of the variables expr reads to names
+func variableNames(expr expression, names map[string]bool) {
+	switch e := expr.(type) {
+	case *variableExpr:
+		names[e.name] = true
+	case *fieldExpr:
+		variableNames(e.target, names)
+	case *indexExpr:
+		variableNames(e.target, names)
+		variableNames(e.index, names)
+	case *listExpr:
+		for _, element := range e.elements {
+			variableNames(element, names)
+		}
+	case *callExpr:
+		for _, arg := range e.args {
+			variableNames(arg, names)
+		}
+	case *unaryExpr:
+		variableNames(e.operand, names)
+	case *binaryExpr:
+		variableNames(e.left, names)
+		variableNames(e.right, names)
+	}
+}
+
+type function struct {
+	arity int
+	call  func(args []interface{}) (interface{}, error)
+}
+
+var functions = map[string]function{
+	"len": {1, func(args []interface{}) (interface{}, error) {
+		switch v := args[0].(type) {
+		case string:
+			return float64(len(v)), nil
+		case []interface{}:
+			return float64(len(v)), nil
+		case map[string]interface{}:
+			return float64(len(v)), nil
+		case nil:
+			return float64(0), nil
+		}
+		return nil, fmt.Errorf("len of %v", typeName(args[0]))
+	}},
+	"contains": {2, func(args []interface{}) (interface{}, error) {
+		switch v := args[0].(type) {
+		case string:
+			return strings.Contains(v, formatValue(args[1])), nil
+		case []interface{}:
+			for _, element := range v {
+				if reflect.DeepEqual(element, args[1]) {
+					return true, nil
+				}
+			}
+			return false, nil
+		case map[string]interface{}:
+			key, ok := args[1].(string)
+			_, found := v[key]
+			return ok && found, nil
+		}
+		return nil, fmt.Errorf("contains on %v", typeName(args[0]))
+	}},
+	"string": {1, func(args []interface{}) (interface{}, error) {
+		return formatValue(args[0]), nil
+	}},
+	"number": {1, func(args []interface{}) (interface{}, error) {
+		switch v := args[0].(type) {
+		case float64:
+			return v, nil
+		case string:
+			n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			if err != nil {
+				return nil, fmt.Errorf("%q is not a number", v)
+			}
+			return n, nil
+		case bool:
+			if v {
+				return float64(1), nil
+			}
+			return float64(0), nil
+		}
+		return nil, fmt.Errorf("cannot convert %v to a number", typeName(args[0]))
+	}},
+}
+
+// truthy is false for null, false, 0, "", "false" and empty lists and objects
+func truthy(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	case string:
+		return v != "" && v != "false"
+	case []interface{}:
+		return len(v) > 0
+	case map[string]interface{}:
+		return len(v) > 0
+	}
+	return true
+}
+
+// formatValue formats a value as a string: strings as they are, null as "", other values as JSON
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
+
+func typeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "list"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// normalizeValue converts a decoded YAML or Go value into a JSON value: maps get string keys and numbers become
+// float64, so values compare the same before and after they pass through history.
+func normalizeValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		object := make(map[string]interface{}, len(v))
+		for key, element := range v {
+			object[fmt.Sprint(key)] = normalizeValue(element)
+		}
+		return object
+	case map[string]interface{}:
+		object := make(map[string]interface{}, len(v))
+		for key, element := range v {
+			object[key] = normalizeValue(element)
+		}
+		return object
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, element := range v {
+			list[i] = normalizeValue(element)
+		}
+		return list
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	case float32:
+		return float64(v)
+	case nil, bool, float64, string:
+		return v
+	}
+
+	// Any other Go value goes through JSON, like it would through history
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return fmt.Sprint(value)
+	}
+	return decoded
+}
+
+// sortedKeys returns the keys of m in order, ranging over a map in a workflow is not deterministic
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
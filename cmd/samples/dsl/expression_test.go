@@ -0,0 +1,77 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpressions(t *testing.T) {
+	bindings := normalizeValue(map[string]interface{}{
+		"result1": map[string]interface{}{
+			"items": []interface{}{
+				map[string]interface{}{"id": "a-0", "tags": []interface{}{"x"}},
+				map[string]interface{}{"id": "a-1"},
+			},
+		},
+		"count": 4,
+		"name":  "order",
+		"ok":    true,
+	}).(map[string]interface{})
+
+	tests := []struct {
+		expr string
+		want interface{}
+	}{
+		{"result1.items[0].id", "a-0"},
+		{"result1.items[count - 3]['id']", "a-1"},
+		{"result1.items[1].missing", nil},
+		{"len(result1.items) > 1 && ok", true},
+		{"len(name) == 5 || !ok", true},
+		{"count * 2 + 1", float64(9)},
+		{"count % 3", float64(1)},
+		{"-count", float64(-4)},
+		{"name + '-' + count", "order-4"},
+		{"contains(result1.items[0].tags, 'x')", true},
+		{"contains([1, 2, 3], number('2'))", true},
+		{"string(ok) == \"true\"", true},
+		{"name < 'z' && null == result1.other", true},
+		{"(1 + 2) * 3", float64(9)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			got, err := evaluate(tt.expr, bindings)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	for _, expr := range []string{"unknown", "result1.items[5]", "name.id", "count / 0", "name - 1", "len(1)"} {
+		_, err := evaluate(expr, bindings)
+		assert.Error(t, err, expr)
+	}
+	for _, expr := range []string{"count +", "foo(1)", "items[0", "'open", "a @ b"} {
+		_, err := parseExpression(expr)
+		assert.Error(t, err, expr)
+	}
+}
+
+func TestExpandTemplate(t *testing.T) {
+	bindings := map[string]interface{}{"count": float64(3), "items": []interface{}{"a", "b"}}
+
+	value, err := expandTemplate("${items}", bindings)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"a", "b"}, value)
+
+	value, err = expandTemplate("${count} items: ${items}", bindings)
+	require.NoError(t, err)
+	assert.Equal(t, `3 items: ["a","b"]`, value)
+
+	value, err = resolve("count", bindings)
+	require.NoError(t, err)
+	assert.Equal(t, float64(3), value)
+
+	_, err = expandTemplate("${count", bindings)
+	assert.Error(t, err)
+}
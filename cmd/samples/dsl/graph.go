@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// printGraph writes the execution graph of the workflow and of its documents to out, one statement per line indented
+// below the statement it belongs to
+func (w Workflow) printGraph(out io.Writer) error {
+	g := &graphWriter{out: out}
+	g.line(0, "root")
+	g.statement(&w.Root, 1)
+	if w.Output != "" {
+		g.line(1, "output %v", w.Output)
+	}
+	for _, name := range sortedDocumentNames(w.Documents) {
+		doc := w.Documents[name]
+		g.line(0, "document %v", name)
+		g.statement(&doc.Root, 1)
+		if doc.Output != "" {
+			g.line(1, "output %v", doc.Output)
+		}
+	}
+	return g.err
+}
+
+type graphWriter struct {
+	out io.Writer
+	err error
+}
+
+func (g *graphWriter) line(depth int, format string, args ...interface{}) {
+	if g.err != nil {
+		return
+	}
+	_, g.err = fmt.Fprintf(g.out, "%v%v\n", strings.Repeat("  ", depth), fmt.Sprintf(format, args...))
+}
+
+// labeled writes a branch of a statement, e.g. the else branch of an if, below a line with its label
+func (g *graphWriter) labeled(depth int, label string, s *Statement) {
+	if s == nil {
+		return
+	}
+	g.line(depth, "%v:", label)
+	g.statement(s, depth+1)
+}
+
+func (g *graphWriter) statement(s *Statement, depth int) {
+	switch {
+	case s.Activity != nil:
+		a := s.Activity
+		g.line(depth, "activity %v(%v)%v%v", a.Name, strings.Join(a.Arguments, ", "), arrow(a.Result), s.Options.describe())
+		for _, name := range sortedKeys(a.Extract) {
+			g.line(depth+1, "extract %v = %v", name, a.Extract[name])
+		}
+	case s.Sequence != nil:
+		g.line(depth, "sequence%v", s.Options.describe())
+		for _, element := range s.Sequence.Elements {
+			g.statement(element, depth+1)
+		}
+	case s.Parallel != nil:
+		g.line(depth, "parallel%v", s.Options.describe())
+		for _, branch := range s.Parallel.Branches {
+			g.statement(branch, depth+1)
+		}
+	case s.If != nil:
+		g.line(depth, "if %v%v", s.If.Condition.describe(), s.Options.describe())
+		g.labeled(depth+1, "then", s.If.Then)
+		g.labeled(depth+1, "else", s.If.Else)
+	case s.Switch != nil:
+		g.line(depth, "switch %v%v", s.Switch.Variable, s.Options.describe())
+		for _, c := range s.Switch.Cases {
+			g.labeled(depth+1, "case "+strings.Join(c.Values, ", "), c.Body)
+		}
+		g.labeled(depth+1, "default", s.Switch.Default)
+	case s.ForEach != nil:
+		f := s.ForEach
+		mode := ""
+		if f.Parallel {
+			mode = " in parallel"
+			if f.MaxConcurrency > 0 {
+				mode += fmt.Sprintf(", %d at a time", f.MaxConcurrency)
+			}
+		}
+		if f.ContinueAsNewAfter > 0 {
+			mode += fmt.Sprintf(", continue as new after %d", f.ContinueAsNewAfter)
+		}
+		g.line(depth, "foreach %v in %v%v%v", f.As, f.Variable, mode, s.Options.describe())
+		g.statement(f.Body, depth+1)
+	case s.While != nil:
+		w := s.While
+		mode := ""
+		if w.MaxIterations > 0 {
+			mode = fmt.Sprintf(", at most %d times", w.MaxIterations)
+		}
+		if w.ContinueAsNewAfter > 0 {
+			mode += fmt.Sprintf(", continue as new after %d", w.ContinueAsNewAfter)
+		}
+		g.line(depth, "while %v%v%v", w.Condition.describe(), mode, s.Options.describe())
+		g.statement(w.Body, depth+1)
+	case s.ChildWorkflow != nil:
+		c := s.ChildWorkflow
+		if c.Document != "" {
+			g.line(depth, "childworkflow document %v%v%v", c.Document, arrow(c.Result), s.Options.describe())
+		} else {
+			g.line(depth, "childworkflow %v(%v)%v%v", c.Workflow, strings.Join(c.Arguments, ", "), arrow(c.Result),
+				s.Options.describe())
+		}
+	case s.Sleep != nil:
+		g.line(depth, "sleep %v", s.Sleep.Duration)
+	case s.WaitSignal != nil:
+		timeout := ""
+		if s.WaitSignal.Timeout != "" {
+			timeout = " for at most " + s.WaitSignal.Timeout
+		}
+		g.line(depth, "waitsignal %v%v%v", s.WaitSignal.Name, timeout, arrow(s.WaitSignal.Result))
+	case s.Query != nil:
+		g.line(depth, "query %v = %v", s.Query.Name, s.Query.Variable)
+	case s.Try != nil:
+		g.line(depth, "try%v", s.Options.describe())
+		g.statement(s.Try.Body, depth+1)
+		catch := "catch"
+		if s.Try.Error != "" {
+			catch += " " + s.Try.Error
+		}
+		g.labeled(depth+1, catch, s.Try.Catch)
+		g.labeled(depth+1, "finally", s.Try.Finally)
+	default:
+		g.line(depth, "empty statement")
+	}
+	g.labeled(depth+1, "compensate", s.Compensate)
+}
+
+func arrow(result string) string {
+	if result == "" {
+		return ""
+	}
+	return " -> " + result
+}
+
+// describe returns the options that are set, in brackets
+func (o *StepOptions) describe() string {
+	if o == nil {
+		return ""
+	}
+	var parts []string
+	for _, option := range []struct{ name, value string }{
+		{"scheduletostarttimeout", o.ScheduleToStartTimeout},
+		{"starttoclosetimeout", o.StartToCloseTimeout},
+		{"heartbeattimeout", o.HeartbeatTimeout},
+		{"tasklist", o.TaskList},
+	} {
+		if option.value != "" {
+			parts = append(parts, option.name+" "+option.value)
+		}
+	}
+	if o.Local {
+		parts = append(parts, "local")
+	}
+	if r := o.RetryPolicy; r != nil {
+		retry := "retry"
+		if r.MaximumAttempts > 0 {
+			retry += fmt.Sprintf(" %d attempts", r.MaximumAttempts)
+		}
+		if r.ExpirationInterval != "" {
+			retry += " for " + r.ExpirationInterval
+		}
+		parts = append(parts, retry)
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return " [" + strings.Join(parts, ", ") + "]"
+}
+
+// describe returns the condition in one line, e.g. env == prod and not (len(items) > 3)
+func (c *Condition) describe() string {
+	if c == nil {
+		return "true"
+	}
+	var parts []string
+	if c.Expr != "" {
+		parts = append(parts, c.Expr)
+	}
+	if c.Variable != "" {
+		switch {
+		case c.Equals != nil:
+			parts = append(parts, fmt.Sprintf("%v == %v", c.Variable, *c.Equals))
+		case c.NotEquals != nil:
+			parts = append(parts, fmt.Sprintf("%v != %v", c.Variable, *c.NotEquals))
+		case c.In != nil:
+			parts = append(parts, fmt.Sprintf("%v in [%v]", c.Variable, strings.Join(c.In, ", ")))
+		default:
+			parts = append(parts, c.Variable)
+		}
+	}
+	for _, all := range c.All {
+		parts = append(parts, "("+all.describe()+")")
+	}
+	if len(c.Any) > 0 {
+		var any []string
+		for _, a := range c.Any {
+			any = append(any, "("+a.describe()+")")
+		}
+		parts = append(parts, "("+strings.Join(any, " or ")+")")
+	}
+	if c.Not != nil {
+		parts = append(parts, "not ("+c.Not.describe()+")")
+	}
+	if len(parts) == 0 {
+		return "true"
+	}
+	return strings.Join(parts, " and ")
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrintGraph(t *testing.T) {
+	w, err := parseWorkflow([]byte(`
+variables:
+  env: prod
+  hosts: a,b
+root:
+  options:
+    starttoclosetimeout: 30s
+  sequence:
+    elements:
+      - if:
+          condition:
+            variable: env
+            equals: prod
+          then:
+            foreach:
+              variable: hosts
+              as: host
+              parallel: true
+              maxconcurrency: 2
+              body:
+                activity:
+                  name: main.sampleActivity1
+                  arguments: [host]
+                  result: drained
+                compensate:
+                  activity:
+                    name: main.sampleActivity2
+                    arguments: [host]
+      - try:
+          body:
+            childworkflow:
+              document: notify
+              result: notified
+          catch:
+            sleep:
+              duration: 1m
+          error: error
+documents:
+  notify:
+    root:
+      activity:
+        name: main.sampleNotifyActivity
+        arguments: ["${'done'}", "${true}"]
+        result: sent
+      options:
+        local: true
+        retrypolicy:
+          maximumattempts: 3
+    output: sent
+`))
+	require.NoError(t, err)
+
+	var out strings.Builder
+	require.NoError(t, w.printGraph(&out))
+	assert.Equal(t, `root
+  sequence [starttoclosetimeout 30s]
+    if env == prod
+      then:
+        foreach host in hosts in parallel, 2 at a time
+          activity main.sampleActivity1(host) -> drained
+            compensate:
+              activity main.sampleActivity2(host)
+    try
+      childworkflow document notify -> notified
+      catch error:
+        sleep 1m
+document notify
+  activity main.sampleNotifyActivity(${'done'}, ${true}) -> sent [local, retry 3 attempts]
+  output sent
+`, out.String())
+}
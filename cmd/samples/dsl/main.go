@@ -1,72 +1,194 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/pborman/uuid"
 	"go.uber.org/cadence/client"
 	"go.uber.org/cadence/worker"
-	"gopkg.in/yaml.v2"
+	"go.uber.org/zap"
 
 	"github.com/uber-common/cadence-samples/cmd/samples/common"
+	"github.com/uber-common/cadence-samples/cmd/samples/dsl/registry"
 )
 
 // This needs to be done as part of a bootstrap step when the process starts.
 // The workers are supposed to be long running.
-func startWorkers(h *common.SampleHelper) {
+func runWorkers(h *common.SampleHelper, registryDir string) {
+	documents, err := registry.NewDirRegistry(registryDir)
+	if err != nil {
+		h.Logger.Error("Failed to open document registry.", zap.Error(err))
+		panic(err)
+	}
+	ctx := context.WithValue(context.Background(), registryKey, documents)
+
 	// Configure worker options.
 	workerOptions := worker.Options{
-		MetricsScope: h.WorkerMetricScope,
-		Logger:       h.Logger,
+		MetricsScope:              h.WorkerMetricScope,
+		Logger:                    h.Logger,
+		BackgroundActivityContext: ctx,
 	}
-	h.StartWorkers(h.Config.DomainName, ApplicationName, workerOptions)
+	h.RunWorkers(common.WorkerSpec{TaskList: ApplicationName, Options: workerOptions})
 }
 
-func startWorkflow(h *common.SampleHelper, w Workflow) {
+// startWorkflow starts simpleDSLWorkflow with the document, or registryDSLWorkflow with a reference to a document
+// in the registry
+func startWorkflow(h *common.SampleHelper, workflow interface{}, input interface{}) {
 	workflowOptions := client.StartWorkflowOptions{
 		ID:                              "dsl_" + uuid.New(),
 		TaskList:                        ApplicationName,
-		ExecutionStartToCloseTimeout:    time.Minute,
+		ExecutionStartToCloseTimeout:    time.Hour * 24,
 		DecisionTaskStartToCloseTimeout: time.Minute,
 	}
-	h.StartWorkflow(workflowOptions, simpleDSLWorkflow, w)
+	h.StartWorkflow(workflowOptions, workflow, input)
+}
+
+// loadWorkflow reads and validates a yaml or json config, strict rejects fields the DSL does not know
+func loadWorkflow(dslConfig string, strict bool) (Workflow, error) {
+	data, err := ioutil.ReadFile(dslConfig)
+	if err != nil {
+		return Workflow{}, fmt.Errorf("failed to load dsl config file %v", err)
+	}
+	workflow, err := decodeWorkflow(data, strict)
+	if err != nil {
+		return Workflow{}, err
+	}
+	if err := workflow.validate(); err != nil {
+		return Workflow{}, fmt.Errorf("invalid dsl config: %w", err)
+	}
+	return workflow, nil
+}
+
+// publishWorkflow validates a yaml or json config and publishes it as the next version of the document name in the registry
+func publishWorkflow(registryDir, name, dslConfig string, strict bool) error {
+	if _, err := loadWorkflow(dslConfig, strict); err != nil {
+		return err
+	}
+	data, err := ioutil.ReadFile(dslConfig)
+	if err != nil {
+		return err
+	}
+	documents, err := registry.NewDirRegistry(registryDir)
+	if err != nil {
+		return err
+	}
+	version, err := documents.Publish(context.Background(), name, data)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Published %v as %v version %d\n", dslConfig, name, version)
+	return nil
+}
+
+// validateWorkflow checks a yaml config without a cadence server and prints its execution graph
+func validateWorkflow(dslConfig string, strict bool) error {
+	workflow, err := loadWorkflow(dslConfig, strict)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%v is valid\n", dslConfig)
+	return workflow.printGraph(os.Stdout)
+}
+
+// simulateWorkflow runs a yaml config in the test suite with mocked activities, mocks is a JSON object from activity
+// names to their results
+func simulateWorkflow(dslConfig, mocks string, strict bool) error {
+	workflow, err := loadWorkflow(dslConfig, strict)
+	if err != nil {
+		return err
+	}
+	var results map[string]interface{}
+	if err := json.Unmarshal([]byte(mocks), &results); err != nil {
+		return fmt.Errorf("invalid mocked results %v", err)
+	}
+	return simulate(workflow, results, os.Stdout)
 }
 
 func main() {
-	var mode, dslConfig string
-	flag.StringVar(&mode, "m", "trigger", "Mode is worker or trigger.")
+	var mode, dslConfig, workflowID, name, input, mocks, registryDir, document string
+	var version int
+	var strict bool
+	flag.StringVar(&mode, "m", "trigger", "Mode is worker, trigger, signal, query, validate, simulate, publish or schema.")
 	flag.StringVar(&dslConfig, "dslConfig", "cmd/samples/dsl/workflow1.yaml", "dslConfig specify the yaml file for the dsl workflow.")
+	flag.StringVar(&workflowID, "w", "", "WorkflowID to signal or query.")
+	flag.StringVar(&name, "s", "", "Signal or query name.")
+	flag.StringVar(&input, "i", "null", "Signal input as JSON.")
+	flag.StringVar(&mocks, "mocks", "{}", "Mocked activity results of simulate as a JSON object from activity name to result.")
+	flag.StringVar(&registryDir, "registry", filepath.Join(os.TempDir(), "cadence-dsl-registry"), "Directory of the document registry, shared by the workers and the clients.")
+	flag.StringVar(&document, "document", "", "Name of the document to publish, or to trigger from the registry instead of the dslConfig.")
+	flag.IntVar(&version, "version", 0, "Version of the document to trigger, 0 is the latest version.")
+	flag.BoolVar(&strict, "strict", false, "Reject fields of the dslConfig the DSL does not know instead of ignoring them.")
 	flag.Parse()
 
+	// validate, simulate, publish and schema run without a cadence server
+	switch mode {
+	case "validate":
+		if err := validateWorkflow(dslConfig, strict); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	case "simulate":
+		if err := simulateWorkflow(dslConfig, mocks, strict); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	case "publish":
+		if document == "" {
+			document = strings.TrimSuffix(filepath.Base(dslConfig), filepath.Ext(dslConfig))
+		}
+		if err := publishWorkflow(registryDir, document, dslConfig, strict); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	case "schema":
+		schema, err := marshalSchema()
+		if err != nil {
+			panic(err)
+		}
+		os.Stdout.Write(schema)
+		return
+	}
+
 	var h common.SampleHelper
 	h.SetupServiceConfig()
 
 	switch mode {
 	case "worker":
 		h.RegisterWorkflow(simpleDSLWorkflow)
-		h.RegisterActivity(sampleActivity1)
-		h.RegisterActivity(sampleActivity2)
-		h.RegisterActivity(sampleActivity3)
-		h.RegisterActivity(sampleActivity4)
-		h.RegisterActivity(sampleActivity5)
-		startWorkers(&h)
-
-		// The workers are supposed to be long running process that should not exit.
-		// Use select{} to block indefinitely for samples, you can quit by CMD+C.
-		select {}
+		h.RegisterWorkflow(registryDSLWorkflow)
+		h.RegisterActivity(loadDocumentActivity)
+		for name, activity := range activities {
+			h.RegisterActivityWithAlias(activity, name)
+		}
+		runWorkers(&h, registryDir)
 	case "trigger":
-
-		data, err := ioutil.ReadFile(dslConfig)
+		if document != "" {
+			startWorkflow(&h, registryDSLWorkflow, DocumentRef{Name: document, Version: version})
+			return
+		}
+		workflow, err := loadWorkflow(dslConfig, strict)
 		if err != nil {
-			panic(fmt.Sprintf("failed to load dsl config file %v", err))
+			panic(err)
 		}
-		var workflow Workflow
-		if err := yaml.Unmarshal(data, &workflow); err != nil {
-			panic(fmt.Sprintf("failed to unmarshal dsl config %v", err))
+		startWorkflow(&h, simpleDSLWorkflow, workflow)
+	case "signal":
+		var data interface{}
+		if err := json.Unmarshal([]byte(input), &data); err != nil {
+			panic(fmt.Sprintf("invalid signal input %v", err))
 		}
-		startWorkflow(&h, workflow)
+		h.SignalWorkflow(workflowID, name, data)
+	case "query":
+		h.QueryWorkflow(workflowID, "", name)
 	}
 }
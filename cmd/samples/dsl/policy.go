@@ -0,0 +1,232 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"go.uber.org/cadence/workflow"
+	"go.uber.org/zap"
+)
+
+// defaultLocalActivityTimeout is the timeout of local activities when no startToCloseTimeout is set
+const defaultLocalActivityTimeout = time.Minute
+
+type (
+	// StepOptions change how the activities of a statement and of every statement below it run. The timeouts are
+	// durations like the one of Sleep. TaskList is the task list the activities are scheduled on, Local runs them as
+	// local activities in the worker of the workflow, with startToCloseTimeout (one minute by default) as their
+	// timeout. Options of an inner statement override the ones of the outer statements.
+	StepOptions struct {
+		ScheduleToStartTimeout string
+		StartToCloseTimeout    string
+		HeartbeatTimeout       string
+		TaskList               string
+		Local                  bool
+		RetryPolicy            *RetryPolicy
+	}
+
+	// RetryPolicy retries failed activities, waiting InitialInterval (one second by default) before the first retry
+	// and BackoffCoefficient (2 by default) times longer before each next one, up to MaximumInterval. It gives up after
+	// MaximumAttempts attempts or once ExpirationInterval passed, at least one of them has to be set, and on errors
+	// with one of the NonRetriableErrorReasons.
+	RetryPolicy struct {
+		InitialInterval          string
+		BackoffCoefficient       float64
+		MaximumInterval          string
+		ExpirationInterval       string
+		MaximumAttempts          int32
+		NonRetriableErrorReasons []string
+	}
+
+	// Try runs Body and, when it fails, the compensations of the statements in Body that completed, latest first.
+	// Catch then handles the error, with its message bound to Error; without a Catch the error is returned. Finally
+	// runs in any case. A cancelled workflow skips Catch, the compensations and Finally still run.
+	Try struct {
+		Body    *Statement
+		Catch   *Statement
+		Finally *Statement
+		Error   string
+	}
+
+	// stepPolicy is the result of the StepOptions of the statements on the way to an activity, the activity options
+	// are kept in the context by the cadence client but the ones of local activities have to be built from it
+	stepPolicy struct {
+		local               bool
+		startToCloseTimeout time.Duration
+		retryPolicy         *workflow.RetryPolicy
+	}
+
+	// saga collects the compensations of the statements that completed. Each one runs with the bindings at the
+	// time its statement completed and the options of the statement.
+	saga struct {
+		compensations []compensation
+	}
+
+	compensation struct {
+		statement *Statement
+		bindings  map[string]interface{}
+		// ctx is the context of the statement, it carries the activity options and policy of its StepOptions
+		ctx workflow.Context
+	}
+)
+
+// apply returns a context with the options set, a nil StepOptions keeps the context
+func (o *StepOptions) apply(ctx workflow.Context, bindings map[string]interface{}) (workflow.Context, error) {
+	if o == nil {
+		return ctx, nil
+	}
+	var policy stepPolicy
+	if parent, ok := ctx.Value(policyKey).(stepPolicy); ok {
+		policy = parent
+	}
+
+	for _, timeout := range []struct {
+		ref  string
+		with func(workflow.Context, time.Duration) workflow.Context
+		// keep is where the policy keeps the timeout, if it needs it
+		keep *time.Duration
+	}{
+		{o.ScheduleToStartTimeout, workflow.WithScheduleToStartTimeout, nil},
+		{o.StartToCloseTimeout, workflow.WithStartToCloseTimeout, &policy.startToCloseTimeout},
+		{o.HeartbeatTimeout, workflow.WithHeartbeatTimeout, nil},
+	} {
+		if timeout.ref == "" {
+			continue
+		}
+		d, err := resolveDuration(timeout.ref, bindings)
+		if err != nil {
+			return nil, err
+		}
+		ctx = timeout.with(ctx, d)
+		if timeout.keep != nil {
+			*timeout.keep = d
+		}
+	}
+	if o.TaskList != "" {
+		ctx = workflow.WithTaskList(ctx, o.TaskList)
+	}
+	if o.RetryPolicy != nil {
+		retryPolicy, err := o.RetryPolicy.policy(bindings)
+		if err != nil {
+			return nil, err
+		}
+		ctx = workflow.WithRetryPolicy(ctx, *retryPolicy)
+		policy.retryPolicy = retryPolicy
+	}
+	policy.local = policy.local || o.Local
+	return workflow.WithValue(ctx, policyKey, policy), nil
+}
+
+func (r *RetryPolicy) policy(bindings map[string]interface{}) (*workflow.RetryPolicy, error) {
+	policy := &workflow.RetryPolicy{
+		InitialInterval:          time.Second,
+		BackoffCoefficient:       r.BackoffCoefficient,
+		MaximumAttempts:          r.MaximumAttempts,
+		NonRetriableErrorReasons: r.NonRetriableErrorReasons,
+	}
+	if policy.BackoffCoefficient == 0 {
+		policy.BackoffCoefficient = 2
+	}
+	for _, interval := range []struct {
+		ref string
+		d   *time.Duration
+	}{
+		{r.InitialInterval, &policy.InitialInterval},
+		{r.MaximumInterval, &policy.MaximumInterval},
+		{r.ExpirationInterval, &policy.ExpirationInterval},
+	} {
+		if interval.ref == "" {
+			continue
+		}
+		d, err := resolveDuration(interval.ref, bindings)
+		if err != nil {
+			return nil, fmt.Errorf("retry policy: %w", err)
+		}
+		*interval.d = d
+	}
+	return policy, nil
+}
+
+// executeActivity runs an activity with the options of the context, as a local activity if the statements above it
+// ask for one
+func executeActivity(ctx workflow.Context, name string, args ...interface{}) workflow.Future {
+	policy, _ := ctx.Value(policyKey).(stepPolicy)
+	if !policy.local {
+		return workflow.ExecuteActivity(ctx, name, args...)
+	}
+	fn, ok := activities[name]
+	if !ok {
+		future, settable := workflow.NewFuture(ctx)
+		settable.SetError(fmt.Errorf("activity %v is not in the activities registry and cannot run as a local activity", name))
+		return future
+	}
+	timeout := policy.startToCloseTimeout
+	if timeout == 0 {
+		timeout = defaultLocalActivityTimeout
+	}
+	ctx = workflow.WithLocalActivityOptions(ctx, workflow.LocalActivityOptions{
+		ScheduleToCloseTimeout: timeout,
+		RetryPolicy:            policy.retryPolicy,
+	})
+	return workflow.ExecuteLocalActivity(ctx, fn, args...)
+}
+
+func (t Try) execute(ctx workflow.Context, bindings map[string]interface{}) error {
+	// A loop in the try block cannot continue as new, the new run would lose the compensations
+	ctx = workflow.WithValue(ctx, nestedKey, true)
+	body := &saga{}
+	err := executeOptional(workflow.WithValue(ctx, sagaKey, body), t.Body, bindings)
+	if err == nil {
+		// The compensations of the block now belong to the enclosing one, a later failure undoes the whole block
+		if parent, ok := ctx.Value(sagaKey).(*saga); ok {
+			parent.compensations = append(parent.compensations, body.compensations...)
+		}
+	} else {
+		body.compensate(ctx)
+		if ctx.Err() == nil && t.Catch != nil {
+			if t.Error != "" {
+				bindings[t.Error] = err.Error()
+			}
+			err = t.Catch.execute(ctx, bindings)
+		}
+	}
+
+	if t.Finally != nil {
+		finallyCtx := ctx
+		if ctx.Err() != nil {
+			finallyCtx, _ = workflow.NewDisconnectedContext(ctx)
+		}
+		if finallyErr := t.Finally.execute(finallyCtx, bindings); finallyErr != nil && err == nil {
+			err = finallyErr
+		}
+	}
+	return err
+}
+
+// addCompensation adds the compensation of a statement that completed to the saga of the enclosing try block or of
+// the workflow
+func addCompensation(ctx workflow.Context, s *Statement, bindings map[string]interface{}) {
+	if saga, ok := ctx.Value(sagaKey).(*saga); ok {
+		saga.compensations = append(saga.compensations, compensation{statement: s, bindings: copyBindings(bindings), ctx: ctx})
+	}
+}
+
+// compensate runs the compensations latest first, each on a context derived from the one of its statement that is
+// not cancelled with the workflow. A failing compensation is logged and does not stop the others.
+func (s *saga) compensate(ctx workflow.Context) {
+	if len(s.compensations) == 0 {
+		return
+	}
+	logger := workflow.GetLogger(ctx)
+	logger.Info("Running compensations.", zap.Int("Count", len(s.compensations)))
+	for i := len(s.compensations) - 1; i >= 0; i-- {
+		c := s.compensations[i]
+		compensationCtx, _ := workflow.NewDisconnectedContext(c.ctx)
+		// Compensations do not get compensated in turn
+		compensationCtx = workflow.WithValue(compensationCtx, sagaKey, &saga{})
+		if err := c.statement.execute(compensationCtx, c.bindings); err != nil {
+			logger.Error("Compensation failed.", zap.Error(err))
+		}
+	}
+	s.compensations = nil
+}
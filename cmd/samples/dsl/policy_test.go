@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/cadence/activity"
+	"go.uber.org/cadence/encoded"
+	"go.uber.org/cadence/testsuite"
+)
+
+// registerFailActivity registers "failActivity", which fails the first failures calls
+func registerFailActivity(env *testsuite.TestWorkflowEnvironment, failures int) *int {
+	calls := 0
+	env.RegisterActivityWithOptions(func() (string, error) {
+		calls++
+		if calls <= failures {
+			return "", errors.New("out of stock")
+		}
+		return "ok", nil
+	}, activity.RegisterOptions{Name: "failActivity"})
+	return &calls
+}
+
+func compensated(s *Statement, compensate *Statement) *Statement {
+	s.Compensate = compensate
+	return s
+}
+
+func TestTryCatchFinally(t *testing.T) {
+	recorder := &activityRecorder{}
+	env := newRecorderEnv(recorder)
+	registerFailActivity(env, 1)
+
+	env.ExecuteWorkflow(simpleDSLWorkflow, Workflow{
+		Variables: map[string]interface{}{"order": "o-1"},
+		Root: Statement{Sequence: &Sequence{Elements: []*Statement{
+			{Try: &Try{
+				Body: &Statement{Sequence: &Sequence{Elements: []*Statement{
+					compensated(record("${'reserve'}", "order"), record("${'release'}", "order")),
+					compensated(record("${'charge'}", "order"), record("${'refund'}", "order")),
+					{Activity: &ActivityInvocation{Name: "failActivity"}},
+					compensated(record("${'ship'}", "order"), record("${'unship'}", "order")),
+				}}},
+				Catch:   record("${'caught'}", "error"),
+				Finally: record("${'finally'}"),
+				Error:   "error",
+			}},
+			record("${'after'}"),
+		}}},
+	})
+
+	require.NoError(t, env.GetWorkflowError())
+	require.Len(t, recorder.calls, 7)
+	assert.Equal(t, []string{"reserve,o-1", "charge,o-1", "refund,o-1", "release,o-1"}, recorder.calls[:4])
+	assert.Contains(t, recorder.calls[4], "caught,")
+	assert.Contains(t, recorder.calls[4], "out of stock")
+	assert.Equal(t, []string{"finally", "after"}, recorder.calls[5:])
+}
+
+func TestCompensateWorkflow(t *testing.T) {
+	recorder := &activityRecorder{}
+	env := newRecorderEnv(recorder)
+	registerFailActivity(env, 1)
+
+	env.ExecuteWorkflow(simpleDSLWorkflow, Workflow{
+		Variables: map[string]interface{}{"order": "o-1"},
+		Root: Statement{Sequence: &Sequence{Elements: []*Statement{
+			compensated(record("${'reserve'}", "order"), record("${'release'}", "order")),
+			// A try block that completed is undone as a whole when a later statement fails
+			{Try: &Try{
+				Body: compensated(record("${'charge'}", "order"), record("${'refund'}", "order")),
+				// Finally has no compensation of its own, it is not a step of the saga
+				Finally: record("${'finally'}"),
+			}},
+			{Activity: &ActivityInvocation{Name: "failActivity"}},
+		}}},
+	})
+
+	require.Error(t, env.GetWorkflowError())
+	assert.Contains(t, env.GetWorkflowError().Error(), "out of stock")
+	assert.Equal(t, []string{"reserve,o-1", "charge,o-1", "finally", "refund,o-1", "release,o-1"}, recorder.calls)
+}
+
+func TestCompensateCancelledWorkflow(t *testing.T) {
+	recorder := &activityRecorder{}
+	env := newRecorderEnv(recorder)
+	env.RegisterDelayedCallback(env.CancelWorkflow, time.Hour)
+
+	env.ExecuteWorkflow(simpleDSLWorkflow, Workflow{
+		Root: Statement{Sequence: &Sequence{Elements: []*Statement{
+			compensated(record("${'reserve'}"), record("${'release'}")),
+			{Try: &Try{
+				Body: &Statement{Sequence: &Sequence{Elements: []*Statement{
+					compensated(record("${'charge'}"), record("${'refund'}")),
+					{WaitSignal: &WaitSignal{Name: "approve"}},
+				}}},
+				Catch:   record("${'caught'}"),
+				Finally: record("${'finally'}"),
+			}},
+			record("${'after'}"),
+		}}},
+	})
+
+	require.Error(t, env.GetWorkflowError())
+	assert.Equal(t, []string{"reserve", "charge", "refund", "finally", "release"}, recorder.calls)
+}
+
+func TestCompensationKeepsStepOptions(t *testing.T) {
+	recorder := &activityRecorder{}
+	env := newRecorderEnv(recorder)
+	registerFailActivity(env, 1)
+	taskLists := map[string]string{}
+	env.SetOnActivityStartedListener(func(info *activity.Info, ctx context.Context, args encoded.Values) {
+		var input []string
+		if args.HasValues() && args.Get(&input) == nil && len(input) > 0 {
+			taskLists[input[0]] = info.TaskList
+		}
+	})
+
+	step := compensated(record("${'reserve'}"), record("${'release'}"))
+	step.Options = &StepOptions{TaskList: "special"}
+	env.ExecuteWorkflow(simpleDSLWorkflow, Workflow{
+		Root: Statement{Sequence: &Sequence{Elements: []*Statement{
+			{Try: &Try{
+				Body: &Statement{Sequence: &Sequence{Elements: []*Statement{
+					step,
+					{Activity: &ActivityInvocation{Name: "failActivity"}},
+				}}},
+				Catch: record("${'caught'}"),
+			}},
+		}}},
+	})
+
+	require.NoError(t, env.GetWorkflowError())
+	assert.Equal(t, []string{"reserve", "release", "caught"}, recorder.calls)
+	// The compensation runs with the options of its step, the catch block with the ones of the try block
+	assert.Equal(t, "special", taskLists["reserve"])
+	assert.Equal(t, "special", taskLists["release"])
+	assert.Equal(t, "default-test-tasklist", taskLists["caught"])
+}
+
+func TestCompensateBeforeContinueAsNew(t *testing.T) {
+	recorder := &activityRecorder{}
+	env := newRecorderEnv(recorder)
+
+	env.ExecuteWorkflow(simpleDSLWorkflow, Workflow{
+		Variables: map[string]interface{}{"hosts": "a,b"},
+		Root: Statement{Sequence: &Sequence{Elements: []*Statement{
+			compensated(record("${'reserve'}"), record("${'release'}")),
+			{ForEach: &ForEach{Variable: "hosts", Body: record("hosts"), ContinueAsNewAfter: 1}},
+		}}},
+	})
+
+	// The workflow fails instead of dropping the compensation, which then runs
+	require.Error(t, env.GetWorkflowError())
+	assert.Contains(t, env.GetWorkflowError().Error(), errContinueAsNewWithCompensations.Error())
+	assert.Equal(t, []string{"reserve", "a,b", "release"}, recorder.calls)
+}
+
+func TestStepOptions(t *testing.T) {
+	recorder := &activityRecorder{}
+	env := newRecorderEnv(recorder)
+	calls := registerFailActivity(env, 2)
+	var taskLists []string
+	env.SetOnActivityStartedListener(func(info *activity.Info, ctx context.Context, args encoded.Values) {
+		taskLists = append(taskLists, info.TaskList)
+	})
+
+	env.ExecuteWorkflow(simpleDSLWorkflow, Workflow{
+		Variables: map[string]interface{}{"message": "hello", "urgent": true},
+		Root: Statement{Sequence: &Sequence{Elements: []*Statement{
+			{
+				Activity: &ActivityInvocation{Name: "failActivity", Result: "retried"},
+				Options: &StepOptions{
+					StartToCloseTimeout: "10s",
+					TaskList:            "orders",
+					RetryPolicy:         &RetryPolicy{InitialInterval: "1s", MaximumAttempts: 3},
+				},
+			},
+			{
+				Activity: &ActivityInvocation{
+					Name:      "main.sampleNotifyActivity",
+					Arguments: []string{"message", "urgent"},
+					Result:    "notified",
+				},
+				Options: &StepOptions{Local: true},
+			},
+		}}},
+		Output: "${[retried, notified]}",
+	})
+
+	require.NoError(t, env.GetWorkflowError())
+	assert.Equal(t, 3, *calls)
+	// The local activity does not go through a task list
+	assert.Equal(t, []string{"orders", "orders", "orders"}, taskLists)
+	var output []byte
+	require.NoError(t, env.GetWorkflowResult(&output))
+	assert.JSONEq(t, `["ok", true]`, string(output))
+}
@@ -0,0 +1,204 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxPublishAttempts bounds the retries of Publish when other publishers take the next version first
+const maxPublishAttempts = 10
+
+// documentExtensions are the extensions of the document files, JSON documents are stored as .json and any other as
+// .yaml. A version is taken by creating its .reserved file, so that publishers of different formats cannot take the
+// same version.
+var documentExtensions = []string{".yaml", ".json"}
+
+const reservedExtension = ".reserved"
+
+var validName = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// DirRegistry stores each version of a document as a file in a directory per document, e.g. orders/3.yaml, or
+// orders/3.json for a JSON document. The documents are shared by every worker and client with access to the
+// directory.
+type DirRegistry struct {
+	dir string
+}
+
+// NewDirRegistry creates a registry in dir, creating the directory if needed
+func NewDirRegistry(dir string) (*DirRegistry, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create registry directory: %w", err)
+	}
+	return &DirRegistry{dir: dir}, nil
+}
+
+// Publish writes the document to a temporary file, reserves the next version and links the file to it. Reserving
+// fails if the version exists, so a version another publisher took is never replaced; Publish then tries the version
+// after it.
+func (r *DirRegistry) Publish(ctx context.Context, name string, data []byte) (int, error) {
+	dir, err := r.documentDir(name)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return 0, fmt.Errorf("failed to create document directory: %w", err)
+	}
+
+	f, err := os.CreateTemp(dir, "publish.*.tmp")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create document: %w", err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return 0, fmt.Errorf("failed to write document: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return 0, fmt.Errorf("failed to sync document: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return 0, fmt.Errorf("failed to close document: %w", err)
+	}
+
+	for attempt := 0; attempt < maxPublishAttempts; attempt++ {
+		// Reserved versions count as taken even before their document is linked
+		versions, err := r.versions(dir, append([]string{reservedExtension}, documentExtensions...)...)
+		if err != nil {
+			return 0, err
+		}
+		version := 1
+		if len(versions) > 0 {
+			version = versions[len(versions)-1] + 1
+		}
+		reservedPath := r.versionPath(dir, version, reservedExtension)
+		reserved, err := os.OpenFile(reservedPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if errors.Is(err, os.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to reserve document version: %w", err)
+		}
+		reserved.Close()
+		if err := os.Link(f.Name(), r.versionPath(dir, version, documentExtension(data))); err != nil {
+			return 0, fmt.Errorf("failed to publish document: %w", err)
+		}
+		return version, nil
+	}
+	return 0, fmt.Errorf("failed to publish document %v, %d other versions were published meanwhile", name,
+		maxPublishAttempts)
+}
+
+// Get reads a version of the document
+func (r *DirRegistry) Get(ctx context.Context, name string, version int) ([]byte, int, error) {
+	dir, err := r.documentDir(name)
+	if err != nil {
+		return nil, 0, err
+	}
+	if version < 0 {
+		return nil, 0, fmt.Errorf("invalid version %d of document %v", version, name)
+	}
+	if version == 0 {
+		versions, err := r.versions(dir, documentExtensions...)
+		if err != nil {
+			return nil, 0, err
+		}
+		if len(versions) == 0 {
+			return nil, 0, fmt.Errorf("%w: %v", ErrNotFound, name)
+		}
+		version = versions[len(versions)-1]
+	}
+
+	for _, ext := range documentExtensions {
+		data, err := os.ReadFile(r.versionPath(dir, version, ext))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to read document: %w", err)
+		}
+		return data, version, nil
+	}
+	return nil, 0, fmt.Errorf("%w: %v version %d", ErrNotFound, name, version)
+}
+
+// Versions lists the versions of the document
+func (r *DirRegistry) Versions(ctx context.Context, name string) ([]int, error) {
+	dir, err := r.documentDir(name)
+	if err != nil {
+		return nil, err
+	}
+	versions, err := r.versions(dir, documentExtensions...)
+	if err != nil {
+		return nil, err
+	}
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("%w: %v", ErrNotFound, name)
+	}
+	return versions, nil
+}
+
+// versions returns the versions with a file of one of the extensions in the directory of a document in ascending
+// order, none if it does not exist
+func (r *DirRegistry) versions(dir string, extensions ...string) ([]int, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list document versions: %w", err)
+	}
+	seen := make(map[int]bool)
+	var versions []int
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		version, err := strconv.Atoi(strings.TrimSuffix(entry.Name(), ext))
+		if err != nil || version <= 0 || !contains(extensions, ext) || seen[version] {
+			// Temporary files of publishers, and a version reserved as well as published
+			continue
+		}
+		seen[version] = true
+		versions = append(versions, version)
+	}
+	sort.Ints(versions)
+	return versions, nil
+}
+
+// documentDir maps the name to a directory in the registry, rejecting names that could escape it
+func (r *DirRegistry) documentDir(name string) (string, error) {
+	if !validName.MatchString(name) || name == "." || name == ".." {
+		return "", fmt.Errorf("invalid document name %q", name)
+	}
+	return filepath.Join(r.dir, name), nil
+}
+
+func (r *DirRegistry) versionPath(dir string, version int, ext string) string {
+	return filepath.Join(dir, strconv.Itoa(version)+ext)
+}
+
+// documentExtension returns the extension of a document file, a document that starts with { is JSON like the DSL
+// decoder reads it
+func documentExtension(data []byte) string {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		return ".json"
+	}
+	return ".yaml"
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
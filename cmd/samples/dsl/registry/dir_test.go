@@ -0,0 +1,122 @@
+package registry
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDirRegistry(t *testing.T) {
+	ctx := context.Background()
+	dir := filepath.Join(t.TempDir(), "documents")
+	r, err := NewDirRegistry(dir)
+	require.NoError(t, err)
+
+	_, _, err = r.Get(ctx, "orders", 0)
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = r.Versions(ctx, "orders")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	version, err := r.Publish(ctx, "orders", []byte("v1"))
+	require.NoError(t, err)
+	assert.Equal(t, 1, version)
+	version, err = r.Publish(ctx, "orders", []byte("v2"))
+	require.NoError(t, err)
+	assert.Equal(t, 2, version)
+
+	// a second registry on the same directory, e.g. a worker, reads the versions
+	other, err := NewDirRegistry(dir)
+	require.NoError(t, err)
+	data, version, err := other.Get(ctx, "orders", 0)
+	require.NoError(t, err)
+	assert.Equal(t, "v2", string(data))
+	assert.Equal(t, 2, version)
+	data, version, err = other.Get(ctx, "orders", 1)
+	require.NoError(t, err)
+	assert.Equal(t, "v1", string(data))
+	assert.Equal(t, 1, version)
+	_, _, err = other.Get(ctx, "orders", 3)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	versions, err := other.Versions(ctx, "orders")
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 2}, versions)
+
+	for _, name := range []string{"", "..", "../orders", "a/b"} {
+		_, err := r.Publish(ctx, name, []byte("v1"))
+		assert.Error(t, err, name)
+	}
+	_, _, err = r.Get(ctx, "orders", -1)
+	assert.Error(t, err)
+}
+
+func TestDirRegistryFormats(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	r, err := NewDirRegistry(dir)
+	require.NoError(t, err)
+
+	_, err = r.Publish(ctx, "orders", []byte("root: {}"))
+	require.NoError(t, err)
+	version, err := r.Publish(ctx, "orders", []byte(` {"root": {}}`))
+	require.NoError(t, err)
+	assert.Equal(t, 2, version)
+
+	// Each document is stored with the extension of its format
+	for _, file := range []string{"1.yaml", "2.json"} {
+		assert.FileExists(t, filepath.Join(dir, "orders", file))
+	}
+	data, version, err := r.Get(ctx, "orders", 0)
+	require.NoError(t, err)
+	assert.Equal(t, ` {"root": {}}`, string(data))
+	assert.Equal(t, 2, version)
+	data, _, err = r.Get(ctx, "orders", 1)
+	require.NoError(t, err)
+	assert.Equal(t, "root: {}", string(data))
+	versions, err := r.Versions(ctx, "orders")
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 2}, versions)
+
+	// A reserved version is skipped by publishers but not read before its document is linked
+	reserved, err := os.Create(filepath.Join(dir, "orders", "3"+reservedExtension))
+	require.NoError(t, err)
+	require.NoError(t, reserved.Close())
+	_, version, err = r.Get(ctx, "orders", 0)
+	require.NoError(t, err)
+	assert.Equal(t, 2, version)
+	version, err = r.Publish(ctx, "orders", []byte("root: {}"))
+	require.NoError(t, err)
+	assert.Equal(t, 4, version)
+}
+
+func TestDirRegistryConcurrentPublish(t *testing.T) {
+	ctx := context.Background()
+	r, err := NewDirRegistry(t.TempDir())
+	require.NoError(t, err)
+
+	const publishers = 5
+	var wg sync.WaitGroup
+	versions := make([]int, publishers)
+	for i := 0; i < publishers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// Publishers of both formats share the versions
+			document := []byte("root: {}")
+			if i%2 == 0 {
+				document = []byte(`{"root": {}}`)
+			}
+			version, err := r.Publish(ctx, "orders", document)
+			assert.NoError(t, err)
+			versions[i] = version
+		}(i)
+	}
+	wg.Wait()
+
+	assert.ElementsMatch(t, []int{1, 2, 3, 4, 5}, versions)
+}
@@ -0,0 +1,24 @@
+package registry
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrNotFound is returned when a document, or the version asked for, is not in the registry
+var ErrNotFound = errors.New("document not found")
+
+// A Registry stores the versions of DSL documents by name. A published version never changes, so a workflow can
+// always load the version it started with again while newer versions get published. See DirRegistry for a local
+// implementation.
+type Registry interface {
+	// Publish stores data as the next version of the document, versions count up from 1, and returns that version
+	Publish(ctx context.Context, name string, data []byte) (int, error)
+
+	// Get returns the version of the document and that version, version 0 returns the latest version. It returns
+	// ErrNotFound if the document or the version does not exist.
+	Get(ctx context.Context, name string, version int) ([]byte, int, error)
+
+	// Versions returns the published versions of the document in ascending order, or ErrNotFound
+	Versions(ctx context.Context, name string) ([]int, error)
+}
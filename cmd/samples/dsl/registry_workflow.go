@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/cadence"
+	"go.uber.org/cadence/activity"
+	"go.uber.org/cadence/workflow"
+	"go.uber.org/zap"
+
+	"github.com/uber-common/cadence-samples/cmd/samples/dsl/registry"
+)
+
+type (
+	// DocumentRef names a document in the registry, Version 0 is the latest version. Variables and Checkpoint are set
+	// on the runs a loop of the document continued as new, they replace the variables of the document and resume the
+	// loop.
+	DocumentRef struct {
+		Name       string
+		Version    int
+		Variables  map[string]interface{} `json:",omitempty"`
+		Checkpoint *Checkpoint            `json:",omitempty"`
+	}
+
+	// ResolvedDocument is the version of a document the workflow runs
+	ResolvedDocument struct {
+		Name    string
+		Version int
+		Data    []byte
+	}
+
+	activityContextKey int
+)
+
+const (
+	// registryKey is the key of the document registry in the context of the activities
+	registryKey activityContextKey = iota
+)
+
+// errRegistryNotFound when the document registry is not found on context
+var errRegistryNotFound = errors.New("failed to retrieve document registry from context")
+
+// registryDSLWorkflow runs a document of the registry. The worker loads the document with an activity, its result
+// is in the history, so the run replays and continues as new with the version it loaded even once newer versions are
+// published. A loop that continues as new continues as registryDSLWorkflow, so the new run keeps the workflow type.
+// The "document" query returns the name and version the run resolved.
+func registryDSLWorkflow(ctx workflow.Context, ref DocumentRef) ([]byte, error) {
+	ao := workflow.ActivityOptions{
+		ScheduleToStartTimeout: time.Minute,
+		StartToCloseTimeout:    time.Minute,
+		RetryPolicy: &cadence.RetryPolicy{
+			InitialInterval:          time.Second,
+			BackoffCoefficient:       2,
+			ExpirationInterval:       5 * time.Minute,
+			NonRetriableErrorReasons: []string{errReasonDocumentNotFound},
+		},
+	}
+	var doc ResolvedDocument
+	err := workflow.ExecuteActivity(workflow.WithActivityOptions(ctx, ao), loadDocumentActivity, ref).Get(ctx, &doc)
+	if err != nil {
+		return nil, err
+	}
+	logger := workflow.GetLogger(ctx).With(zap.String("Document", doc.Name), zap.Int("Version", doc.Version))
+	logger.Info("Loaded DSL document.")
+
+	resolved := DocumentRef{Name: doc.Name, Version: doc.Version}
+	if err := workflow.SetQueryHandler(ctx, "document", func() (DocumentRef, error) {
+		return resolved, nil
+	}); err != nil {
+		return nil, err
+	}
+
+	w, err := parseWorkflow(doc.Data)
+	if err != nil {
+		return nil, err
+	}
+	if err := w.validate(); err != nil {
+		logger.Error("Invalid DSL document.", zap.Error(err))
+		return nil, fmt.Errorf("invalid document %v version %d: %w", doc.Name, doc.Version, err)
+	}
+	if ref.Checkpoint != nil {
+		w.Variables, w.Checkpoint = ref.Variables, ref.Checkpoint
+	}
+	return simpleDSLWorkflow(workflow.WithValue(ctx, documentKey, resolved), w)
+}
+
+// errReasonDocumentNotFound is the reason of the error loadDocumentActivity fails with for a missing document, it is
+// not retried
+const errReasonDocumentNotFound = "document not found"
+
+// loadDocumentActivity reads a version of a document from the registry of the worker
+func loadDocumentActivity(ctx context.Context, ref DocumentRef) (ResolvedDocument, error) {
+	documents, err := getRegistryFromContext(ctx)
+	if err != nil {
+		return ResolvedDocument{}, err
+	}
+	data, version, err := documents.Get(ctx, ref.Name, ref.Version)
+	if errors.Is(err, registry.ErrNotFound) {
+		return ResolvedDocument{}, cadence.NewCustomError(errReasonDocumentNotFound, err.Error())
+	}
+	if err != nil {
+		return ResolvedDocument{}, err
+	}
+	return ResolvedDocument{Name: ref.Name, Version: version, Data: data}, nil
+}
+
+func getRegistryFromContext(ctx context.Context) (registry.Registry, error) {
+	logger := activity.GetLogger(ctx)
+	documents, ok := ctx.Value(registryKey).(registry.Registry)
+	if !ok || documents == nil {
+		logger.Error("Could not retrieve document registry from context.")
+		return nil, errRegistryNotFound
+	}
+	return documents, nil
+}
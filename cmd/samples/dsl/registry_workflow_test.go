@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/cadence/activity"
+	"go.uber.org/cadence/testsuite"
+	"go.uber.org/cadence/worker"
+	"go.uber.org/cadence/workflow"
+
+	"github.com/uber-common/cadence-samples/cmd/samples/dsl/registry"
+)
+
+// versionedDocument sleeps for an hour and outputs its version
+func versionedDocument(version string) []byte {
+	return []byte(`
+variables:
+  version: ` + version + `
+root:
+  sequence:
+    elements:
+      - sleep:
+          duration: 1h
+      - activity:
+          name: main.sampleActivity1
+          arguments: [version]
+          result: ran
+output: ${[version, ran]}
+`)
+}
+
+func newRegistryEnv(t *testing.T) (*testsuite.TestWorkflowEnvironment, *registry.DirRegistry) {
+	documents, err := registry.NewDirRegistry(t.TempDir())
+	require.NoError(t, err)
+
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	env.SetWorkerOptions(worker.Options{
+		BackgroundActivityContext: context.WithValue(context.Background(), registryKey, documents),
+	})
+	env.RegisterWorkflow(simpleDSLWorkflow)
+	env.RegisterActivity(loadDocumentActivity)
+	env.RegisterActivityWithOptions(sampleActivity1, activity.RegisterOptions{Name: "main.sampleActivity1"})
+	return env, documents
+}
+
+func TestRegistryDSLWorkflow(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name    string
+		version int
+		want    string
+	}{
+		{name: "latest", version: 0, want: `["two", "Result_sampleActivity1"]`},
+		{name: "pinned", version: 1, want: `["one", "Result_sampleActivity1"]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env, documents := newRegistryEnv(t)
+			_, err := documents.Publish(ctx, "orders", versionedDocument("one"))
+			require.NoError(t, err)
+			latest, err := documents.Publish(ctx, "orders", versionedDocument("two"))
+			require.NoError(t, err)
+
+			// The run keeps the version it loaded while a newer version is published
+			env.RegisterDelayedCallback(func() {
+				_, err := documents.Publish(ctx, "orders", versionedDocument("three"))
+				require.NoError(t, err)
+
+				result, err := env.QueryWorkflow("document")
+				require.NoError(t, err)
+				var resolved DocumentRef
+				require.NoError(t, result.Get(&resolved))
+				want := DocumentRef{Name: "orders", Version: tt.version}
+				if tt.version == 0 {
+					want.Version = latest
+				}
+				assert.Equal(t, want, resolved)
+			}, time.Minute)
+
+			env.ExecuteWorkflow(registryDSLWorkflow, DocumentRef{Name: "orders", Version: tt.version})
+
+			require.NoError(t, env.GetWorkflowError())
+			var output []byte
+			require.NoError(t, env.GetWorkflowResult(&output))
+			assert.JSONEq(t, tt.want, string(output))
+		})
+	}
+}
+
+func TestRegistryDSLWorkflowContinueAsNew(t *testing.T) {
+	ctx := context.Background()
+	env, documents := newRegistryEnv(t)
+	version, err := documents.Publish(ctx, "orders", []byte(`
+variables:
+  items: a,b
+  last: none
+  ran: none
+root:
+  sequence:
+    elements:
+      - foreach:
+          variable: items
+          as: item
+          continueasnewafter: 1
+          body:
+            sequence:
+              elements:
+                - sleep:
+                    duration: 1h
+                - activity:
+                    name: main.sampleActivity1
+                    arguments: [item]
+                    result: ran
+                    extract:
+                      last: ${item}
+output: ${[last, ran]}
+`))
+	require.NoError(t, err)
+
+	env.ExecuteWorkflow(registryDSLWorkflow, DocumentRef{Name: "orders"})
+	var continueAsNew *workflow.ContinueAsNewError
+	require.True(t, errors.As(env.GetWorkflowError(), &continueAsNew))
+	// The new run is a registry run of the version this run resolved
+	assert.True(t, strings.HasSuffix(continueAsNew.WorkflowType().Name, ".registryDSLWorkflow"),
+		continueAsNew.WorkflowType().Name)
+	next := continueAsNew.Args()[0].(DocumentRef)
+	assert.Equal(t, version, next.Version)
+	assert.Equal(t, &Checkpoint{Path: []int{0}, Iteration: 1}, next.Checkpoint)
+	assert.Equal(t, "a", next.Variables["item"])
+
+	// A newer version does not change the continued run, which still answers the document query
+	_, err = documents.Publish(ctx, "orders", versionedDocument("two"))
+	require.NoError(t, err)
+	env, _ = newRegistryEnv(t)
+	env.SetWorkerOptions(worker.Options{
+		BackgroundActivityContext: context.WithValue(context.Background(), registryKey, documents),
+	})
+	env.RegisterDelayedCallback(func() {
+		result, err := env.QueryWorkflow("document")
+		require.NoError(t, err)
+		var resolved DocumentRef
+		require.NoError(t, result.Get(&resolved))
+		assert.Equal(t, DocumentRef{Name: "orders", Version: version}, resolved)
+	}, time.Minute)
+	env.ExecuteWorkflow(registryDSLWorkflow, next)
+	require.NoError(t, env.GetWorkflowError())
+	var output []byte
+	require.NoError(t, env.GetWorkflowResult(&output))
+	assert.JSONEq(t, `["b", "Result_sampleActivity1"]`, string(output))
+}
+
+func TestRegistryDSLWorkflowErrors(t *testing.T) {
+	env, documents := newRegistryEnv(t)
+	env.ExecuteWorkflow(registryDSLWorkflow, DocumentRef{Name: "orders"})
+	require.Error(t, env.GetWorkflowError())
+	assert.Contains(t, env.GetWorkflowError().Error(), errReasonDocumentNotFound)
+
+	env, documents = newRegistryEnv(t)
+	_, err := documents.Publish(context.Background(), "orders", []byte(`
+root:
+  activity:
+    name: main.unknownActivity
+`))
+	require.NoError(t, err)
+	env.ExecuteWorkflow(registryDSLWorkflow, DocumentRef{Name: "orders"})
+	require.Error(t, env.GetWorkflowError())
+	assert.Contains(t, env.GetWorkflowError().Error(), "activity main.unknownActivity is not registered")
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// schemaInternalFields are fields of the document types the runtime sets, documents do not
+var schemaInternalFields = map[reflect.Type][]string{
+	reflect.TypeOf(Workflow{}): {"Checkpoint"},
+}
+
+// workflowSchema returns the JSON Schema of DSL documents generated from the Go types, with a definition per struct
+// type. The properties are the lowercased field names the YAML decoder expects, the JSON decoder accepts them too.
+func workflowSchema() map[string]interface{} {
+	g := &schemaGenerator{definitions: map[string]interface{}{}}
+	root := g.structSchema(reflect.TypeOf(Workflow{}))
+	schema := map[string]interface{}{
+		"$schema":     "http://json-schema.org/draft-07/schema#",
+		"title":       "Cadence DSL workflow",
+		"definitions": g.definitions,
+	}
+	for k, v := range root {
+		schema[k] = v
+	}
+	return schema
+}
+
+// marshalSchema returns the schema as indented JSON, the encoder sorts the keys so the output is stable
+func marshalSchema() ([]byte, error) {
+	data, err := json.MarshalIndent(workflowSchema(), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+type schemaGenerator struct {
+	definitions map[string]interface{}
+}
+
+func (g *schemaGenerator) typeSchema(t reflect.Type) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return g.typeSchema(t.Elem())
+	case reflect.Struct:
+		g.define(t)
+		return map[string]interface{}{"$ref": "#/definitions/" + t.Name()}
+	case reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": g.typeSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.typeSchema(t.Elem())}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	}
+	// interface{}, e.g. a variable, is any JSON value
+	return map[string]interface{}{}
+}
+
+// define adds the definition of a struct type, the reference is added first so recursive types like Statement end
+func (g *schemaGenerator) define(t reflect.Type) {
+	if _, ok := g.definitions[t.Name()]; ok {
+		return
+	}
+	g.definitions[t.Name()] = nil
+	g.definitions[t.Name()] = g.structSchema(t)
+}
+
+func (g *schemaGenerator) structSchema(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() || contains(schemaInternalFields[t], field.Name) {
+			continue
+		}
+		properties[strings.ToLower(field.Name)] = g.typeSchema(field.Type)
+	}
+	return map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+}
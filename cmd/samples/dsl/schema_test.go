@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestSchemaUpToDate(t *testing.T) {
+	schema, err := marshalSchema()
+	require.NoError(t, err)
+	published, err := os.ReadFile("dsl.schema.json")
+	require.NoError(t, err)
+	assert.Equal(t, string(schema), string(published), "run ./bin/dsl -m schema > cmd/samples/dsl/dsl.schema.json")
+}
+
+func TestSchemaAcceptsSampleDocuments(t *testing.T) {
+	schema := workflowSchema()
+	for _, path := range sampleDocuments {
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		var document interface{}
+		require.NoError(t, yaml.Unmarshal(data, &document))
+		assert.NoError(t, checkSchema(schema, schema, normalizeValue(document), "$"), path)
+	}
+}
+
+func TestSchemaRejectsUnknownFields(t *testing.T) {
+	schema := workflowSchema()
+	var document interface{}
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"root": {"activity": {"name": "main.sampleActivity1", "argument": ["arg1"]}},
+		"checkpoint": {"path": [0]}
+	}`), &document))
+
+	err := checkSchema(schema, schema, document, "$")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "$.checkpoint is not allowed")
+	assert.Contains(t, err.Error(), "$.root.activity.argument is not allowed")
+}
+
+// checkSchema checks value against the parts of JSON Schema the generated schema uses
+func checkSchema(root, schema map[string]interface{}, value interface{}, path string) error {
+	if ref, ok := schema["$ref"].(string); ok {
+		definitions := root["definitions"].(map[string]interface{})
+		return checkSchema(root, definitions[strings.TrimPrefix(ref, "#/definitions/")].(map[string]interface{}), value, path)
+	}
+	if value == nil {
+		return nil
+	}
+
+	var errs []string
+	switch schema["type"] {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%v is not an object", path)
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		for key, v := range object {
+			propertySchema, ok := properties[key].(map[string]interface{})
+			if !ok {
+				propertySchema, ok = schema["additionalProperties"].(map[string]interface{})
+			}
+			if !ok {
+				errs = append(errs, fmt.Sprintf("%v.%v is not allowed", path, key))
+				continue
+			}
+			if err := checkSchema(root, propertySchema, v, path+"."+key); err != nil {
+				errs = append(errs, err.Error())
+			}
+		}
+	case "array":
+		list, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("%v is not an array", path)
+		}
+		for i, v := range list {
+			items := schema["items"].(map[string]interface{})
+			if err := checkSchema(root, items, v, fmt.Sprintf("%v[%d]", path, i)); err != nil {
+				errs = append(errs, err.Error())
+			}
+		}
+	case "string":
+		if _, ok := value.(string); !ok {
+			return fmt.Errorf("%v is not a string", path)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%v is not a boolean", path)
+		}
+	case "integer", "number":
+		n, ok := value.(float64)
+		if !ok || (schema["type"] == "integer" && n != float64(int64(n))) {
+			return fmt.Errorf("%v is not an %v", path, schema["type"])
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%v", strings.Join(errs, "\n"))
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	"go.uber.org/cadence/activity"
+	"go.uber.org/cadence/testsuite"
+	"go.uber.org/cadence/workflow"
+	"go.uber.org/zap"
+)
+
+// simulationTimeout bounds the wall clock time of a simulation, a workflow that waits for a signal without a timeout
+// never completes
+const simulationTimeout = 3 * time.Second
+
+// simulate runs the workflow in the cadence test suite with the activities of the registry mocked, without a cadence
+// server. A mocked activity returns its entry of results, a JSON value decoded into its result type, or the zero
+// value of that type. The workflow time is skipped, so timers and signal timeouts fire at once; no signals are sent.
+// A workflow that continues as new ends the simulation, the mocks would run the new run the same way. Every activity
+// call and the output or the variables of the new run are written to out.
+func simulate(w Workflow, results map[string]interface{}, out io.Writer) error {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	testSuite.SetLogger(zap.NewNop())
+	env := testSuite.NewTestWorkflowEnvironment()
+	env.SetTestTimeout(simulationTimeout)
+	env.RegisterWorkflow(simpleDSLWorkflow)
+
+	names := make([]string, 0, len(activities))
+	for name := range activities {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	// The test suite wants all activities registered before the first mock
+	for _, name := range names {
+		env.RegisterActivityWithOptions(activities[name], activity.RegisterOptions{Name: name})
+	}
+	for _, name := range names {
+		fn := activities[name]
+		mocked, err := mockActivity(name, fn, results[name], out)
+		if err != nil {
+			return err
+		}
+		args := make([]interface{}, reflect.TypeOf(fn).NumIn())
+		for i := range args {
+			args[i] = mock.Anything
+		}
+		env.OnActivity(name, args...).Return(mocked)
+	}
+
+	if err := executeSimulation(env, w); err != nil {
+		return err
+	}
+	err := env.GetWorkflowError()
+	var continueAsNew *workflow.ContinueAsNewError
+	if errors.As(err, &continueAsNew) {
+		next := continueAsNew.Args()[0].(Workflow)
+		variables, err := json.Marshal(next.Variables)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(out, "workflow continued as new with variables %s\n", variables)
+		return err
+	}
+	if err != nil {
+		fmt.Fprintf(out, "workflow failed: %v\n", err)
+		return err
+	}
+	var output []byte
+	if err := env.GetWorkflowResult(&output); err != nil {
+		return err
+	}
+	if len(output) == 0 {
+		output = []byte("null")
+	}
+	_, err = fmt.Fprintf(out, "workflow completed with output %s\n", output)
+	return err
+}
+
+// executeSimulation runs the workflow, the test suite panics when the workflow blocks for longer than the test
+// timeout
+func executeSimulation(env *testsuite.TestWorkflowEnvironment, w Workflow) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			// The panic message ends with the stack of the workflow
+			reason, _, _ := strings.Cut(fmt.Sprint(r), ", workflow stack")
+			err = fmt.Errorf("workflow did not complete, it may wait for a signal without a timeout: %v", reason)
+		}
+	}()
+	env.ExecuteWorkflow(simpleDSLWorkflow, w)
+	if !env.IsWorkflowCompleted() {
+		return fmt.Errorf("workflow did not complete")
+	}
+	return nil
+}
+
+// mockActivity returns a function with the signature of the activity fn that writes the call to out and returns
+// result
+func mockActivity(name string, fn interface{}, result interface{}, out io.Writer) (interface{}, error) {
+	fnType := reflect.TypeOf(fn)
+	if fnType.NumOut() != 2 {
+		return nil, fmt.Errorf("activity %v does not return a result and an error", name)
+	}
+	value := reflect.New(fnType.Out(0))
+	if result != nil {
+		data, err := json.Marshal(result)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, value.Interface()); err != nil {
+			return nil, fmt.Errorf("mocked result of %v: %s is not a %v", name, data, fnType.Out(0))
+		}
+	}
+	noError := reflect.Zero(fnType.Out(1))
+
+	return reflect.MakeFunc(fnType, func(args []reflect.Value) []reflect.Value {
+		var input []interface{}
+		for _, arg := range args {
+			if arg.Type() != contextType {
+				input = append(input, arg.Interface())
+			}
+		}
+		inputData, _ := json.Marshal(input)
+		resultData, _ := json.Marshal(value.Elem().Interface())
+		fmt.Fprintf(out, "activity %v %s -> %s\n", name, inputData, resultData)
+		return []reflect.Value{value.Elem(), noError}
+	}).Interface(), nil
+}
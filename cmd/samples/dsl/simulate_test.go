@@ -0,0 +1,78 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSimulate(t *testing.T) {
+	w := Workflow{
+		Variables: map[string]interface{}{"prefix": "order", "count": 2, "urgent": true},
+		Root: Statement{Sequence: &Sequence{Elements: []*Statement{
+			{Activity: &ActivityInvocation{
+				Name:      "main.sampleItemsActivity",
+				Arguments: []string{"prefix", "count"},
+				Result:    "list",
+			}},
+			{ForEach: &ForEach{
+				Variable: "${list.items}",
+				As:       "item",
+				Body: &Statement{Activity: &ActivityInvocation{
+					Name:      "main.sampleActivity1",
+					Arguments: []string{"${item.id}"},
+				}},
+			}},
+			{
+				Activity: &ActivityInvocation{
+					Name:      "main.sampleNotifyActivity",
+					Arguments: []string{"${'got ' + len(list.items)}", "urgent"},
+					Result:    "notified",
+				},
+				Options: &StepOptions{Local: true},
+			},
+			{WaitSignal: &WaitSignal{Name: "approve", Timeout: "1h"}},
+		}}},
+		Output: "${[len(list.items), notified]}",
+	}
+
+	var out strings.Builder
+	err := simulate(w, map[string]interface{}{
+		"main.sampleItemsActivity": map[string]interface{}{"items": []interface{}{
+			map[string]interface{}{"id": "a"}, map[string]interface{}{"id": "b", "index": 1},
+		}},
+	}, &out)
+	require.NoError(t, err)
+	assert.Equal(t, `activity main.sampleItemsActivity ["order",2] -> {"items":[{"id":"a","index":0},{"id":"b","index":1}]}
+activity main.sampleActivity1 [["a"]] -> ""
+activity main.sampleActivity1 [["b"]] -> ""
+activity main.sampleNotifyActivity ["got 2",true] -> false
+workflow completed with output [2,false]
+`, out.String())
+}
+
+func TestSimulateInvalidMock(t *testing.T) {
+	err := simulate(Workflow{}, map[string]interface{}{"main.sampleItemsActivity": "items"}, &strings.Builder{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `mocked result of main.sampleItemsActivity: "items" is not a main.ItemList`)
+}
+
+func TestSimulateContinueAsNew(t *testing.T) {
+	data, err := os.ReadFile("workflow3.yaml")
+	require.NoError(t, err)
+	w, err := decodeWorkflow(data, true)
+	require.NoError(t, err)
+
+	var out strings.Builder
+	require.NoError(t, simulate(w, map[string]interface{}{}, &out))
+	// The mocked status does not end the while loop, which continues as new after 2 iterations
+	assert.Contains(t, out.String(), `activity main.sampleActivity1 [["pending"]] -> ""
+activity main.sampleActivity1 [[""]] -> ""
+`)
+	assert.True(t, strings.HasSuffix(out.String(), `workflow continued as new with variables {"env":"prod",`+
+		`"hosts":"host1,host2,host3","region":"us-east","result1":"","status":""}
+`), out.String())
+}
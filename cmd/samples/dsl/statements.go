@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go.uber.org/cadence/workflow"
+)
+
+type (
+	// ChildWorkflow runs a child workflow: either the DSL document named Document, one of the Documents of the
+	// workflow, or the registered workflow type Workflow. A document gets Variables, child variable names mapped to
+	// references in the parent, on top of its own variables; a registered workflow gets Arguments. Result is bound
+	// to the output of the document or the result of the workflow. WorkflowID, TaskList, Domain and
+	// ExecutionTimeout default to a generated ID and to the task list, domain and timeout of the parent.
+	ChildWorkflow struct {
+		Document         string
+		Workflow         string
+		Variables        map[string]string
+		Arguments        []string
+		Result           string
+		WorkflowID       string
+		TaskList         string
+		Domain           string
+		ExecutionTimeout string
+	}
+
+	// Sleep waits for Duration, a reference to a duration string like "1h30m" or a number of seconds. A Duration
+	// that is not a bound variable is read as a duration itself.
+	Sleep struct {
+		Duration string
+	}
+
+	// WaitSignal waits for the signal Name and binds its input to Result. With a Timeout, a duration like the one of
+	// Sleep, it gives up after that long and binds Result to null.
+	WaitSignal struct {
+		Name    string
+		Timeout string
+		Result  string
+	}
+
+	// Query exposes the value of Variable, a binding name or a ${} expression, through the query handler Name. The
+	// handler returns the value at the time of the query.
+	Query struct {
+		Name     string
+		Variable string
+	}
+)
+
+func (c ChildWorkflow) execute(ctx workflow.Context, bindings map[string]interface{}) error {
+	info := workflow.GetInfo(ctx)
+	opts := workflow.ChildWorkflowOptions{
+		Domain:                       c.Domain,
+		TaskList:                     c.TaskList,
+		ExecutionStartToCloseTimeout: time.Duration(info.ExecutionStartToCloseTimeoutSeconds) * time.Second,
+		TaskStartToCloseTimeout:      time.Duration(info.TaskStartToCloseTimeoutSeconds) * time.Second,
+	}
+	if c.WorkflowID != "" {
+		id, err := resolve(c.WorkflowID, bindings)
+		if err != nil {
+			return err
+		}
+		opts.WorkflowID = formatValue(id)
+	}
+	if c.ExecutionTimeout != "" {
+		timeout, err := resolveDuration(c.ExecutionTimeout, bindings)
+		if err != nil {
+			return err
+		}
+		opts.ExecutionStartToCloseTimeout = timeout
+	}
+	ctx = workflow.WithChildOptions(ctx, opts)
+
+	var result interface{}
+	if c.Document != "" {
+		child, err := c.document(ctx, bindings)
+		if err != nil {
+			return err
+		}
+		var output []byte
+		if err := workflow.ExecuteChildWorkflow(ctx, simpleDSLWorkflow, child).Get(ctx, &output); err != nil {
+			return err
+		}
+		if len(output) > 0 {
+			if err := json.Unmarshal(output, &result); err != nil {
+				return fmt.Errorf("decode output of document %v: %w", c.Document, err)
+			}
+		}
+	} else {
+		var args []interface{}
+		for _, arg := range c.Arguments {
+			value, err := resolve(arg, bindings)
+			if err != nil {
+				return fmt.Errorf("argument %v of %v: %w", arg, c.Workflow, err)
+			}
+			args = append(args, value)
+		}
+		if err := workflow.ExecuteChildWorkflow(ctx, c.Workflow, args...).Get(ctx, &result); err != nil {
+			return err
+		}
+	}
+
+	if c.Result != "" {
+		bindings[c.Result] = normalizeValue(result)
+	}
+	return nil
+}
+
+// document returns the input of a child running the document, it can run the documents of the parent in turn
+func (c ChildWorkflow) document(ctx workflow.Context, bindings map[string]interface{}) (Workflow, error) {
+	state, _ := ctx.Value(runStateKey).(*runState)
+	if state == nil || state.workflow.Documents[c.Document] == nil {
+		return Workflow{}, fmt.Errorf("unknown document %v", c.Document)
+	}
+	doc := state.workflow.Documents[c.Document]
+
+	child := Workflow{
+		Variables: make(map[string]interface{}, len(doc.Variables)+len(c.Variables)),
+		Root:      doc.Root,
+		Documents: state.workflow.Documents,
+		Output:    doc.Output,
+	}
+	for k, v := range doc.Variables {
+		child.Variables[k] = v
+	}
+	for _, name := range sortedKeys(c.Variables) {
+		value, err := resolve(c.Variables[name], bindings)
+		if err != nil {
+			return Workflow{}, fmt.Errorf("variable %v of document %v: %w", name, c.Document, err)
+		}
+		child.Variables[name] = value
+	}
+	return child, nil
+}
+
+func (s Sleep) execute(ctx workflow.Context, bindings map[string]interface{}) error {
+	d, err := resolveDuration(s.Duration, bindings)
+	if err != nil {
+		return err
+	}
+	return workflow.Sleep(ctx, d)
+}
+
+func (w WaitSignal) execute(ctx workflow.Context, bindings map[string]interface{}) error {
+	var input interface{}
+	received := false
+	selector := workflow.NewSelector(ctx)
+	selector.AddReceive(workflow.GetSignalChannel(ctx, w.Name), func(c workflow.Channel, more bool) {
+		c.Receive(ctx, &input)
+		received = true
+	})
+
+	if w.Timeout != "" {
+		timeout, err := resolveDuration(w.Timeout, bindings)
+		if err != nil {
+			return err
+		}
+		timerCtx, cancelTimer := workflow.WithCancel(ctx)
+		defer cancelTimer()
+		selector.AddFuture(workflow.NewTimer(timerCtx, timeout), func(f workflow.Future) {})
+	}
+	// A cancelled workflow stops waiting, so compensations and finally blocks can run
+	selector.AddReceive(ctx.Done(), func(c workflow.Channel, more bool) {})
+	selector.Select(ctx)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	if !received {
+		workflow.GetLogger(ctx).Info("Signal wait timed out.")
+	}
+	if w.Result != "" {
+		bindings[w.Result] = normalizeValue(input)
+	}
+	return nil
+}
+
+func (q Query) execute(ctx workflow.Context, bindings map[string]interface{}) error {
+	if err := checkTemplate(q.Variable); err != nil {
+		return err
+	}
+	return workflow.SetQueryHandler(ctx, q.Name, func() (interface{}, error) {
+		return resolve(q.Variable, bindings)
+	})
+}
+
+// resolveDuration returns the duration a reference stands for, a reference that is not bound is parsed itself
+func resolveDuration(ref string, bindings map[string]interface{}) (time.Duration, error) {
+	value, err := resolve(ref, bindings)
+	if err != nil {
+		return 0, err
+	}
+	if _, bound := bindings[ref]; !bound && !isTemplate(ref) {
+		value = ref
+	}
+
+	switch v := value.(type) {
+	case float64:
+		return time.Duration(v * float64(time.Second)), nil
+	case string:
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %v: %w", ref, err)
+		}
+		return d, nil
+	}
+	return 0, fmt.Errorf("invalid duration %v, a %v", ref, typeName(value))
+}
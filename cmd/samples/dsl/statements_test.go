@@ -0,0 +1,92 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/cadence/workflow"
+)
+
+func greetWorkflow(ctx workflow.Context, name string, times float64) (string, error) {
+	greeting := ""
+	for i := 0; i < int(times); i++ {
+		greeting += "hello " + name + " "
+	}
+	return greeting, nil
+}
+
+func TestSleepAndWaitSignal(t *testing.T) {
+	recorder := &activityRecorder{}
+	env := newRecorderEnv(recorder)
+	start := env.Now()
+	env.RegisterDelayedCallback(func() {
+		result, err := env.QueryWorkflow("state", nil)
+		require.NoError(t, err)
+		var state string
+		require.NoError(t, result.Get(&state))
+		assert.Equal(t, "waiting", state)
+
+		env.SignalWorkflow("approve", map[string]interface{}{"by": "alice", "amount": 10})
+	}, 2*time.Hour)
+
+	env.ExecuteWorkflow(simpleDSLWorkflow, Workflow{
+		Variables: map[string]interface{}{"delay": "1h", "hours": 24, "state": "waiting"},
+		Root: Statement{Sequence: &Sequence{Elements: []*Statement{
+			{Query: &Query{Name: "state", Variable: "state"}},
+			{Sleep: &Sleep{Duration: "delay"}},
+			{WaitSignal: &WaitSignal{Name: "approve", Timeout: "${hours * 3600}", Result: "approval"}},
+			record("${approval.by}", "${approval.amount + 1}"),
+			{WaitSignal: &WaitSignal{Name: "approve", Timeout: "30m", Result: "approval"}},
+			record("${approval == null}"),
+		}}},
+	})
+
+	require.NoError(t, env.GetWorkflowError())
+	assert.Equal(t, []string{"alice,11", "true"}, recorder.calls)
+	// An hour of sleep, an hour of waiting for the signal and the 30 minute timeout
+	assert.Equal(t, 2*time.Hour+30*time.Minute, env.Now().Sub(start).Round(time.Minute))
+}
+
+func TestChildWorkflow(t *testing.T) {
+	recorder := &activityRecorder{}
+	env := newRecorderEnv(recorder)
+	env.RegisterWorkflow(simpleDSLWorkflow)
+	env.RegisterWorkflowWithOptions(greetWorkflow, workflow.RegisterOptions{Name: "greetWorkflow"})
+
+	env.ExecuteWorkflow(simpleDSLWorkflow, Workflow{
+		Variables: map[string]interface{}{"user": "bob", "times": 2},
+		Root: Statement{Sequence: &Sequence{Elements: []*Statement{
+			{ChildWorkflow: &ChildWorkflow{
+				Document:  "payment",
+				Variables: map[string]string{"payee": "user"},
+				Result:    "receipt",
+			}},
+			{ChildWorkflow: &ChildWorkflow{
+				Workflow:   "greetWorkflow",
+				Arguments:  []string{"user", "times"},
+				WorkflowID: "greet-${user}",
+				Result:     "greeting",
+			}},
+		}}},
+		Documents: map[string]*Workflow{
+			"payment": {
+				Variables: map[string]interface{}{"payee": "nobody", "amount": 5},
+				Root: Statement{Activity: &ActivityInvocation{
+					Name:      "recordActivity",
+					Arguments: []string{"payee", "amount"},
+					Result:    "paid",
+				}},
+				Output: "paid",
+			},
+		},
+		Output: "${[receipt, greeting]}",
+	})
+
+	require.NoError(t, env.GetWorkflowError())
+	assert.Equal(t, []string{"bob,5"}, recorder.calls)
+	var output []byte
+	require.NoError(t, env.GetWorkflowResult(&output))
+	assert.JSONEq(t, `["bob,5", "hello bob hello bob "]`, string(output))
+}
@@ -0,0 +1,600 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// validate checks a document before it starts: every statement sets one kind, activities are registered and get as
+// many arguments as they take, expressions parse, variables are bound and not shadowed, variables that no step
+// rebinds fit the parameter types, and documents do not run each other in a cycle.
+func (w Workflow) validate() error {
+	errs := []error{w.validateDocument(w.Documents), checkDocumentCycles(w.Documents)}
+	for _, name := range sortedDocumentNames(w.Documents) {
+		if err := w.Documents[name].validateDocument(w.Documents); err != nil {
+			errs = append(errs, fmt.Errorf("document %v: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// validateDocument validates the statements of one document, child workflows can run the documents
+func (w Workflow) validateDocument(documents map[string]*Workflow) error {
+	v := &validator{variables: w.Variables, documents: documents, assigned: map[string]bool{}, unbound: map[string]bool{}}
+	w.Root.walk(func(s *Statement) { v.collectAssigned(s) })
+	v.bound = v.checkStatement(&w.Root, map[string]bool{})
+	v.checkShadowing(&w.Root, map[string]bool{})
+	v.checkCompensatedContinueAsNew(&w.Root)
+	v.checkReference(w.Output)
+	return errors.Join(v.errs...)
+}
+
+func sortedDocumentNames(documents map[string]*Workflow) []string {
+	names := make([]string, 0, len(documents))
+	for name := range documents {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+type validator struct {
+	variables map[string]interface{}
+	documents map[string]*Workflow
+	// assigned are the variables some statement binds, their type is only known at runtime
+	assigned map[string]bool
+	// bound are the variables statements bound before the statement being checked, whatever path the workflow takes
+	bound map[string]bool
+	// unbound are the variables reported as not bound, each is reported once
+	unbound map[string]bool
+	errs    []error
+}
+
+// walk calls fn for s and every statement below it
+func (s *Statement) walk(fn func(*Statement)) {
+	if s == nil {
+		return
+	}
+	fn(s)
+	for _, child := range s.children() {
+		child.walk(fn)
+	}
+}
+
+func (s *Statement) children() []*Statement {
+	var children []*Statement
+	if s.Sequence != nil {
+		children = append(children, s.Sequence.Elements...)
+	}
+	if s.Parallel != nil {
+		children = append(children, s.Parallel.Branches...)
+	}
+	if s.If != nil {
+		children = append(children, s.If.Then, s.If.Else)
+	}
+	if s.Switch != nil {
+		for _, c := range s.Switch.Cases {
+			children = append(children, c.Body)
+		}
+		children = append(children, s.Switch.Default)
+	}
+	if s.ForEach != nil {
+		children = append(children, s.ForEach.Body)
+	}
+	if s.While != nil {
+		children = append(children, s.While.Body)
+	}
+	if s.Try != nil {
+		children = append(children, s.Try.Body, s.Try.Catch, s.Try.Finally)
+	}
+	return append(children, s.Compensate)
+}
+
+// kinds returns the kinds of statement s sets
+func (s *Statement) kinds() []string {
+	var kinds []string
+	for _, kind := range []struct {
+		name string
+		set  bool
+	}{
+		{"activity", s.Activity != nil},
+		{"sequence", s.Sequence != nil},
+		{"parallel", s.Parallel != nil},
+		{"if", s.If != nil},
+		{"switch", s.Switch != nil},
+		{"foreach", s.ForEach != nil},
+		{"while", s.While != nil},
+		{"childworkflow", s.ChildWorkflow != nil},
+		{"sleep", s.Sleep != nil},
+		{"waitsignal", s.WaitSignal != nil},
+		{"query", s.Query != nil},
+		{"try", s.Try != nil},
+	} {
+		if kind.set {
+			kinds = append(kinds, kind.name)
+		}
+	}
+	return kinds
+}
+
+func (v *validator) collectAssigned(s *Statement) {
+	if s.Activity != nil {
+		v.assigned[s.Activity.Result] = true
+		for name := range s.Activity.Extract {
+			v.assigned[name] = true
+		}
+	}
+	if s.ForEach != nil {
+		v.assigned[s.ForEach.As] = true
+	}
+	if s.ChildWorkflow != nil {
+		v.assigned[s.ChildWorkflow.Result] = true
+	}
+	if s.WaitSignal != nil {
+		v.assigned[s.WaitSignal.Result] = true
+	}
+	if s.Try != nil {
+		v.assigned[s.Try.Error] = true
+	}
+}
+
+// checkStatement checks s and the statements below it in the order they run. bound are the variables bound before s,
+// it returns the ones bound once s completed. A variable counts as bound after a branch only if every branch binds
+// it, and a loop body may not run at all.
+func (v *validator) checkStatement(s *Statement, bound map[string]bool) map[string]bool {
+	if s == nil {
+		return bound
+	}
+	v.bound = bound
+	v.check(s)
+
+	out := bound
+	if s.Sequence != nil {
+		for _, element := range s.Sequence.Elements {
+			out = v.checkStatement(element, out)
+		}
+	}
+	if s.Parallel != nil {
+		// A branch does not see what the other branches bind, the statements after the block see all of it
+		for _, branch := range s.Parallel.Branches {
+			out = union(out, v.checkStatement(branch, bound))
+		}
+	}
+	if s.If != nil {
+		out = intersect(v.checkStatement(s.If.Then, bound), v.checkStatement(s.If.Else, bound))
+	}
+	if s.Switch != nil {
+		out = v.checkStatement(s.Switch.Default, bound)
+		for _, c := range s.Switch.Cases {
+			out = intersect(out, v.checkStatement(c.Body, bound))
+		}
+	}
+	if s.ForEach != nil {
+		v.checkStatement(s.ForEach.Body, withName(bound, s.ForEach.As))
+	}
+	if s.While != nil {
+		v.checkStatement(s.While.Body, bound)
+	}
+	if s.Try != nil {
+		// Catch and Finally can run after any statement of the body failed
+		out = v.checkStatement(s.Try.Body, bound)
+		if s.Try.Catch != nil {
+			out = intersect(out, v.checkStatement(s.Try.Catch, withName(bound, s.Try.Error)))
+		}
+		out = union(out, v.checkStatement(s.Try.Finally, bound))
+	}
+
+	out = union(out, s.results())
+	// The compensation runs with the bindings at the time s completed
+	v.checkStatement(s.Compensate, out)
+	return out
+}
+
+// results returns the variables s binds itself
+func (s *Statement) results() map[string]bool {
+	results := map[string]bool{}
+	if s.Activity != nil {
+		if s.Activity.Result != "" {
+			results[s.Activity.Result] = true
+		}
+		for name := range s.Activity.Extract {
+			results[name] = true
+		}
+	}
+	if s.ChildWorkflow != nil && s.ChildWorkflow.Result != "" {
+		results[s.ChildWorkflow.Result] = true
+	}
+	if s.WaitSignal != nil && s.WaitSignal.Result != "" {
+		results[s.WaitSignal.Result] = true
+	}
+	return results
+}
+
+func union(a, b map[string]bool) map[string]bool {
+	c := make(map[string]bool, len(a)+len(b))
+	for k := range a {
+		c[k] = true
+	}
+	for k := range b {
+		c[k] = true
+	}
+	return c
+}
+
+func intersect(a, b map[string]bool) map[string]bool {
+	c := make(map[string]bool)
+	for k := range a {
+		if b[k] {
+			c[k] = true
+		}
+	}
+	return c
+}
+
+func (v *validator) errorf(format string, args ...interface{}) {
+	v.errs = append(v.errs, fmt.Errorf(format, args...))
+}
+
+func (v *validator) check(s *Statement) {
+	if kinds := s.kinds(); len(kinds) != 1 {
+		v.errorf("a statement must set exactly one kind, got %v", kinds)
+	}
+	if s.Activity != nil {
+		v.checkActivity(s.Activity)
+	}
+	if s.If != nil {
+		v.checkCondition(s.If.Condition)
+	}
+	if s.Switch != nil {
+		v.checkReference(s.Switch.Variable)
+	}
+	if s.ForEach != nil {
+		v.checkReference(s.ForEach.Variable)
+	}
+	if s.While != nil {
+		v.checkCondition(s.While.Condition)
+	}
+	if s.ChildWorkflow != nil {
+		v.checkChildWorkflow(s.ChildWorkflow)
+	}
+	if s.Sleep != nil {
+		v.checkDuration(s.Sleep.Duration)
+	}
+	if s.WaitSignal != nil {
+		if s.WaitSignal.Name == "" {
+			v.errorf("waitsignal needs a signal name")
+		}
+		v.checkDuration(s.WaitSignal.Timeout)
+	}
+	if s.Query != nil {
+		if s.Query.Name == "" {
+			v.errorf("query needs a query name")
+		}
+		// The handler reads the variable when the workflow is queried, a later statement may bind it
+		bound := v.bound
+		v.bound = union(bound, v.assigned)
+		v.checkReference(s.Query.Variable)
+		v.bound = bound
+	}
+	if s.Try != nil && s.Try.Body == nil {
+		v.errorf("try needs a body")
+	}
+	if s.Options != nil {
+		v.checkOptions(s.Options)
+	}
+}
+
+func (v *validator) checkOptions(o *StepOptions) {
+	v.checkDuration(o.ScheduleToStartTimeout)
+	v.checkDuration(o.StartToCloseTimeout)
+	v.checkDuration(o.HeartbeatTimeout)
+	if r := o.RetryPolicy; r != nil {
+		v.checkDuration(r.InitialInterval)
+		v.checkDuration(r.MaximumInterval)
+		v.checkDuration(r.ExpirationInterval)
+		if r.BackoffCoefficient != 0 && r.BackoffCoefficient < 1 {
+			v.errorf("retrypolicy backoffcoefficient must be at least 1, got %v", r.BackoffCoefficient)
+		}
+		if r.MaximumAttempts <= 0 && r.ExpirationInterval == "" {
+			v.errorf("retrypolicy must set maximumattempts or expirationinterval")
+		}
+	}
+}
+
+func (v *validator) checkChildWorkflow(c *ChildWorkflow) {
+	if (c.Document == "") == (c.Workflow == "") {
+		v.errorf("childworkflow must set exactly one of document and workflow")
+	}
+	if c.Document != "" && v.documents[c.Document] == nil {
+		v.errorf("childworkflow runs unknown document %v", c.Document)
+	}
+	for _, arg := range c.Arguments {
+		v.checkReference(arg)
+	}
+	for _, name := range sortedKeys(c.Variables) {
+		v.checkReference(c.Variables[name])
+		if doc := v.documents[c.Document]; doc != nil {
+			if _, ok := doc.Variables[name]; !ok {
+				v.errorf("childworkflow sets variable %v that document %v does not declare", name, c.Document)
+			}
+		}
+	}
+	v.checkReference(c.WorkflowID)
+	v.checkDuration(c.ExecutionTimeout)
+}
+
+func (v *validator) checkActivity(a *ActivityInvocation) {
+	for _, arg := range a.Arguments {
+		v.checkReference(arg)
+	}
+	for _, name := range sortedKeys(a.Extract) {
+		if err := v.checkExpressions(a.Extract[name], "result"); err != nil {
+			v.errorf("extract %v from the result of %v: %w", name, a.Name, err)
+		}
+	}
+
+	fn, ok := activities[a.Name]
+	if !ok {
+		v.errorf("activity %v is not registered", a.Name)
+		return
+	}
+	if takesStringSlice(a.Name) {
+		return
+	}
+	params := activityParams(fn)
+	if len(params) != len(a.Arguments) {
+		v.errorf("activity %v takes %d arguments, got %d", a.Name, len(params), len(a.Arguments))
+		return
+	}
+	for i, arg := range a.Arguments {
+		value, ok := v.variables[arg]
+		if !ok || v.assigned[arg] {
+			continue
+		}
+		if err := convertible(value, params[i]); err != nil {
+			v.errorf("argument %v of activity %v: %w", arg, a.Name, err)
+		}
+	}
+}
+
+func (v *validator) checkCondition(c *Condition) {
+	if c == nil {
+		return
+	}
+	if c.Expr != "" {
+		if err := v.checkExpressions(wrapExpression(c.Expr)); err != nil {
+			v.errs = append(v.errs, err)
+		}
+	}
+	v.checkReference(c.Variable)
+	for _, all := range c.All {
+		v.checkCondition(all)
+	}
+	for _, any := range c.Any {
+		v.checkCondition(any)
+	}
+	v.checkCondition(c.Not)
+}
+
+// checkReference checks a variable name or ${} template, the variables it reads have to be bound
+func (v *validator) checkReference(ref string) {
+	if ref == "" {
+		return
+	}
+	if !isTemplate(ref) {
+		v.checkBound(ref)
+		return
+	}
+	if err := v.checkExpressions(ref); err != nil {
+		v.errs = append(v.errs, err)
+	}
+}
+
+// checkExpressions parses the expressions in s and checks the variables they read, other than local, are bound. It
+// returns the parse error.
+func (v *validator) checkExpressions(s string, local ...string) error {
+	names := map[string]bool{}
+	err := parseTemplate(s, func(_ string, expr expression) error {
+		if expr != nil {
+			variableNames(expr, names)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	for _, name := range sorted {
+		if !contains(local, name) {
+			v.checkBound(name)
+		}
+	}
+	return nil
+}
+
+// checkBound reports a variable that is neither a variable of the document nor bound by a statement that ran before
+func (v *validator) checkBound(name string) {
+	if _, ok := v.variables[name]; ok || v.bound[name] || v.unbound[name] {
+		return
+	}
+	v.unbound[name] = true
+	if v.assigned[name] {
+		v.errorf("variable %v is used before a statement binds it", name)
+		return
+	}
+	v.errorf("variable %v is not bound", name)
+}
+
+// checkShadowing reports foreach and try error variables that hide a variable of the document or of an enclosing
+// block. All statements share the bindings, so the hidden value is gone once the block ran.
+func (v *validator) checkShadowing(s *Statement, scope map[string]bool) {
+	if s == nil {
+		return
+	}
+	v.checkShadowing(s.Compensate, scope)
+	switch {
+	case s.ForEach != nil && s.ForEach.As != "":
+		v.checkShadows("foreach", s.ForEach.As, scope)
+		v.checkShadowing(s.ForEach.Body, withName(scope, s.ForEach.As))
+	case s.Try != nil && s.Try.Error != "":
+		v.checkShadows("try error", s.Try.Error, scope)
+		v.checkShadowing(s.Try.Body, scope)
+		v.checkShadowing(s.Try.Catch, withName(scope, s.Try.Error))
+		v.checkShadowing(s.Try.Finally, scope)
+	default:
+		for _, child := range s.children() {
+			if child != s.Compensate {
+				v.checkShadowing(child, scope)
+			}
+		}
+	}
+}
+
+// checkCompensatedContinueAsNew reports loops that continue as new after or while a step with a compensation
+// completes. The compensation would be pending in the workflow and dropped by the new run.
+func (v *validator) checkCompensatedContinueAsNew(root *Statement) {
+	compensated := false
+	var visit func(s *Statement)
+	visit = func(s *Statement) {
+		if s == nil {
+			return
+		}
+		if body, ok := s.continueAsNewBody(); ok && (compensated || body.hasCompensation()) {
+			v.errorf("a loop with continueasnewafter cannot run after or contain a step with compensate")
+		}
+		for _, child := range s.children() {
+			if child != s.Compensate {
+				visit(child)
+			}
+		}
+		if s.Compensate != nil {
+			compensated = true
+		}
+	}
+	visit(root)
+}
+
+// continueAsNewBody returns the body of a loop that continues as new
+func (s *Statement) continueAsNewBody() (*Statement, bool) {
+	switch {
+	case s.ForEach != nil && s.ForEach.ContinueAsNewAfter > 0:
+		return s.ForEach.Body, true
+	case s.While != nil && s.While.ContinueAsNewAfter > 0:
+		return s.While.Body, true
+	}
+	return nil, false
+}
+
+// hasCompensation reports whether s or a statement below it has a compensation
+func (s *Statement) hasCompensation() bool {
+	found := false
+	s.walk(func(s *Statement) { found = found || s.Compensate != nil })
+	return found
+}
+
+func (v *validator) checkShadows(kind, name string, scope map[string]bool) {
+	if _, ok := v.variables[name]; ok || scope[name] {
+		v.errorf("%v variable %v shadows the variable %v", kind, name, name)
+	}
+}
+
+func withName(scope map[string]bool, name string) map[string]bool {
+	inner := make(map[string]bool, len(scope)+1)
+	for k := range scope {
+		inner[k] = true
+	}
+	inner[name] = true
+	return inner
+}
+
+// checkDocumentCycles rejects documents that run themselves as child workflows, directly or through other documents
+func checkDocumentCycles(documents map[string]*Workflow) error {
+	const (
+		visiting = iota + 1
+		visited
+	)
+	state := map[string]int{}
+	var path []string
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visiting:
+			start := 0
+			for path[start] != name {
+				start++
+			}
+			return fmt.Errorf("documents run each other as child workflows: %v",
+				strings.Join(append(path[start:], name), " -> "))
+		case visited:
+			return nil
+		}
+		state[name] = visiting
+		path = append(path, name)
+		for _, child := range documents[name].childDocuments() {
+			if documents[child] == nil {
+				continue
+			}
+			if err := visit(child); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = visited
+		return nil
+	}
+	for _, name := range sortedDocumentNames(documents) {
+		if err := visit(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// childDocuments returns the documents the workflow runs as child workflows
+func (w Workflow) childDocuments() []string {
+	var children []string
+	w.Root.walk(func(s *Statement) {
+		if s.ChildWorkflow != nil && s.ChildWorkflow.Document != "" {
+			children = append(children, s.ChildWorkflow.Document)
+		}
+	})
+	return children
+}
+
+// checkDuration checks a duration like the one of Sleep, a reference that is not a variable has to parse as one
+func (v *validator) checkDuration(ref string) {
+	_, isVariable := v.variables[ref]
+	if ref == "" || isTemplate(ref) || isVariable || v.assigned[ref] {
+		v.checkReference(ref)
+		return
+	}
+	if _, err := time.ParseDuration(ref); err != nil {
+		v.errorf("invalid duration %v: %w", ref, err)
+	}
+}
+
+// checkTemplate parses the expressions in s
+func checkTemplate(s string) error {
+	return parseTemplate(s, func(string, expression) error { return nil })
+}
+
+// convertible checks that a JSON value decodes into a parameter of type t, like the activity input will
+func convertible(value interface{}, t reflect.Type) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, reflect.New(t).Interface()); err != nil {
+		return fmt.Errorf("%v is not a %v", string(data), t)
+	}
+	return nil
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sampleDocuments are the sample yaml and json configs
+var sampleDocuments = []string{
+	"workflow1.yaml", "workflow2.yaml", "workflow3.yaml", "workflow4.yaml", "workflow5.yaml", "workflow6.yaml",
+	"workflow1.json",
+}
+
+func TestValidateSampleDocuments(t *testing.T) {
+	for _, path := range sampleDocuments {
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		w, err := decodeWorkflow(data, true)
+		require.NoError(t, err, path)
+		assert.NoError(t, w.validate(), path)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	w, err := parseWorkflow([]byte(`
+variables:
+  prefix: order
+  count: many
+root:
+  sequence:
+    elements:
+      - activity:
+          name: main.sampleItemsActivity
+          arguments: [prefix, count]
+      - activity:
+          name: main.sampleItemsActivity
+          arguments: [prefix]
+      - activity:
+          name: main.unknownActivity
+      - if:
+          condition:
+            expr: len(items >
+      - activity:
+          name: main.sampleActivity1
+          arguments: ["${prefix"]
+        sequence:
+          elements: []
+`))
+	require.NoError(t, err)
+
+	err = w.validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `argument count of activity main.sampleItemsActivity: "many" is not a int`)
+	assert.Contains(t, err.Error(), "activity main.sampleItemsActivity takes 2 arguments, got 1")
+	assert.Contains(t, err.Error(), "activity main.unknownActivity is not registered")
+	assert.Contains(t, err.Error(), "unexpected end of expression")
+	assert.Contains(t, err.Error(), "unterminated ${")
+	assert.Contains(t, err.Error(), "got [activity sequence]")
+}
+
+func TestValidatePolicies(t *testing.T) {
+	w, err := parseWorkflow([]byte(`
+variables:
+  timeout: 1m
+root:
+  try:
+    body:
+      activity:
+        name: main.sampleActivity1
+      options:
+        starttoclosetimeout: timeout
+        heartbeattimeout: soon
+        retrypolicy:
+          backoffcoefficient: 0.5
+      compensate:
+        sleep:
+          duration: 5x
+    catch:
+      activity:
+        name: main.sampleActivity2
+        arguments: [error]
+    error: error
+`))
+	require.NoError(t, err)
+
+	err = w.validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid duration soon")
+	assert.Contains(t, err.Error(), "invalid duration 5x")
+	assert.Contains(t, err.Error(), "retrypolicy backoffcoefficient must be at least 1, got 0.5")
+	assert.Contains(t, err.Error(), "retrypolicy must set maximumattempts or expirationinterval")
+	assert.NotContains(t, err.Error(), "invalid duration timeout")
+}
+
+func TestValidateBindings(t *testing.T) {
+	w, err := parseWorkflow([]byte(`
+variables:
+  items: a,b
+  item: x
+root:
+  sequence:
+    elements:
+      - activity:
+          name: main.sampleActivity1
+          arguments: [missing, "${missing + item}", "${len(other)}"]
+          extract:
+            first: ${result}
+      - foreach:
+          variable: items
+          as: item
+          body:
+            foreach:
+              variable: items
+              as: inner
+              body:
+                try:
+                  body:
+                    childworkflow:
+                      document: ping
+                      variables:
+                        target: inner
+                        unknown: item
+                  catch:
+                    activity:
+                      name: main.sampleActivity2
+                      arguments: [inner]
+                  error: inner
+documents:
+  ping:
+    variables:
+      target: nobody
+    root:
+      childworkflow:
+        document: pong
+  pong:
+    root:
+      childworkflow:
+        document: ping
+`))
+	require.NoError(t, err)
+
+	err = w.validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "variable missing is not bound")
+	assert.Contains(t, err.Error(), "variable other is not bound")
+	assert.NotContains(t, err.Error(), "variable result is not bound")
+	assert.Equal(t, 1, strings.Count(err.Error(), "variable missing is not bound"))
+	assert.Contains(t, err.Error(), "foreach variable item shadows the variable item")
+	assert.Contains(t, err.Error(), "try error variable inner shadows the variable inner")
+	assert.Contains(t, err.Error(), "childworkflow sets variable unknown that document ping does not declare")
+	assert.Contains(t, err.Error(), "documents run each other as child workflows: ping -> pong -> ping")
+}
+
+func TestValidateCompensatedContinueAsNew(t *testing.T) {
+	for name, tc := range map[string]struct {
+		document string
+		valid    bool
+	}{
+		"compensated step before the loop": {document: `
+variables:
+  items: a,b
+root:
+  sequence:
+    elements:
+      - activity:
+          name: main.sampleActivity1
+        compensate:
+          activity:
+            name: main.sampleActivity2
+      - foreach:
+          variable: items
+          continueasnewafter: 1
+          body:
+            activity:
+              name: main.sampleActivity1
+`},
+		"compensated step in the loop": {document: `
+variables:
+  items: a,b
+root:
+  foreach:
+    variable: items
+    continueasnewafter: 1
+    body:
+      activity:
+        name: main.sampleActivity1
+      compensate:
+        activity:
+          name: main.sampleActivity2
+`},
+		"compensated step after the loop": {valid: true, document: `
+variables:
+  items: a,b
+root:
+  sequence:
+    elements:
+      - foreach:
+          variable: items
+          continueasnewafter: 1
+          body:
+            activity:
+              name: main.sampleActivity1
+      - activity:
+          name: main.sampleActivity1
+        compensate:
+          activity:
+            name: main.sampleActivity2
+`},
+	} {
+		w, err := parseWorkflow([]byte(tc.document))
+		require.NoError(t, err, name)
+		err = w.validate()
+		if tc.valid {
+			assert.NoError(t, err, name)
+			continue
+		}
+		require.Error(t, err, name)
+		assert.Contains(t, err.Error(), "a loop with continueasnewafter cannot run after or contain a step with compensate", name)
+	}
+}
+
+func TestValidateBindingOrder(t *testing.T) {
+	w, err := parseWorkflow([]byte(`
+variables:
+  items: a,b
+root:
+  sequence:
+    elements:
+      - activity:
+          name: main.sampleActivity1
+          arguments: [later]
+      - activity:
+          name: main.sampleActivity1
+          result: later
+      - if:
+          condition:
+            expr: len(items) > 1
+          then:
+            activity:
+              name: main.sampleActivity1
+              result: both
+          else:
+            activity:
+              name: main.sampleActivity1
+              result: both
+      - if:
+          condition:
+            expr: both != ""
+          then:
+            activity:
+              name: main.sampleActivity1
+              result: onlythen
+      - foreach:
+          variable: items
+          as: item
+          body:
+            activity:
+              name: main.sampleActivity1
+              arguments: [item, later]
+              result: inloop
+      - query:
+          name: state
+          variable: inloop
+      - activity:
+          name: main.sampleActivity2
+          arguments: [both, onlythen, inloop, item]
+`))
+	require.NoError(t, err)
+
+	err = w.validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "variable later is used before a statement binds it")
+	assert.NotContains(t, err.Error(), "variable both")
+	assert.Contains(t, err.Error(), "variable onlythen is used before a statement binds it")
+	assert.Contains(t, err.Error(), "variable item is used before a statement binds it")
+	assert.Equal(t, 1, strings.Count(err.Error(), "variable inloop"))
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
 	"time"
 
 	"go.uber.org/cadence/workflow"
@@ -11,19 +13,38 @@ import (
 const ApplicationName = "dslGroup"
 
 type (
-	// Workflow is the type used to express the workflow definition. Variables are a map of valuables. Variables can be
-	// used as input to Activity.
+	// Workflow is the type used to express the workflow definition. Variables are a map of valuables, any JSON value.
+	// Variables can be used as input to Activity. Documents are workflow definitions ChildWorkflow statements can run
+	// by name, Output is a reference to the result of the workflow. Checkpoint is set on the runs a loop continued as
+	// new.
 	Workflow struct {
-		Variables map[string]string
-		Root      Statement
+		Variables  map[string]interface{}
+		Root       Statement
+		Documents  map[string]*Workflow
+		Output     string
+		Checkpoint *Checkpoint
 	}
 
 	// Statement is the building block of dsl workflow. A Statement can be a simple ActivityInvocation or it
-	// could be a Sequence or Parallel.
+	// could be a Sequence or Parallel, or control the flow with If, Switch, ForEach and While. ChildWorkflow, Sleep,
+	// WaitSignal and Query run child workflows, wait and expose variables, Try handles errors. Options apply to the
+	// activities of the statement, Compensate undoes it once it completed and a later statement of the enclosing Try,
+	// or of the workflow, fails.
 	Statement struct {
-		Activity *ActivityInvocation
-		Sequence *Sequence
-		Parallel *Parallel
+		Activity      *ActivityInvocation
+		Sequence      *Sequence
+		Parallel      *Parallel
+		If            *If
+		Switch        *Switch
+		ForEach       *ForEach
+		While         *While
+		ChildWorkflow *ChildWorkflow
+		Sleep         *Sleep
+		WaitSignal    *WaitSignal
+		Query         *Query
+		Try           *Try
+		Options       *StepOptions
+		Compensate    *Statement
 	}
 
 	// Sequence consist of a collection of Statements that runs in sequential.
@@ -37,24 +58,26 @@ type (
 	}
 
 	// ActivityInvocation is used to express invoking an Activity. The Arguments defined expected arguments as input to
-	// the Activity, the result specify the name of variable that it will store the result as which can then be used as
-	// arguments to subsequent ActivityInvocation.
+	// the Activity, each a variable name or a ${} expression, the result specify the name of variable that it will
+	// store the result as which can then be used as arguments to subsequent ActivityInvocation. Extract stores parts
+	// of the result in variables, e.g. firstID: ${result.items[0].id}, where result is the result of the activity.
 	ActivityInvocation struct {
 		Name      string
 		Arguments []string
 		Result    string
+		Extract   map[string]string
 	}
 
 	executable interface {
-		execute(ctx workflow.Context, bindings map[string]string) error
+		execute(ctx workflow.Context, bindings map[string]interface{}) error
 	}
 )
 
 // simpleDSLWorkflow workflow decider
 func simpleDSLWorkflow(ctx workflow.Context, dslWorkflow Workflow) ([]byte, error) {
-	bindings := make(map[string]string)
+	bindings := make(map[string]interface{})
 	for k, v := range dslWorkflow.Variables {
-		bindings[k] = v
+		bindings[k] = normalizeValue(v)
 	}
 
 	ao := workflow.ActivityOptions{
@@ -63,19 +86,38 @@ func simpleDSLWorkflow(ctx workflow.Context, dslWorkflow Workflow) ([]byte, erro
 		HeartbeatTimeout:       time.Second * 20,
 	}
 	ctx = workflow.WithActivityOptions(ctx, ao)
+	ctx = workflow.WithValue(ctx, runStateKey, &runState{workflow: dslWorkflow, resume: dslWorkflow.Checkpoint})
+	// A loop does not continue as new while compensations are pending, the new run would drop them
+	compensations := &saga{}
+	ctx = workflow.WithValue(ctx, sagaKey, compensations)
 	logger := workflow.GetLogger(ctx)
 
 	err := dslWorkflow.Root.execute(ctx, bindings)
+	if _, ok := err.(*workflow.ContinueAsNewError); ok {
+		return nil, err
+	}
 	if err != nil {
 		logger.Error("DSL Workflow failed.", zap.Error(err))
+		compensations.compensate(ctx)
 		return nil, err
 	}
 
 	logger.Info("DSL Workflow completed.")
-	return nil, err
+	if dslWorkflow.Output == "" {
+		return nil, nil
+	}
+	output, err := resolve(dslWorkflow.Output, bindings)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(output)
 }
 
-func (b *Statement) execute(ctx workflow.Context, bindings map[string]string) error {
+func (b *Statement) execute(ctx workflow.Context, bindings map[string]interface{}) error {
+	ctx, err := b.Options.apply(ctx, bindings)
+	if err != nil {
+		return err
+	}
 	if b.Parallel != nil {
 		err := b.Parallel.execute(ctx, bindings)
 		if err != nil {
@@ -94,25 +136,105 @@ func (b *Statement) execute(ctx workflow.Context, bindings map[string]string) er
 			return err
 		}
 	}
+	if b.If != nil {
+		err := b.If.execute(ctx, bindings)
+		if err != nil {
+			return err
+		}
+	}
+	if b.Switch != nil {
+		err := b.Switch.execute(ctx, bindings)
+		if err != nil {
+			return err
+		}
+	}
+	if b.ForEach != nil {
+		err := b.ForEach.execute(ctx, bindings)
+		if err != nil {
+			return err
+		}
+	}
+	if b.While != nil {
+		err := b.While.execute(ctx, bindings)
+		if err != nil {
+			return err
+		}
+	}
+	if b.ChildWorkflow != nil {
+		err := b.ChildWorkflow.execute(ctx, bindings)
+		if err != nil {
+			return err
+		}
+	}
+	if b.Sleep != nil {
+		err := b.Sleep.execute(ctx, bindings)
+		if err != nil {
+			return err
+		}
+	}
+	if b.WaitSignal != nil {
+		err := b.WaitSignal.execute(ctx, bindings)
+		if err != nil {
+			return err
+		}
+	}
+	if b.Query != nil {
+		err := b.Query.execute(ctx, bindings)
+		if err != nil {
+			return err
+		}
+	}
+	if b.Try != nil {
+		err := b.Try.execute(ctx, bindings)
+		if err != nil {
+			return err
+		}
+	}
+	if b.Compensate != nil {
+		addCompensation(ctx, b.Compensate, bindings)
+	}
 	return nil
 }
 
-func (a ActivityInvocation) execute(ctx workflow.Context, bindings map[string]string) error {
-	inputParam := makeInput(a.Arguments, bindings)
-	var result string
-	err := workflow.ExecuteActivity(ctx, a.Name, inputParam).Get(ctx, &result)
+func (a ActivityInvocation) execute(ctx workflow.Context, bindings map[string]interface{}) error {
+	inputParam, err := makeInput(a.Name, a.Arguments, bindings)
 	if err != nil {
 		return err
 	}
+	var result interface{}
+	err = executeActivity(ctx, a.Name, inputParam...).Get(ctx, &result)
+	if err != nil {
+		return err
+	}
+	result = normalizeValue(result)
 	if a.Result != "" {
 		bindings[a.Result] = result
 	}
+	if len(a.Extract) > 0 {
+		scope := copyBindings(bindings)
+		scope["result"] = result
+		for _, name := range sortedKeys(a.Extract) {
+			value, err := expandTemplate(a.Extract[name], scope)
+			if err != nil {
+				return fmt.Errorf("extract %v from the result of %v: %w", name, a.Name, err)
+			}
+			bindings[name] = value
+		}
+	}
 	return nil
 }
 
-func (s Sequence) execute(ctx workflow.Context, bindings map[string]string) error {
-	for _, a := range s.Elements {
-		err := a.execute(ctx, bindings)
+func (s Sequence) execute(ctx workflow.Context, bindings map[string]interface{}) error {
+	// A continued run starts at the element it continued as new in. The queries of the elements before it were
+	// registered by an earlier run, so the new run registers them again.
+	start, _ := resumeStep(ctx)
+	for i := 0; i < start; i++ {
+		if err := registerQueries(ctx, s.Elements[i], bindings); err != nil {
+			return err
+		}
+	}
+	for i := start; i < len(s.Elements); i++ {
+		err := s.Elements[i].execute(withPathStep(ctx, i), bindings)
 		if err != nil {
 			return err
 		}
@@ -120,7 +242,27 @@ func (s Sequence) execute(ctx workflow.Context, bindings map[string]string) erro
 	return nil
 }
 
-func (p Parallel) execute(ctx workflow.Context, bindings map[string]string) error {
+// registerQueries sets the query handlers of a statement a continued run skips, and of the sequences in it
+func registerQueries(ctx workflow.Context, s *Statement, bindings map[string]interface{}) error {
+	if s == nil {
+		return nil
+	}
+	if s.Query != nil {
+		if err := s.Query.execute(ctx, bindings); err != nil {
+			return err
+		}
+	}
+	if s.Sequence != nil {
+		for _, element := range s.Sequence.Elements {
+			if err := registerQueries(ctx, element, bindings); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (p Parallel) execute(ctx workflow.Context, bindings map[string]interface{}) error {
 	//
 	// You can use the context passed in to activity as a way to cancel the activity like standard GO way.
 	// Cancelling a parent context will cancel all the derived contexts as well.
@@ -129,6 +271,7 @@ func (p Parallel) execute(ctx workflow.Context, bindings map[string]string) erro
 	// In the parallel block, we want to execute all of them in parallel and wait for all of them.
 	// if one activity fails then we want to cancel all the rest of them as well.
 	childCtx, cancelHandler := workflow.WithCancel(ctx)
+	childCtx = workflow.WithValue(childCtx, nestedKey, true)
 	selector := workflow.NewSelector(ctx)
 	var activityErr error
 	for _, s := range p.Branches {
@@ -153,7 +296,7 @@ func (p Parallel) execute(ctx workflow.Context, bindings map[string]string) erro
 	return nil
 }
 
-func executeAsync(exe executable, ctx workflow.Context, bindings map[string]string) workflow.Future {
+func executeAsync(exe executable, ctx workflow.Context, bindings map[string]interface{}) workflow.Future {
 	future, settable := workflow.NewFuture(ctx)
 	workflow.Go(ctx, func(ctx workflow.Context) {
 		err := exe.execute(ctx, bindings)
@@ -162,10 +305,25 @@ func executeAsync(exe executable, ctx workflow.Context, bindings map[string]stri
 	return future
 }
 
-func makeInput(argNames []string, argsMap map[string]string) []string {
-	var args []string
+// makeInput resolves the arguments into the input of the activity. An activity that takes a single []string, or
+// that is not in the activities registry, gets all arguments formatted as strings in one slice, any other activity
+// gets one parameter per argument.
+func makeInput(name string, argNames []string, argsMap map[string]interface{}) ([]interface{}, error) {
+	var args []interface{}
 	for _, arg := range argNames {
-		args = append(args, argsMap[arg])
+		value, err := resolve(arg, argsMap)
+		if err != nil {
+			return nil, fmt.Errorf("argument %v of %v: %w", arg, name, err)
+		}
+		args = append(args, value)
+	}
+
+	if !takesStringSlice(name) {
+		return args, nil
+	}
+	var strArgs []string
+	for _, arg := range args {
+		strArgs = append(strArgs, formatValue(arg))
 	}
-	return args
+	return []interface{}{strArgs}, nil
 }
@@ -1,12 +1,16 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"os"
 	"testing"
 	"time"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/cadence/activity"
+	"go.uber.org/cadence/encoded"
 	"go.uber.org/cadence/testsuite"
 	"go.uber.org/cadence/workflow"
 )
@@ -17,7 +21,7 @@ func TestActivitySequenceParallelStatements(t *testing.T) {
 	tests := []struct {
 		name     string
 		fields   Statement
-		bindings map[string]string
+		bindings map[string]interface{}
 		wantErr  bool
 	}{
 		{
@@ -29,7 +33,7 @@ func TestActivitySequenceParallelStatements(t *testing.T) {
 					Result:    "resultVar",
 				},
 			},
-			bindings: map[string]string{
+			bindings: map[string]interface{}{
 				"var1": "value1",
 				"var2": "value2",
 			},
@@ -57,7 +61,7 @@ func TestActivitySequenceParallelStatements(t *testing.T) {
 					},
 				},
 			},
-			bindings: map[string]string{
+			bindings: map[string]interface{}{
 				"var1": "value1",
 				"var2": "value2",
 			},
@@ -85,7 +89,7 @@ func TestActivitySequenceParallelStatements(t *testing.T) {
 					},
 				},
 			},
-			bindings: map[string]string{
+			bindings: map[string]interface{}{
 				"var1": "value1",
 				"var2": "value2",
 			},
@@ -123,7 +127,7 @@ func TestSequenceFlow(t *testing.T) {
 	tests := []struct {
 		name     string
 		fields   Sequence
-		bindings map[string]string
+		bindings map[string]interface{}
 		wantErr  bool
 	}{
 		{
@@ -139,7 +143,7 @@ func TestSequenceFlow(t *testing.T) {
 					},
 				},
 			},
-			bindings: map[string]string{
+			bindings: map[string]interface{}{
 				"var1": "value1",
 			},
 			wantErr: false,
@@ -164,7 +168,7 @@ func TestSequenceFlow(t *testing.T) {
 					},
 				},
 			},
-			bindings: map[string]string{
+			bindings: map[string]interface{}{
 				"var1": "value1",
 				"var2": "value2",
 			},
@@ -190,7 +194,7 @@ func TestSequenceFlow(t *testing.T) {
 					},
 				},
 			},
-			bindings: map[string]string{
+			bindings: map[string]interface{}{
 				"var1": "value1",
 				"var2": "value2",
 			},
@@ -229,7 +233,7 @@ func TestParallelFlow(t *testing.T) {
 	tests := []struct {
 		name     string
 		fields   Parallel
-		bindings map[string]string
+		bindings map[string]interface{}
 		wantErr  bool
 	}{
 		{
@@ -245,7 +249,7 @@ func TestParallelFlow(t *testing.T) {
 					},
 				},
 			},
-			bindings: map[string]string{
+			bindings: map[string]interface{}{
 				"var1": "value1",
 			},
 			wantErr: false,
@@ -270,7 +274,7 @@ func TestParallelFlow(t *testing.T) {
 					},
 				},
 			},
-			bindings: map[string]string{
+			bindings: map[string]interface{}{
 				"var1": "value1",
 				"var2": "value2",
 			},
@@ -296,7 +300,7 @@ func TestParallelFlow(t *testing.T) {
 					},
 				},
 			},
-			bindings: map[string]string{
+			bindings: map[string]interface{}{
 				"var1": "value1",
 				"var2": "value2",
 			},
@@ -335,7 +339,7 @@ func TestActivityInvocationFlow(t *testing.T) {
 	tests := []struct {
 		name     string
 		fields   ActivityInvocation
-		bindings map[string]string
+		bindings map[string]interface{}
 		wantErr  bool
 	}{
 		{
@@ -345,7 +349,7 @@ func TestActivityInvocationFlow(t *testing.T) {
 				Arguments: []string{"var1"},
 				Result:    "resultVar",
 			},
-			bindings: map[string]string{
+			bindings: map[string]interface{}{
 				"var1": "value1",
 			},
 			wantErr: false,
@@ -357,7 +361,7 @@ func TestActivityInvocationFlow(t *testing.T) {
 				Arguments: []string{"var1"},
 				Result:    "resultVar",
 			},
-			bindings: map[string]string{
+			bindings: map[string]interface{}{
 				"var1": "value1",
 			},
 			wantErr: true,
@@ -395,7 +399,7 @@ func Test_SimpleDSLWorkflow(t *testing.T) {
 
 	// Define a sample DSL workflow
 	dslWorkflow := Workflow{
-		Variables: map[string]string{
+		Variables: map[string]interface{}{
 			"var1": "value1",
 			"var2": "value2",
 		},
@@ -424,3 +428,32 @@ func sampleActivity(input []string) (string, error) {
 	fmt.Printf("Run %s with input %v \n", name, input)
 	return "Result_" + name, nil
 }
+
+func TestTypedActivityInvocation(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	for name, fn := range activities {
+		env.RegisterActivityWithOptions(fn, activity.RegisterOptions{Name: name})
+	}
+
+	data, err := os.ReadFile("workflow4.yaml")
+	require.NoError(t, err)
+	dslWorkflow, err := parseWorkflow(data)
+	require.NoError(t, err)
+
+	var messages []string
+	env.SetOnActivityStartedListener(func(info *activity.Info, ctx context.Context, args encoded.Values) {
+		if info.ActivityType.Name == "main.sampleNotifyActivity" {
+			var message string
+			var urgent bool
+			require.NoError(t, args.Get(&message, &urgent))
+			assert.True(t, urgent)
+			messages = append(messages, message)
+		}
+	})
+	env.ExecuteWorkflow(simpleDSLWorkflow, dslWorkflow)
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+	assert.Equal(t, []string{"5 items, the first is order-0"}, messages)
+}
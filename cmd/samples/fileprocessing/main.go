@@ -13,19 +13,32 @@ import (
 
 // This needs to be done as part of a bootstrap step when the process starts.
 // The workers are supposed to be long running.
-func startWorkers(h *common.SampleHelper) {
+func runWorkers(h *common.SampleHelper) {
 	// Configure worker options.
 	workerOptions := worker.Options{
-		MetricsScope:          h.WorkerMetricScope,
-		Logger:                h.Logger,
 		EnableLoggingInReplay: true,
 		EnableSessionWorker:   true,
 	}
-	h.StartWorkers(h.Config.DomainName, ApplicationName, workerOptions)
+
+	// The shared task list runs the workflow and the sessions that pin file activities to one host
+	h.WorkerGroup("shared").
+		SetTaskList(ApplicationName).
+		SetOptions(workerOptions).
+		RegisterWorkflow(sampleFileProcessingWorkflow).
+		RegisterActivityWithAlias(downloadFileActivity, downloadFileActivityName).
+		RegisterActivityWithAlias(processFileActivity, processFileActivityName).
+		RegisterActivityWithAlias(uploadFileActivity, uploadFileActivityName)
 
 	// Host Specific activities processing case
 	workerOptions.DisableWorkflowWorker = true
-	h.StartWorkers(h.Config.DomainName, HostID, workerOptions)
+	h.WorkerGroup("host").
+		SetTaskList(HostID).
+		SetOptions(workerOptions).
+		RegisterActivityWithAlias(downloadFileActivity, downloadFileActivityName).
+		RegisterActivityWithAlias(processFileActivity, processFileActivityName).
+		RegisterActivityWithAlias(uploadFileActivity, uploadFileActivityName)
+
+	h.RunWorkerGroups()
 }
 
 func startWorkflow(h *common.SampleHelper, fileID string) {
@@ -48,15 +61,7 @@ func main() {
 
 	switch mode {
 	case "worker":
-		h.RegisterWorkflow(sampleFileProcessingWorkflow)
-		h.RegisterActivityWithAlias(downloadFileActivity, downloadFileActivityName)
-		h.RegisterActivityWithAlias(processFileActivity, processFileActivityName)
-		h.RegisterActivityWithAlias(uploadFileActivity, uploadFileActivityName)
-		startWorkers(&h)
-
-		// The workers are supposed to be long running process that should not exit.
-		// Use select{} to block indefinitely for samples, you can quit by CMD+C.
-		select {}
+		runWorkers(&h)
 	case "trigger":
 		startWorkflow(&h, uuid.New())
 	}
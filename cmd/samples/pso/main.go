@@ -15,7 +15,7 @@ import (
 
 // This needs to be done as part of a bootstrap step when the process starts.
 // The workers are supposed to be long running.
-func startWorkers(h *common.SampleHelper) {
+func runWorkers(h *common.SampleHelper) {
 	// Configure worker options.
 	workerOptions := worker.Options{
 		MetricsScope:                       h.WorkerMetricScope,
@@ -23,7 +23,7 @@ func startWorkers(h *common.SampleHelper) {
 		MaxConcurrentActivityExecutionSize: 1, // Activities are supposed to be CPU intensive, so better limit the concurrency
 		DataConverter:                      h.DataConverter,
 	}
-	h.StartWorkers(h.Config.DomainName, ApplicationName, workerOptions)
+	h.RunWorkers(common.WorkerSpec{TaskList: ApplicationName, Options: workerOptions})
 }
 
 func startWorkflow(h *common.SampleHelper, functionName string) {
@@ -71,11 +71,7 @@ func main() {
 		h.RegisterWorkflow(samplePSOChildWorkflow)
 		h.RegisterActivityWithAlias(initParticleActivity, initParticleActivityName)
 		h.RegisterActivityWithAlias(updateParticleActivity, updateParticleActivityName)
-		startWorkers(&h)
-
-		// The workers are supposed to be long running process that should not exit.
-		// Use select{} to block indefinitely for samples, you can quit by CMD+C.
-		select {}
+		runWorkers(&h)
 	case "trigger":
 		startWorkflow(&h, functionName)
 	case "query":
@@ -13,7 +13,7 @@ import (
 
 // This needs to be done as part of a bootstrap step when the process starts.
 // The workers are supposed to be long running.
-func startWorkers(h *common.SampleHelper) {
+func runWorkers(h *common.SampleHelper) {
 	// Configure worker options.
 	workerOptions := worker.Options{
 		MetricsScope: h.WorkerMetricScope,
@@ -21,7 +21,7 @@ func startWorkers(h *common.SampleHelper) {
 	}
 
 	// Start Worker.
-	h.StartWorkers(h.Config.DomainName, ApplicationName, workerOptions)
+	h.RunWorkers(common.WorkerSpec{TaskList: ApplicationName, Options: workerOptions})
 }
 
 func startWorkflowMultiChoice(h *common.SampleHelper) {
@@ -63,11 +63,7 @@ func main() {
 		h.RegisterActivity(orderCherryActivity)
 		h.RegisterActivity(orderOrangeActivity)
 		h.RegisterActivity(getBasketOrderActivity)
-		startWorkers(&h)
-
-		// The workers are supposed to be long running process that should not exit.
-		// Use select{} to block indefinitely for samples, you can quit by CMD+C.
-		select {}
+		runWorkers(&h)
 	case "trigger":
 		switch sampleCase {
 		case "multi":
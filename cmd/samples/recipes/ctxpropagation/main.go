@@ -15,7 +15,7 @@ import (
 
 // This needs to be done as part of a bootstrap step when the process starts.
 // The workers are supposed to be long running.
-func startWorkers(h *common.SampleHelper) {
+func runWorkers(h *common.SampleHelper) {
 	// Configure worker options. Setup a custom context propagator.
 	workerOptions := worker.Options{
 		MetricsScope:          h.WorkerMetricScope,
@@ -25,7 +25,7 @@ func startWorkers(h *common.SampleHelper) {
 			NewContextPropagator(),
 		},
 	}
-	h.StartWorkers(h.Config.DomainName, ApplicationName, workerOptions)
+	h.RunWorkers(common.WorkerSpec{TaskList: ApplicationName, Options: workerOptions})
 }
 
 func startWorkflow(h *common.SampleHelper) {
@@ -56,11 +56,7 @@ func main() {
 	case "worker":
 		h.RegisterWorkflow(sampleCtxPropWorkflow)
 		h.RegisterActivityWithAlias(sampleActivity, sampleActivityName)
-		startWorkers(&h)
-
-		// The workers are supposed to be long running process that should not exit.
-		// Use select{} to block indefinitely for samples, you can quit by CMD+C.
-		select {}
+		runWorkers(&h)
 	case "trigger":
 		startWorkflow(&h)
 	}
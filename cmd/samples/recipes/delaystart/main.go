@@ -13,7 +13,7 @@ import (
 
 // This needs to be done as part of a bootstrap step when the process starts.
 // The workers are supposed to be long running.
-func startWorkers(h *common.SampleHelper) {
+func runWorkers(h *common.SampleHelper) {
 	// Configure worker options.
 	workerOptions := worker.Options{
 		MetricsScope: h.WorkerMetricScope,
@@ -22,10 +22,10 @@ func startWorkers(h *common.SampleHelper) {
 			WorkflowExecutionAlreadyCompletedErrorEnabled: true,
 		},
 	}
-	h.StartWorkers(h.Config.DomainName, ApplicationName, workerOptions)
+	h.RunWorkers(common.WorkerSpec{TaskList: ApplicationName, Options: workerOptions})
 }
 
-func startShadower(h *common.SampleHelper) {
+func runShadower(h *common.SampleHelper) {
 	workerOptions := worker.Options{
 		MetricsScope:       h.WorkerMetricScope,
 		Logger:             h.Logger,
@@ -38,7 +38,7 @@ func startShadower(h *common.SampleHelper) {
 			},
 		},
 	}
-	h.StartWorkers(h.Config.DomainName, ApplicationName, workerOptions)
+	h.RunWorkers(common.WorkerSpec{TaskList: ApplicationName, Options: workerOptions})
 }
 
 func startWorkflow(h *common.SampleHelper) {
@@ -71,16 +71,10 @@ func main() {
 	switch mode {
 	case "worker":
 		registerWorkflowAndActivity(&h)
-		startWorkers(&h)
-
-		// The workers are supposed to be long running process that should not exit.
-		// Use select{} to block indefinitely for samples, you can quit by CMD+C.
-		select {}
+		runWorkers(&h)
 	case "shadower":
 		registerWorkflowAndActivity(&h)
-		startShadower(&h)
-
-		select {}
+		runShadower(&h)
 	case "trigger":
 		startWorkflow(&h)
 	}
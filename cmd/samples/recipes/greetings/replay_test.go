@@ -14,6 +14,10 @@ import (
 //
 //	cadence --do default wf show -w greetings_5d5f8e5c-4807-444d-9dc5-80abea22a324 --output_filename ~/tmp/greetings.json
 //
+// or with the historyexport command, which also prints a timeline of the run:
+//
+//	./bin/historyexport -w greetings_5d5f8e5c-4807-444d-9dc5-80abea22a324 -o greetings.json
+//
 // Or from Cadence Web UI. And you may need to change workflowType in the first event.
 func TestReplayWorkflowHistoryFromFile(t *testing.T) {
 	replayer := worker.NewWorkflowReplayer()
@@ -14,6 +14,10 @@ import (
 //
 //	cadence --do default wf show -w helloworld_d002cd3a-aeee-4a11-aa30-1c62385b4d87 --output_filename ~/tmp/helloworld.json
 //
+// or with the historyexport command, which also prints a timeline of the run:
+//
+//	./bin/historyexport -w helloworld_d002cd3a-aeee-4a11-aa30-1c62385b4d87 -o helloworld.json
+//
 // Or from Cadence Web UI. And you may need to change workflowType in the first event.
 func TestReplayWorkflowHistoryFromFile(t *testing.T) {
 	replayer := worker.NewWorkflowReplayer()
@@ -21,7 +21,7 @@ const (
 
 // This needs to be done as part of a bootstrap step when the process starts.
 // The workers are supposed to be long running.
-func startWorkers(h *common.SampleHelper) {
+func runWorkers(h *common.SampleHelper) {
 	// Configure worker options.
 	workerOptions := worker.Options{
 		MetricsScope:              h.WorkerMetricScope,
@@ -30,7 +30,7 @@ func startWorkers(h *common.SampleHelper) {
 	}
 
 	// Start Worker.
-	h.StartWorkers(h.Config.DomainName, ApplicationName, workerOptions)
+	h.RunWorkers(common.WorkerSpec{TaskList: ApplicationName, Options: workerOptions})
 }
 
 // startTwoWorkflows starts two workflows that operate on the same recourceID
@@ -67,11 +67,7 @@ func main() {
 		h.RegisterWorkflow(mutexWorkflow)
 		h.RegisterWorkflow(sampleWorkflowWithMutex)
 		h.RegisterActivity(signalWithStartMutexWorkflowActivity)
-		startWorkers(&h)
-
-		// The workers are supposed to be long running process that should not exit.
-		// Use select{} to block indefinitely for samples, you can quit by CMD+C.
-		select {}
+		runWorkers(&h)
 	case "trigger":
 		startTwoWorkflows(&h)
 	}
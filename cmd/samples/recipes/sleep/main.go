@@ -16,7 +16,7 @@ const (
 	SleepWorkflowName = "sleepWorkflow"
 )
 
-func startWorkers(h *common.SampleHelper) {
+func runWorkers(h *common.SampleHelper) {
 	workerOptions := worker.Options{
 		MetricsScope: h.WorkerMetricScope,
 		Logger:       h.Logger,
@@ -24,7 +24,7 @@ func startWorkers(h *common.SampleHelper) {
 			WorkflowExecutionAlreadyCompletedErrorEnabled: true,
 		},
 	}
-	h.StartWorkers(h.Config.DomainName, ApplicationName, workerOptions)
+	h.RunWorkers(common.WorkerSpec{TaskList: ApplicationName, Options: workerOptions})
 }
 
 func startWorkflow(h *common.SampleHelper) {
@@ -54,8 +54,7 @@ func main() {
 	switch mode {
 	case "worker":
 		registerWorkflowAndActivity(&h)
-		startWorkers(&h)
-		select {}
+		runWorkers(&h)
 	case "trigger":
 		startWorkflow(&h)
 	}
@@ -1,40 +1,60 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"time"
 
 	"github.com/pborman/uuid"
 	"go.uber.org/cadence/client"
 	"go.uber.org/cadence/worker"
+	"go.uber.org/zap"
 
 	"github.com/uber-common/cadence-samples/cmd/samples/common"
 )
 
 // This needs to be done as part of a bootstrap step when the process starts.
 // The workers are supposed to be long running.
-func startWorkers(h *common.SampleHelper) {
+func runWorkers(h *common.SampleHelper) {
 	// Configure worker options.
 	workerOptions := worker.Options{
 		MetricsScope: h.WorkerMetricScope,
 		Logger:       h.Logger,
 	}
-	h.StartWorkers(h.Config.DomainName, ApplicationName, workerOptions)
+	h.RunWorkers(common.WorkerSpec{TaskList: ApplicationName, Options: workerOptions})
 }
 
-func startWorkflow(h *common.SampleHelper) {
+// startWorkflow starts the workflow and, with wait, blocks until it completes and logs its typed result
+func startWorkflow(h *common.SampleHelper, wait bool) {
 	workflowOptions := client.StartWorkflowOptions{
 		ID:                              "splitmerge_" + uuid.New(),
 		TaskList:                        ApplicationName,
 		ExecutionStartToCloseTimeout:    time.Minute,
 		DecisionTaskStartToCloseTimeout: time.Minute,
 	}
-	h.StartWorkflow(workflowOptions, sampleSplitMergeWorkflow, 5)
+	ctx := context.Background()
+	run, err := common.StartTyped(ctx, h, workflowOptions, splitMergeWorkflow, 5)
+	if err != nil {
+		h.Logger.Error("Failed to start workflow.", zap.Error(err))
+		panic("Failed to start workflow.")
+	}
+	if !wait {
+		return
+	}
+
+	result, err := run.Get(ctx)
+	if err != nil {
+		h.Logger.Error("Workflow failed.", zap.Error(err))
+		return
+	}
+	h.Logger.Info("Workflow completed.", zap.Int("Items", result.NumberOfItemsInChunk), zap.Int("Sum", result.SumInChunk))
 }
 
 func main() {
 	var mode string
+	var wait bool
 	flag.StringVar(&mode, "m", "trigger", "Mode is worker or trigger.")
+	flag.BoolVar(&wait, "wait", false, "Wait for the workflow to complete and log its result.")
 	flag.Parse()
 
 	var h common.SampleHelper
@@ -44,12 +64,11 @@ func main() {
 	case "worker":
 		h.RegisterWorkflow(sampleSplitMergeWorkflow)
 		h.RegisterActivity(chunkProcessingActivity)
-		startWorkers(&h)
-
-		// The workers are supposed to be long running process that should not exit.
-		// Use select{} to block indefinitely for samples, you can quit by CMD+C.
-		select {}
+		if err := h.CheckTypedRegistrations(splitMergeWorkflow, chunkProcessing); err != nil {
+			panic(err)
+		}
+		runWorkers(&h)
 	case "trigger":
-		startWorkflow(&h)
+		startWorkflow(&h, wait)
 	}
 }
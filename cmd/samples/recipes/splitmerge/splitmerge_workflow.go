@@ -7,6 +7,8 @@ import (
 	"go.uber.org/cadence/activity"
 	"go.uber.org/cadence/workflow"
 	"go.uber.org/zap"
+
+	"github.com/uber-common/cadence-samples/cmd/samples/common"
 )
 
 /**
@@ -18,6 +20,13 @@ import (
 // ApplicationName is the task list for this sample
 const ApplicationName = "splitmergeGroup"
 
+var (
+	// splitMergeWorkflow and chunkProcessing are typed references to the workflow and activity below, registered
+	// under their default names. CheckTypedRegistrations verifies they match before the worker starts.
+	splitMergeWorkflow = common.WorkflowTypeOf(sampleSplitMergeWorkflow)
+	chunkProcessing    = common.ActivityTypeOf(chunkProcessingActivity)
+)
+
 type (
 	// ChunkResult contains the result for this sample
 	ChunkResult struct {
@@ -39,8 +48,7 @@ func sampleSplitMergeWorkflow(ctx workflow.Context, workerCount int) (ChunkResul
 	for i := 1; i <= workerCount; i++ {
 		chunkID := i
 		workflow.Go(ctx, func(ctx workflow.Context) {
-			var result ChunkResult
-			err := workflow.ExecuteActivity(ctx, chunkProcessingActivity, chunkID).Get(ctx, &result)
+			result, err := common.ExecuteTypedActivity(ctx, chunkProcessing, chunkID).GetTyped(ctx)
 			if err == nil {
 				chunkResultChannel.Send(ctx, result)
 			} else {
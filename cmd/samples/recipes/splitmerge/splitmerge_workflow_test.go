@@ -5,6 +5,8 @@ import (
 
 	"github.com/stretchr/testify/suite"
 	"go.uber.org/cadence/testsuite"
+
+	"github.com/uber-common/cadence-samples/cmd/samples/common"
 )
 
 type UnitTestSuite struct {
@@ -47,3 +49,10 @@ func (s *UnitTestSuite) Test_Workflow() {
 	s.Equal(totalItem, result.NumberOfItemsInChunk)
 	s.Equal(totalSum, result.SumInChunk)
 }
+
+func (s *UnitTestSuite) Test_TypedRegistrations() {
+	var h common.SampleHelper
+	h.RegisterWorkflow(sampleSplitMergeWorkflow)
+	h.RegisterActivity(chunkProcessingActivity)
+	s.NoError(h.CheckTypedRegistrations(splitMergeWorkflow, chunkProcessing))
+}
@@ -14,14 +14,14 @@ import (
 
 // This needs to be done as part of a bootstrap step when the process starts.
 // The workers are supposed to be long running.
-func startWorkers(h *common.SampleHelper) worker.Worker {
+func runWorkers(h *common.SampleHelper) {
 	// Configure worker options.
 	workerOptions := worker.Options{
 		MetricsScope:      h.WorkerMetricScope,
 		Logger:            h.Logger,
 		WorkerStopTimeout: 1 * time.Second,
 	}
-	return h.StartWorkers(h.Config.DomainName, ApplicationName, workerOptions)
+	h.RunWorkers(common.WorkerSpec{TaskList: ApplicationName, Options: workerOptions})
 }
 
 func startWorkflow(h *common.SampleHelper) {
@@ -78,11 +78,7 @@ func main() {
 			os.Exit(1)
 		}
 
-		startWorkers(&h)
-
-		// The workers are supposed to be long-running process that should not exit.
-		// Use select{} to block indefinitely for samples, you can quit by CMD+C.
-		select {}
+		runWorkers(&h)
 
 	case "trigger":
 		startWorkflow(&h)
@@ -1,6 +1,10 @@
 package cache
 
-import "time"
+import (
+	"time"
+
+	"github.com/uber-go/tally"
+)
 
 // A Cache is a generalized interface to a cache.  See cache.LRU for a specific
 // implementation (bounded cache with LRU eviction)
@@ -48,3 +52,73 @@ type Options struct {
 // appropriate signature and i is the interface{} scheduled for
 // deletion, Cache calls go f(i)
 type RemovedFunc func(interface{})
+
+// A TypedCache is a Cache with typed keys and values. See cache.NewTypedLRU
+// for an implementation bounded by entry count and size in bytes.
+type TypedCache[K comparable, V any] interface {
+	// Get retrieves an element based on a key, the bool is false if the
+	// element does not exist or has expired
+	Get(key K) (V, bool)
+
+	// GetOrLoad retrieves an element based on a key and calls load to fill
+	// the cache if it does not exist. Concurrent calls for the same key wait
+	// for a single load and share its result, or ErrLoadPanicked if it panics.
+	GetOrLoad(key K, load func(K) (V, error)) (V, error)
+
+	// Put adds an element to the cache, returning the previous element
+	Put(key K, value V) (V, bool)
+
+	// PutIfNotExist puts a value associated with a given key if it does not exist
+	PutIfNotExist(key K, value V) (V, error)
+
+	// Delete deletes an element in the cache
+	Delete(key K)
+
+	// Release decrements the ref count of a pinned element. If the ref count
+	// drops to 0, the element can be evicted from the cache.
+	Release(key K)
+
+	// Size returns the number of entries currently stored in the Cache
+	Size() int
+
+	// SizeBytes returns the total size of the entries currently stored in the Cache
+	SizeBytes() int64
+
+	// Close stops the background expiry of the Cache
+	Close()
+}
+
+// TypedOptions control the behavior of a TypedCache
+type TypedOptions[K comparable, V any] struct {
+	// TTL controls the time-to-live for a given cache entry.  Cache entries that
+	// are older than the TTL will not be returned
+	TTL time.Duration
+
+	// ExpiryInterval controls how often expired entries are removed in the
+	// background, defaults to the TTL. Expiry only runs when TTL is set.
+	ExpiryInterval time.Duration
+
+	// InitialCapacity controls the initial capacity of the cache
+	InitialCapacity int
+
+	// MaxSize bounds the number of entries, 0 does not bound them
+	MaxSize int
+
+	// MaxBytes bounds the total size of the entries as reported by SizeFunc,
+	// 0 does not bound it
+	MaxBytes int64
+
+	// SizeFunc returns the size of an entry in bytes, defaults to 1 per entry
+	SizeFunc func(key K, value V) int64
+
+	// Pin prevents in-use objects from getting evicted
+	Pin bool
+
+	// RemovedFunc is an optional function called in a new goroutine when an
+	// element is scheduled for deletion
+	RemovedFunc func(key K, value V)
+
+	// MetricsScope receives the hit, miss, eviction and expiration counters,
+	// defaults to tally.NoopScope
+	MetricsScope tally.Scope
+}
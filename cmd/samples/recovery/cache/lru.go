@@ -10,6 +10,8 @@ import (
 var (
 	// ErrCacheFull is returned if Put fails due to cache being filled with pinned elements
 	ErrCacheFull = errors.New("Cache capacity is fully occupied with pinned elements")
+	// ErrLoadPanicked is returned to the callers waiting for a GetOrLoad whose load function panicked
+	ErrLoadPanicked = errors.New("cache load panicked")
 )
 
 // lru is a concurrent fixed size cache that evicts elements in lru order
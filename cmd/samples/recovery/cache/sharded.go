@@ -0,0 +1,82 @@
+package cache
+
+// sharded is a concurrent cache that spreads keys over lru shards, each with
+// its own lock and lru list, so that callers on different keys rarely contend
+type sharded struct {
+	shards []*lru
+}
+
+// NewSharded creates a new cache of the given max size split into the given
+// number of shards. The max size is split exactly, the first maxSize%shards
+// shards hold one entry more than the others, and a cache smaller than the
+// number of shards gets one shard per entry. As keys are not spread evenly a
+// shard can be full while the cache as a whole is not. Eviction is in lru
+// order within each shard, pinning and Release work like they do in the lru.
+func NewSharded(shards, maxSize int, opts *Options) Cache {
+	if shards <= 0 {
+		shards = 1
+	}
+	if maxSize > 0 && shards > maxSize {
+		shards = maxSize
+	}
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	shardOpts := *opts
+	shardOpts.InitialCapacity = (opts.InitialCapacity + shards - 1) / shards
+
+	c := &sharded{shards: make([]*lru, shards)}
+	for i := range c.shards {
+		shardSize := maxSize / shards
+		if i < maxSize%shards {
+			shardSize++
+		}
+		c.shards[i] = New(shardSize, &shardOpts).(*lru)
+	}
+	return c
+}
+
+// Get retrieves the value stored under the given key
+func (c *sharded) Get(key string) interface{} {
+	return c.shard(key).Get(key)
+}
+
+// Put puts a new value associated with a given key, returning the existing value (if present)
+func (c *sharded) Put(key string, value interface{}) interface{} {
+	return c.shard(key).Put(key, value)
+}
+
+// PutIfNotExist puts a value associated with a given key if it does not exist
+func (c *sharded) PutIfNotExist(key string, value interface{}) (interface{}, error) {
+	return c.shard(key).PutIfNotExist(key, value)
+}
+
+// Delete deletes a key, value pair associated with a key
+func (c *sharded) Delete(key string) {
+	c.shard(key).Delete(key)
+}
+
+// Release decrements the ref count of a pinned element.
+func (c *sharded) Release(key string) {
+	c.shard(key).Release(key)
+}
+
+// Size returns the number of entries currently in all shards
+func (c *sharded) Size() int {
+	size := 0
+	for _, shard := range c.shards {
+		size += shard.Size()
+	}
+	return size
+}
+
+func (c *sharded) shard(key string) *lru {
+	// Inlined 32-bit FNV-1a, hash/fnv would allocate for every lookup
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return c.shards[h%uint32(len(c.shards))]
+}
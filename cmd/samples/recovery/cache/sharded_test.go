@@ -0,0 +1,179 @@
+package cache
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var cacheImpls = []struct {
+	name string
+	new  func(maxSize int, opts *Options) Cache
+}{
+	{"lru", New},
+	{"sharded", func(maxSize int, opts *Options) Cache { return NewSharded(16, maxSize, opts) }},
+}
+
+func TestShardedPinned(t *testing.T) {
+	// A single shard makes the eviction order deterministic
+	c := NewSharded(1, 3, &Options{Pin: true})
+
+	_, err := c.PutIfNotExist("a", 1)
+	require.NoError(t, err)
+	_, err = c.PutIfNotExist("b", 2)
+	require.NoError(t, err)
+	_, err = c.PutIfNotExist("c", 3)
+	assert.ErrorIs(t, err, ErrCacheFull)
+
+	// Get pins a again and makes b the least recently used entry
+	assert.Equal(t, 1, c.Get("a"))
+	c.Release("b")
+	_, err = c.PutIfNotExist("c", 3)
+	require.NoError(t, err)
+	assert.Nil(t, c.Get("b"))
+
+	// a is pinned twice and needs two releases before it can be evicted
+	c.Release("a")
+	_, err = c.PutIfNotExist("d", 4)
+	assert.ErrorIs(t, err, ErrCacheFull)
+	c.Release("a")
+	_, err = c.PutIfNotExist("d", 4)
+	require.NoError(t, err)
+	assert.Nil(t, c.Get("a"))
+	assert.Equal(t, 2, c.Size())
+}
+
+func TestShardedSplitsMaxSize(t *testing.T) {
+	for _, tc := range []struct {
+		shards, maxSize int
+		sizes           []int
+	}{
+		{shards: 4, maxSize: 10, sizes: []int{3, 3, 2, 2}},
+		{shards: 4, maxSize: 8, sizes: []int{2, 2, 2, 2}},
+		{shards: 16, maxSize: 10, sizes: []int{1, 1, 1, 1, 1, 1, 1, 1, 1, 1}},
+	} {
+		c := NewSharded(tc.shards, tc.maxSize, nil)
+		var sizes []int
+		for _, shard := range c.(*sharded).shards {
+			sizes = append(sizes, shard.maxSize)
+		}
+		assert.Equal(t, tc.sizes, sizes)
+
+		// The cache never holds more than its max size
+		for i := 0; i < 100; i++ {
+			c.Put(strconv.Itoa(i), i)
+		}
+		assert.LessOrEqual(t, c.Size(), tc.maxSize)
+	}
+}
+
+func TestShardedSpreadsKeys(t *testing.T) {
+	c := NewSharded(4, 400, nil)
+	for i := 0; i < 200; i++ {
+		c.Put(strconv.Itoa(i), i)
+	}
+	assert.Equal(t, 200, c.Size())
+	for _, shard := range c.(*sharded).shards {
+		assert.NotZero(t, shard.Size())
+	}
+	for i := 0; i < 200; i++ {
+		assert.Equal(t, i, c.Get(strconv.Itoa(i)))
+	}
+	c.Delete("7")
+	assert.Nil(t, c.Get("7"))
+}
+
+func TestCacheConcurrentAccess(t *testing.T) {
+	for _, impl := range cacheImpls {
+		t.Run(impl.name, func(t *testing.T) {
+			c := impl.new(64, nil)
+			var wg sync.WaitGroup
+			for g := 0; g < 8; g++ {
+				wg.Add(1)
+				go func(g int) {
+					defer wg.Done()
+					for i := 0; i < 1000; i++ {
+						key := strconv.Itoa((g*31 + i) % 100)
+						switch i % 4 {
+						case 0:
+							c.Put(key, i)
+						case 1:
+							c.Get(key)
+						case 2:
+							_, _ = c.PutIfNotExist(key, i)
+						case 3:
+							c.Delete(key)
+						}
+					}
+				}(g)
+			}
+			wg.Wait()
+			assert.LessOrEqual(t, c.Size(), 64)
+		})
+	}
+}
+
+func TestCacheConcurrentPinRelease(t *testing.T) {
+	for _, impl := range cacheImpls {
+		t.Run(impl.name, func(t *testing.T) {
+			c := impl.new(1024, &Options{Pin: true})
+			var wg sync.WaitGroup
+			for g := 0; g < 8; g++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for i := 0; i < 1000; i++ {
+						key := strconv.Itoa(i % 50)
+						if _, err := c.PutIfNotExist(key, i); err == nil {
+							c.Release(key)
+						}
+						if c.Get(key) != nil {
+							c.Release(key)
+						}
+					}
+				}()
+			}
+			wg.Wait()
+
+			// Every pin was released, so all entries can be evicted again
+			for i := 0; i < 50; i++ {
+				c.Delete(strconv.Itoa(i))
+			}
+			assert.Equal(t, 0, c.Size())
+		})
+	}
+}
+
+// BenchmarkCacheParallel compares the lru and the sharded cache under a read
+// heavy parallel load, run it with -cpu 1,4,8 to see the lock contention
+func BenchmarkCacheParallel(b *testing.B) {
+	keys := make([]string, 1024)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+	}
+
+	for _, impl := range cacheImpls {
+		b.Run(impl.name, func(b *testing.B) {
+			c := impl.new(2048, nil)
+			for _, key := range keys {
+				c.Put(key, key)
+			}
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					key := keys[i%len(keys)]
+					if i%10 == 0 {
+						c.Put(key, key)
+					} else {
+						c.Get(key)
+					}
+					i++
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,393 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/uber-go/tally"
+)
+
+const (
+	metricHit        = "cache_hit"
+	metricMiss       = "cache_miss"
+	metricEviction   = "cache_eviction"
+	metricExpiration = "cache_expiration"
+)
+
+// typedLRU is a concurrent cache bounded by entry count and size in bytes that
+// evicts elements in lru order
+type typedLRU[K comparable, V any] struct {
+	mut       sync.Mutex
+	byAccess  *list.List
+	byKey     map[K]*list.Element
+	loading   map[K]*loadCall[V]
+	maxSize   int
+	maxBytes  int64
+	sizeBytes int64
+	sizeFunc  func(K, V) int64
+	ttl       time.Duration
+	pin       bool
+	rmFunc    func(K, V)
+
+	hits        tally.Counter
+	misses      tally.Counter
+	evictions   tally.Counter
+	expirations tally.Counter
+
+	closeOnce sync.Once
+	closeCh   chan struct{}
+}
+
+type typedEntry[K comparable, V any] struct {
+	key        K
+	expiration time.Time
+	value      V
+	size       int64
+	refCount   int
+}
+
+// loadCall is a GetOrLoad in progress, the callers waiting for the same key
+// read its result once done is closed
+type loadCall[V any] struct {
+	done  chan struct{}
+	value V
+	err   error
+}
+
+// NewTypedLRU creates a new typed cache with the given options. When TTL is
+// set a goroutine removes expired entries until Close is called.
+func NewTypedLRU[K comparable, V any](opts TypedOptions[K, V]) TypedCache[K, V] {
+	scope := opts.MetricsScope
+	if scope == nil {
+		scope = tally.NoopScope
+	}
+	sizeFunc := opts.SizeFunc
+	if sizeFunc == nil {
+		sizeFunc = func(K, V) int64 { return 1 }
+	}
+
+	c := &typedLRU[K, V]{
+		byAccess:    list.New(),
+		byKey:       make(map[K]*list.Element, opts.InitialCapacity),
+		loading:     make(map[K]*loadCall[V]),
+		maxSize:     opts.MaxSize,
+		maxBytes:    opts.MaxBytes,
+		sizeFunc:    sizeFunc,
+		ttl:         opts.TTL,
+		pin:         opts.Pin,
+		rmFunc:      opts.RemovedFunc,
+		hits:        scope.Counter(metricHit),
+		misses:      scope.Counter(metricMiss),
+		evictions:   scope.Counter(metricEviction),
+		expirations: scope.Counter(metricExpiration),
+		closeCh:     make(chan struct{}),
+	}
+
+	if c.ttl > 0 {
+		interval := opts.ExpiryInterval
+		if interval <= 0 {
+			interval = c.ttl
+		}
+		go c.expireLoop(interval)
+	}
+	return c
+}
+
+// Get retrieves the value stored under the given key
+func (c *typedLRU[K, V]) Get(key K) (V, bool) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	return c.getLocked(key)
+}
+
+// GetOrLoad retrieves the value stored under the given key, loading it once
+// for all concurrent callers if it does not exist
+func (c *typedLRU[K, V]) GetOrLoad(key K, load func(K) (V, error)) (V, error) {
+	c.mut.Lock()
+	if value, ok := c.getLocked(key); ok {
+		c.mut.Unlock()
+		return value, nil
+	}
+
+	if call, ok := c.loading[key]; ok {
+		c.mut.Unlock()
+		<-call.done
+		if call.err != nil {
+			var zero V
+			return zero, call.err
+		}
+		c.mut.Lock()
+		if elt := c.byKey[key]; elt != nil && c.pin {
+			elt.Value.(*typedEntry[K, V]).refCount++
+		}
+		c.mut.Unlock()
+		return call.value, nil
+	}
+
+	// The result stays ErrLoadPanicked if load panics, the deferred cleanup releases the waiting callers either way
+	call := &loadCall[V]{done: make(chan struct{}), err: ErrLoadPanicked}
+	c.loading[key] = call
+	c.mut.Unlock()
+	defer func() {
+		c.mut.Lock()
+		delete(c.loading, key)
+		c.mut.Unlock()
+		close(call.done)
+	}()
+
+	value, err := load(key)
+
+	c.mut.Lock()
+	if err == nil {
+		if existing, ok, putErr := c.putLocked(key, value, false); putErr != nil {
+			err = putErr
+		} else if ok {
+			// Put by another caller while loading
+			value = existing
+		}
+	}
+	call.value, call.err = value, err
+	c.mut.Unlock()
+
+	if err != nil {
+		var zero V
+		return zero, err
+	}
+	return value, nil
+}
+
+// Put puts a new value associated with a given key, returning the existing value (if present)
+func (c *typedLRU[K, V]) Put(key K, value V) (V, bool) {
+	if c.pin {
+		panic("Cannot use Put API in Pin mode. Use Delete and PutIfNotExist if necessary")
+	}
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	existing, ok, _ := c.putLocked(key, value, true)
+	return existing, ok
+}
+
+// PutIfNotExist puts a value associated with a given key if it does not exist
+func (c *typedLRU[K, V]) PutIfNotExist(key K, value V) (V, error) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	existing, ok, err := c.putLocked(key, value, false)
+	if err != nil {
+		var zero V
+		return zero, err
+	}
+	if ok {
+		return existing, nil
+	}
+	return value, nil
+}
+
+// Delete deletes a key, value pair associated with a key
+func (c *typedLRU[K, V]) Delete(key K) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	if elt := c.byKey[key]; elt != nil {
+		c.removeLocked(elt)
+	}
+}
+
+// Release decrements the ref count of a pinned element.
+func (c *typedLRU[K, V]) Release(key K) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	if elt := c.byKey[key]; elt != nil {
+		entry := elt.Value.(*typedEntry[K, V])
+		if entry.refCount > 0 {
+			entry.refCount--
+		}
+	}
+}
+
+// Size returns the number of entries currently in the lru
+func (c *typedLRU[K, V]) Size() int {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	return len(c.byKey)
+}
+
+// SizeBytes returns the total size of the entries currently in the lru
+func (c *typedLRU[K, V]) SizeBytes() int64 {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	return c.sizeBytes
+}
+
+// Close stops the background expiry, the cache stays usable with lazy expiry
+func (c *typedLRU[K, V]) Close() {
+	c.closeOnce.Do(func() { close(c.closeCh) })
+}
+
+func (c *typedLRU[K, V]) getLocked(key K) (V, bool) {
+	var zero V
+	elt := c.byKey[key]
+	if elt == nil {
+		c.misses.Inc(1)
+		return zero, false
+	}
+
+	entry := elt.Value.(*typedEntry[K, V])
+	if entry.refCount == 0 && c.expired(entry, time.Now()) {
+		c.removeLocked(elt)
+		c.expirations.Inc(1)
+		c.misses.Inc(1)
+		return zero, false
+	}
+
+	if c.pin {
+		entry.refCount++
+	}
+	c.byAccess.MoveToFront(elt)
+	c.hits.Inc(1)
+	return entry.value, true
+}
+
+// putLocked puts a new value associated with a given key, returning the existing value (if present)
+// allowUpdate flag is used to control overwrite behavior if the value exists
+func (c *typedLRU[K, V]) putLocked(key K, value V, allowUpdate bool) (V, bool, error) {
+	if elt := c.byKey[key]; elt != nil {
+		entry := elt.Value.(*typedEntry[K, V])
+		existing := entry.value
+		if allowUpdate {
+			// Check the room for the new value before changing the entry, a failed update leaves it as it was
+			size := c.sizeFunc(key, value)
+			if !c.fitsLocked(elt, size-entry.size) {
+				var zero V
+				return zero, false, ErrCacheFull
+			}
+			c.sizeBytes += size - entry.size
+			entry.value, entry.size = value, size
+		}
+		if c.ttl != 0 {
+			entry.expiration = time.Now().Add(c.ttl)
+		}
+		c.byAccess.MoveToFront(elt)
+		if c.pin {
+			entry.refCount++
+		}
+		if err := c.evictLocked(elt); err != nil {
+			var zero V
+			return zero, false, err
+		}
+		return existing, true, nil
+	}
+
+	entry := &typedEntry[K, V]{
+		key:   key,
+		value: value,
+		size:  c.sizeFunc(key, value),
+	}
+	if c.pin {
+		entry.refCount++
+	}
+	if c.ttl != 0 {
+		entry.expiration = time.Now().Add(c.ttl)
+	}
+
+	elt := c.byAccess.PushFront(entry)
+	c.byKey[key] = elt
+	c.sizeBytes += entry.size
+	if err := c.evictLocked(elt); err != nil {
+		// Cache is full with pinned elements, revert the insert
+		c.byAccess.Remove(elt)
+		delete(c.byKey, key)
+		c.sizeBytes -= entry.size
+		var zero V
+		return zero, false, err
+	}
+	return value, false, nil
+}
+
+// evictLocked removes unpinned elements in lru order, sparing keep, until the
+// cache is back within its bounds
+func (c *typedLRU[K, V]) evictLocked(keep *list.Element) error {
+	elt := c.byAccess.Back()
+	for c.overLimit() {
+		for elt != nil && (elt == keep || elt.Value.(*typedEntry[K, V]).refCount > 0) {
+			elt = elt.Prev()
+		}
+		if elt == nil {
+			return ErrCacheFull
+		}
+		prev := elt.Prev()
+		c.removeLocked(elt)
+		c.evictions.Inc(1)
+		elt = prev
+	}
+	return nil
+}
+
+// fitsLocked reports whether evicting unpinned elements other than keep makes
+// room for extraBytes more bytes
+func (c *typedLRU[K, V]) fitsLocked(keep *list.Element, extraBytes int64) bool {
+	if c.maxBytes <= 0 {
+		return true
+	}
+	sizeBytes := c.sizeBytes + extraBytes
+	for elt := c.byAccess.Back(); elt != nil && sizeBytes > c.maxBytes; elt = elt.Prev() {
+		if entry := elt.Value.(*typedEntry[K, V]); elt != keep && entry.refCount == 0 {
+			sizeBytes -= entry.size
+		}
+	}
+	return sizeBytes <= c.maxBytes
+}
+
+func (c *typedLRU[K, V]) overLimit() bool {
+	return (c.maxSize > 0 && len(c.byKey) > c.maxSize) || (c.maxBytes > 0 && c.sizeBytes > c.maxBytes)
+}
+
+func (c *typedLRU[K, V]) removeLocked(elt *list.Element) {
+	entry := c.byAccess.Remove(elt).(*typedEntry[K, V])
+	delete(c.byKey, entry.key)
+	c.sizeBytes -= entry.size
+	if c.rmFunc != nil {
+		go c.rmFunc(entry.key, entry.value)
+	}
+}
+
+func (c *typedLRU[K, V]) expired(entry *typedEntry[K, V], now time.Time) bool {
+	return !entry.expiration.IsZero() && now.After(entry.expiration)
+}
+
+func (c *typedLRU[K, V]) expireLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.closeCh:
+			return
+		case now := <-ticker.C:
+			c.expire(now)
+		}
+	}
+}
+
+// expire removes the unpinned entries that expired before now
+func (c *typedLRU[K, V]) expire(now time.Time) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	for elt := c.byAccess.Back(); elt != nil; {
+		prev := elt.Prev()
+		entry := elt.Value.(*typedEntry[K, V])
+		if entry.refCount == 0 && c.expired(entry, now) {
+			c.removeLocked(elt)
+			c.expirations.Inc(1)
+		}
+		elt = prev
+	}
+}
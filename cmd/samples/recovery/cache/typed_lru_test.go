@@ -0,0 +1,194 @@
+package cache
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+func counterValue(scope tally.TestScope, name string) int64 {
+	if counter, ok := scope.Snapshot().Counters()[name+"+"]; ok {
+		return counter.Value()
+	}
+	return 0
+}
+
+func TestTypedLRUEvictsBySizeAndBytes(t *testing.T) {
+	scope := tally.NewTestScope("", nil)
+	var removed sync.WaitGroup
+	removed.Add(2)
+	c := NewTypedLRU(TypedOptions[string, []byte]{
+		MaxSize:      3,
+		MaxBytes:     10,
+		SizeFunc:     func(_ string, value []byte) int64 { return int64(len(value)) },
+		RemovedFunc:  func(string, []byte) { removed.Done() },
+		MetricsScope: scope,
+	})
+	defer c.Close()
+
+	c.Put("a", []byte("1234"))
+	c.Put("b", []byte("1234"))
+	_, ok := c.Get("a")
+	assert.True(t, ok)
+	// b is the least recently used and evicted to make room for the bytes of c
+	c.Put("c", []byte("12"))
+	c.Put("d", []byte("12"))
+	assert.Equal(t, int64(8), c.SizeBytes())
+	_, ok = c.Get("b")
+	assert.False(t, ok)
+
+	// a is evicted to stay within 3 entries
+	c.Put("e", []byte("1"))
+	assert.Equal(t, 3, c.Size())
+	_, ok = c.Get("a")
+	assert.False(t, ok)
+	removed.Wait()
+
+	assert.Equal(t, int64(1), counterValue(scope, metricHit))
+	assert.Equal(t, int64(2), counterValue(scope, metricMiss))
+	assert.Equal(t, int64(2), counterValue(scope, metricEviction))
+}
+
+func TestTypedLRUPinned(t *testing.T) {
+	c := NewTypedLRU(TypedOptions[string, int]{MaxSize: 2, Pin: true})
+	defer c.Close()
+
+	_, err := c.PutIfNotExist("a", 1)
+	require.NoError(t, err)
+	_, err = c.PutIfNotExist("b", 2)
+	require.NoError(t, err)
+	_, err = c.PutIfNotExist("c", 3)
+	assert.ErrorIs(t, err, ErrCacheFull)
+	assert.Panics(t, func() { c.Put("a", 1) })
+
+	c.Release("a")
+	_, err = c.PutIfNotExist("c", 3)
+	require.NoError(t, err)
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+	value, ok := c.Get("b")
+	assert.True(t, ok)
+	assert.Equal(t, 2, value)
+}
+
+func TestTypedLRUGetOrLoadSingleFlight(t *testing.T) {
+	c := NewTypedLRU(TypedOptions[string, int]{})
+	defer c.Close()
+
+	var loads int32
+	release := make(chan struct{})
+	load := func(key string) (int, error) {
+		atomic.AddInt32(&loads, 1)
+		<-release
+		return len(key), nil
+	}
+
+	var wg sync.WaitGroup
+	results := make([]int, 10)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			value, err := c.GetOrLoad("key", load)
+			assert.NoError(t, err)
+			results[i] = value
+		}(i)
+	}
+	// Let the callers queue up behind the first load
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&loads))
+	for _, value := range results {
+		assert.Equal(t, 3, value)
+	}
+
+	loadErr := errors.New("load failed")
+	_, err := c.GetOrLoad("other", func(string) (int, error) { return 0, loadErr })
+	assert.ErrorIs(t, err, loadErr)
+	_, ok := c.Get("other")
+	assert.False(t, ok)
+}
+
+func TestTypedLRUGetOrLoadPanic(t *testing.T) {
+	c := NewTypedLRU(TypedOptions[string, int]{})
+	defer c.Close()
+
+	loading := make(chan struct{})
+	release := make(chan struct{})
+	go func() {
+		defer func() { _ = recover() }()
+		_, _ = c.GetOrLoad("key", func(string) (int, error) {
+			close(loading)
+			<-release
+			panic("load failed")
+		})
+	}()
+	<-loading
+
+	waitErr := make(chan error)
+	go func() {
+		_, err := c.GetOrLoad("key", func(string) (int, error) { return 1, nil })
+		waitErr <- err
+	}()
+	// Let the second caller wait for the panicking load
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	assert.ErrorIs(t, <-waitErr, ErrLoadPanicked)
+
+	// The key is loaded again by the next caller
+	value, err := c.GetOrLoad("key", func(string) (int, error) { return 2, nil })
+	require.NoError(t, err)
+	assert.Equal(t, 2, value)
+}
+
+func TestTypedLRUFailedUpdateKeepsEntry(t *testing.T) {
+	c := NewTypedLRU(TypedOptions[string, []byte]{
+		MaxBytes: 10,
+		SizeFunc: func(_ string, value []byte) int64 { return int64(len(value)) },
+	})
+	defer c.Close()
+
+	c.Put("a", []byte("aaaa"))
+	c.Put("b", []byte("bbbb"))
+
+	// The new value of a does not fit even after evicting b
+	_, ok := c.Put("a", []byte("aaaaaaaaaaa"))
+	assert.False(t, ok)
+	value, ok := c.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, []byte("aaaa"), value)
+	_, ok = c.Get("b")
+	assert.True(t, ok)
+	assert.Equal(t, int64(8), c.SizeBytes())
+
+	// A value that fits after evicting b replaces the old one
+	existing, ok := c.Put("a", []byte("aaaaaaaa"))
+	assert.True(t, ok)
+	assert.Equal(t, []byte("aaaa"), existing)
+	_, ok = c.Get("b")
+	assert.False(t, ok)
+	assert.Equal(t, int64(8), c.SizeBytes())
+}
+
+func TestTypedLRUBackgroundExpiry(t *testing.T) {
+	scope := tally.NewTestScope("", nil)
+	c := NewTypedLRU(TypedOptions[string, int]{
+		TTL:            20 * time.Millisecond,
+		ExpiryInterval: 5 * time.Millisecond,
+		MetricsScope:   scope,
+	})
+	defer c.Close()
+
+	c.Put("a", 1)
+	// Size does not check the TTL, only the background expiry removes the entry
+	assert.Eventually(t, func() bool { return c.Size() == 0 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, int64(1), counterValue(scope, metricExpiration))
+}
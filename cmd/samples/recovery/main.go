@@ -4,6 +4,8 @@ import (
 	"context"
 	"encoding/json"
 	"flag"
+	"os"
+	"path/filepath"
 	"time"
 
 	"go.uber.org/cadence/client"
@@ -11,19 +13,25 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/uber-common/cadence-samples/cmd/samples/common"
-	"github.com/uber-common/cadence-samples/cmd/samples/recovery/cache"
+	"github.com/uber-common/cadence-samples/cmd/samples/recovery/store"
 )
 
 // This needs to be done as part of a bootstrap step when the process starts.
 // The workers are supposed to be long running.
-func startWorkers(h *common.SampleHelper) {
+func runWorkers(h *common.SampleHelper, storeDir string) {
+	executionStore, err := store.NewFileStore(storeDir)
+	if err != nil {
+		h.Logger.Error("Failed to open execution store.", zap.Error(err))
+		panic(err)
+	}
 	workflowClient, err := h.Builder.BuildCadenceClient()
 	if err != nil {
 		h.Logger.Error("Failed to build cadence client.", zap.Error(err))
 		panic(err)
 	}
 	ctx := context.WithValue(context.Background(), CadenceClientKey, workflowClient)
-	ctx = context.WithValue(ctx, WorkflowExecutionCacheKey, cache.NewLRU(10))
+	ctx = context.WithValue(ctx, ExecutionStoreKey, executionStore)
+	ctx = context.WithValue(ctx, DomainKey, h.Config.DomainName)
 
 	// Configure worker options.
 	workerOptions := worker.Options{
@@ -32,8 +40,6 @@ func startWorkers(h *common.SampleHelper) {
 		BackgroundActivityContext: ctx,
 	}
 
-	h.StartWorkers(h.Config.DomainName, ApplicationName, workerOptions)
-
 	// Configure worker options.
 	hostSpecificWorkerOptions := worker.Options{
 		MetricsScope: h.WorkerMetricScope,
@@ -42,7 +48,10 @@ func startWorkers(h *common.SampleHelper) {
 		DisableWorkflowWorker: true,
 	}
 
-	h.StartWorkers(h.Config.DomainName, HostID, hostSpecificWorkerOptions)
+	h.RunWorkers(
+		common.WorkerSpec{TaskList: ApplicationName, Options: workerOptions},
+		common.WorkerSpec{TaskList: HostID, Options: hostSpecificWorkerOptions},
+	)
 }
 
 func startTripWorkflow(h *common.SampleHelper, workflowID string, user UserState) {
@@ -66,12 +75,13 @@ func startRecoveryWorkflow(h *common.SampleHelper, workflowID string, params Par
 }
 
 func main() {
-	var mode, workflowID,signal, input, workflowType string
+	var mode, workflowID,signal, input, workflowType, storeDir string
 	flag.StringVar(&mode, "m", "trigger", "Mode is worker or trigger.")
 	flag.StringVar(&workflowID, "w", "workflow_A", "WorkflowID")
 	flag.StringVar(&signal, "s", "signal_data", "SignalData")
 	flag.StringVar(&input, "i", "{}", "Workflow input parameters.")
 	flag.StringVar(&workflowType, "wt", "main.tripWorkflow", "Workflow type.")
+	flag.StringVar(&storeDir, "store-dir", filepath.Join(os.TempDir(), "cadence-recovery"), "Directory of the execution store, shared by the recovery workers.")
 	flag.Parse()
 
 	var h common.SampleHelper
@@ -83,11 +93,8 @@ func main() {
 		h.RegisterWorkflowWithAlias(tripWorkflow, "tripWorkflow")
 		h.RegisterActivity(listOpenExecutions)
 		h.RegisterActivity(recoverExecutions)
-		startWorkers(&h)
-
-		// The workers are supposed to be long running process that should not exit.
-		// Use select{} to block indefinitely for samples, you can quit by CMD+C.
-		select {}
+		h.RegisterActivity(deleteExecutions)
+		runWorkers(&h, storeDir)
 	case "trigger":
 		switch workflowType {
 		case "tripworkflow":
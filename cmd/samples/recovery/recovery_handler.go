@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"go.uber.org/cadence/.gen/go/shared"
+	"go.uber.org/cadence/client"
+)
+
+// RecoveryHandler tells recoverWorkflow how to restart the executions of one workflow type. Nil fields use the
+// defaults, which restart an execution with its original input, signals and options.
+type RecoveryHandler struct {
+	// ExtractState returns the arguments of the new run from the encoded input of the broken one. An error marks
+	// the state as corrupted and fails the recovery of the execution. The default passes the input through unchanged.
+	ExtractState func(input []byte) ([]interface{}, error)
+	// TransformSignal returns the signal sent to the new run for a signal the broken run received, or nil to drop
+	// it. The default sends every signal again unchanged.
+	TransformSignal func(name string, input []byte) (*SignalParams, error)
+	// RestartOptions returns the options the new run is started with. The default keeps the workflow ID, task list
+	// and timeouts of the broken run.
+	RestartOptions func(workflowID string, attr *shared.WorkflowExecutionStartedEventAttributes) client.StartWorkflowOptions
+}
+
+var recoveryHandlers = map[string]RecoveryHandler{}
+
+// RegisterRecoveryHandler registers how executions of the workflow type are restarted. Call it from init, like
+// workflow.Register; registering a type twice panics.
+func RegisterRecoveryHandler(workflowType string, handler RecoveryHandler) {
+	if _, ok := recoveryHandlers[workflowType]; ok {
+		panic(fmt.Sprintf("recovery handler for workflow type %v is already registered", workflowType))
+	}
+	if handler.ExtractState == nil {
+		handler.ExtractState = passThroughState
+	}
+	if handler.TransformSignal == nil {
+		handler.TransformSignal = passThroughSignal
+	}
+	if handler.RestartOptions == nil {
+		handler.RestartOptions = defaultRestartOptions
+	}
+	recoveryHandlers[workflowType] = handler
+}
+
+func getRecoveryHandler(workflowType string) (RecoveryHandler, error) {
+	handler, ok := recoveryHandlers[workflowType]
+	if !ok {
+		return RecoveryHandler{}, fmt.Errorf("no recovery handler registered for workflow type %v", workflowType)
+	}
+	return handler, nil
+}
+
+// passThroughState returns the encoded input as the only argument, the data converter sends a single []byte
+// argument as is
+func passThroughState(input []byte) ([]interface{}, error) {
+	if len(input) == 0 {
+		return nil, nil
+	}
+	return []interface{}{input}, nil
+}
+
+func passThroughSignal(name string, input []byte) (*SignalParams, error) {
+	return &SignalParams{Name: name, Data: input}, nil
+}
+
+func defaultRestartOptions(workflowID string, attr *shared.WorkflowExecutionStartedEventAttributes) client.StartWorkflowOptions {
+	return client.StartWorkflowOptions{
+		ID:                              workflowID,
+		TaskList:                        attr.TaskList.GetName(),
+		ExecutionStartToCloseTimeout:    time.Second * time.Duration(attr.GetExecutionStartToCloseTimeoutSeconds()),
+		DecisionTaskStartToCloseTimeout: time.Second * time.Duration(attr.GetTaskStartToCloseTimeoutSeconds()),
+		WorkflowIDReusePolicy:           client.WorkflowIDReusePolicyAllowDuplicate,
+		//RetryPolicy: attr.RetryPolicy,
+	}
+}
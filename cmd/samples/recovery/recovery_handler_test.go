@@ -0,0 +1,80 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/cadence/.gen/go/shared"
+	"go.uber.org/cadence/client"
+
+	"github.com/uber-common/cadence-samples/cmd/samples/common"
+)
+
+func startedEvent(workflowType string, input string) *shared.HistoryEvent {
+	return &shared.HistoryEvent{
+		EventId:   common.Int64Ptr(1),
+		EventType: shared.EventTypeWorkflowExecutionStarted.Ptr(),
+		WorkflowExecutionStartedEventAttributes: &shared.WorkflowExecutionStartedEventAttributes{
+			WorkflowType:                        &shared.WorkflowType{Name: common.StringPtr(workflowType)},
+			TaskList:                            &shared.TaskList{Name: common.StringPtr(ApplicationName)},
+			Input:                               []byte(input),
+			ExecutionStartToCloseTimeoutSeconds: common.Int32Ptr(3600),
+			TaskStartToCloseTimeoutSeconds:      common.Int32Ptr(10),
+		},
+	}
+}
+
+func signaledEvent(name, input string) *shared.HistoryEvent {
+	return &shared.HistoryEvent{
+		EventType: shared.EventTypeWorkflowExecutionSignaled.Ptr(),
+		WorkflowExecutionSignaledEventAttributes: &shared.WorkflowExecutionSignaledEventAttributes{
+			SignalName: common.StringPtr(name),
+			Input:      []byte(input),
+		},
+	}
+}
+
+func TestTripRecoveryHandler(t *testing.T) {
+	handler, err := getRecoveryHandler("tripWorkflow")
+	require.NoError(t, err)
+
+	params, err := extractStateFromEvent("UserA", startedEvent("tripWorkflow", `{"TripCounter":3}`), handler)
+	require.NoError(t, err)
+	assert.Equal(t, "tripWorkflow", params.WorkflowType)
+	assert.Equal(t, []interface{}{UserState{TripCounter: 3}}, params.Args)
+	assert.Equal(t, "UserA", params.Options.ID)
+	assert.Equal(t, ApplicationName, params.Options.TaskList)
+	assert.Equal(t, client.WorkflowIDReusePolicyAllowDuplicate, params.Options.WorkflowIDReusePolicy)
+
+	signals, err := extractSignals([]*shared.HistoryEvent{
+		signaledEvent(TripSignalName, `{"ID":"Trip1","Total":10}`),
+		signaledEvent("other", `{}`),
+		signaledEvent(TripSignalName, ``),
+	}, handler)
+	require.NoError(t, err)
+	assert.Equal(t, []*SignalParams{{Name: TripSignalName, Data: TripEvent{ID: "Trip1", Total: 10}}}, signals)
+
+	_, err = extractStateFromEvent("UserA", startedEvent("tripWorkflow", `not json`), handler)
+	assert.Error(t, err)
+}
+
+func TestDefaultRecoveryHandler(t *testing.T) {
+	RegisterRecoveryHandler("orderWorkflow", RecoveryHandler{})
+	t.Cleanup(func() { delete(recoveryHandlers, "orderWorkflow") })
+	assert.Panics(t, func() { RegisterRecoveryHandler("orderWorkflow", RecoveryHandler{}) })
+
+	handler, err := getRecoveryHandler("orderWorkflow")
+	require.NoError(t, err)
+	params, err := extractStateFromEvent("order-1", startedEvent("orderWorkflow", "\"order-1\"\n2\n"), handler)
+	require.NoError(t, err)
+	assert.Equal(t, "orderWorkflow", params.WorkflowType)
+	assert.Equal(t, []interface{}{[]byte("\"order-1\"\n2\n")}, params.Args)
+
+	signals, err := extractSignals([]*shared.HistoryEvent{signaledEvent("cancel", `"now"`)}, handler)
+	require.NoError(t, err)
+	assert.Equal(t, []*SignalParams{{Name: "cancel", Data: []byte(`"now"`)}}, signals)
+
+	_, err = getRecoveryHandler("unknownWorkflow")
+	assert.ErrorContains(t, err, "no recovery handler registered for workflow type unknownWorkflow")
+}
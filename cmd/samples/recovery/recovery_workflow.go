@@ -3,6 +3,8 @@ package main
 import (
 	"context"
 	"errors"
+	"fmt"
+	"regexp"
 	"time"
 
 	"github.com/pborman/uuid"
@@ -14,7 +16,7 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/uber-common/cadence-samples/cmd/samples/common"
-	"github.com/uber-common/cadence-samples/cmd/samples/recovery/cache"
+	"github.com/uber-common/cadence-samples/cmd/samples/recovery/store"
 )
 
 type (
@@ -23,50 +25,93 @@ type (
 		ID          string
 		Type        string
 		Concurrency int
+		// Mode is restart (default) or reset
+		Mode RecoveryMode
+		// ResetPoint selects the decision executions are reset to in reset mode, defaults to the last completed decision
+		ResetPoint common.ResetPoint
+		// ExecutionsInHistory passes the executions to the recovery activities in chunks through workflow history
+		// instead of the execution store. It needs no store shared by the workers, but the list has to fit into the
+		// payload size limit.
+		ExecutionsInHistory bool
 	}
 
+	// RecoveryMode selects how an execution is recovered
+	RecoveryMode string
+
 	// ListOpenExecutionsResult is the result returned from listOpenExecutions activity
 	ListOpenExecutionsResult struct {
 		ID     string
 		Count  int
 		HostID string
+		// Executions is only set with Params.ExecutionsInHistory, otherwise they are stored under ID
+		Executions []*shared.WorkflowExecution `json:",omitempty"`
+	}
+
+	// listProgress is the heartbeat of listOpenExecutions, the token of the page to continue the listing from, the
+	// number of executions listed before that page and, when the executions are not stored, those executions
+	listProgress struct {
+		PageToken  []byte
+		Count      int
+		Executions []*shared.WorkflowExecution `json:",omitempty"`
+	}
+
+	// RecoveryBatch is the part of the executions one recoverExecutions activity recovers
+	RecoveryBatch struct {
+		// Key is the key of the executions in the execution store
+		Key        string
+		StartIndex int
+		BatchSize  int
+		// Executions is the chunk to recover when the executions are passed through history
+		Executions []*shared.WorkflowExecution `json:",omitempty"`
 	}
 
 	// RestartParams are parameters extracted from StartWorkflowExecution history event
 	RestartParams struct {
-		Options client.StartWorkflowOptions
-		State   UserState
+		WorkflowType string
+		Options      client.StartWorkflowOptions
+		Args         []interface{}
 	}
 
 	// SignalParams are the parameters extracted from SignalWorkflowExecution history event
 	SignalParams struct {
 		Name string
-		Data TripEvent
+		Data interface{}
 	}
 )
 
+const (
+	// RecoveryModeRestart terminates the execution, starts a new run with the input of the old one and sends the
+	// signals of the old run again. Activity results are lost and the new run is not linked to the old one.
+	RecoveryModeRestart RecoveryMode = "restart"
+	// RecoveryModeReset resets the execution to a completed decision with ResetWorkflowExecution. The new run keeps
+	// the history before that decision, including activity results, and the signals received after it.
+	RecoveryModeReset RecoveryMode = "reset"
+)
+
 // ClientKey is the key for lookup
 type ClientKey int
 
 const (
-	// DomainName used for this sample
-	DomainName = "default"
-
 	// CadenceClientKey for retrieving cadence client from context
 	CadenceClientKey ClientKey = iota
-	// WorkflowExecutionCacheKey for retrieving executions cache from context
-	WorkflowExecutionCacheKey
+	// ExecutionStoreKey for retrieving the execution store from context
+	ExecutionStoreKey
+	// DomainKey for retrieving the domain the sample runs in from context
+	DomainKey
 )
 
 // HostID - Use a new uuid just for demo so we can run 2 host specific activity workers on same machine.
 // In real world case, you would use a hostname or ip address as HostID.
 var HostID = uuid.New()
 
+// invalidKeyChars are the characters of a workflow ID the execution store does not accept in a key
+var invalidKeyChars = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+
 var (
 	// ErrCadenceClientNotFound when cadence client is not found on context
 	ErrCadenceClientNotFound = errors.New("failed to retrieve cadence client from context")
-	// ErrExecutionCacheNotFound when executions cache is not found on context
-	ErrExecutionCacheNotFound = errors.New("failed to retrieve cache from context")
+	// ErrExecutionStoreNotFound when the execution store is not found on context
+	ErrExecutionStoreNotFound = errors.New("failed to retrieve execution store from context")
 )
 
 // This is registration process where you register all your workflows
@@ -75,22 +120,40 @@ func init() {
 	workflow.RegisterWithOptions(recoverWorkflow, workflow.RegisterOptions{Name: "recoverWorkflow"})
 	activity.Register(listOpenExecutions)
 	activity.Register(recoverExecutions)
+	activity.Register(deleteExecutions)
 }
 
 // recoverWorkflow is the workflow implementation to recover TripWorkflow executions
 func recoverWorkflow(ctx workflow.Context, params Params) error {
 	logger := workflow.GetLogger(ctx)
 	logger.Info("Recover workflow started.")
+	switch params.mode() {
+	case RecoveryModeRestart:
+		if _, err := getRecoveryHandler(params.Type); err != nil {
+			return err
+		}
+	case RecoveryModeReset:
+	default:
+		return fmt.Errorf("unknown recovery mode %q, expected restart or reset", params.Mode)
+	}
 
+	// A retried listing resumes from the page it heartbeated last
 	ao := workflow.ActivityOptions{
 		ScheduleToStartTimeout: 10 * time.Minute,
 		StartToCloseTimeout:    10 * time.Minute,
 		HeartbeatTimeout:       time.Second * 30,
+		RetryPolicy: &cadence.RetryPolicy{
+			InitialInterval:    time.Second,
+			BackoffCoefficient: 2,
+			MaximumInterval:    10 * time.Second,
+			ExpirationInterval: 10 * time.Minute,
+			MaximumAttempts:    5,
+		},
 	}
 	ctx = workflow.WithActivityOptions(ctx, ao)
 
 	var result ListOpenExecutionsResult
-	err := workflow.ExecuteActivity(ctx, listOpenExecutions, params.Type).Get(ctx, &result)
+	err := workflow.ExecuteActivity(ctx, listOpenExecutions, params).Get(ctx, &result)
 	if err != nil {
 		logger.Error("Failed to list open workflow executions.", zap.Error(err))
 		return err
@@ -104,6 +167,10 @@ func recoverWorkflow(ctx workflow.Context, params Params) error {
 	if result.Count < concurrency {
 		concurrency = result.Count
 	}
+	if concurrency == 0 {
+		logger.Info("Workflow completed, no executions to recover.")
+		return nil
+	}
 
 	batchSize := result.Count / concurrency
 	if result.Count%concurrency != 0 {
@@ -126,14 +193,22 @@ func recoverWorkflow(ctx workflow.Context, params Params) error {
 		HeartbeatTimeout:       time.Second * 30,
 		RetryPolicy:            retryPolicy,
 	}
-	ctx = workflow.WithActivityOptions(ctx, ao)
+	recoverCtx := workflow.WithActivityOptions(ctx, ao)
 
 	doneCh := workflow.NewChannel(ctx)
 	for i := 0; i < concurrency; i++ {
 		startIndex := i * batchSize
+		batch := RecoveryBatch{Key: result.ID, StartIndex: startIndex, BatchSize: batchSize}
+		if params.ExecutionsInHistory {
+			endIndex := startIndex + batchSize
+			if endIndex > len(result.Executions) {
+				endIndex = len(result.Executions)
+			}
+			batch.Executions = result.Executions[startIndex:endIndex]
+		}
 
 		workflow.Go(ctx, func(ctx workflow.Context) {
-			err = workflow.ExecuteActivity(ctx, recoverExecutions, result.ID, startIndex, batchSize).Get(ctx, nil)
+			err := workflow.ExecuteActivity(recoverCtx, recoverExecutions, batch, params).Get(ctx, nil)
 			if err != nil {
 				logger.Error("Recover executions failed.", zap.Int("StartIndex", startIndex), zap.Error(err))
 			} else {
@@ -148,16 +223,22 @@ func recoverWorkflow(ctx workflow.Context, params Params) error {
 		doneCh.Receive(ctx, nil)
 	}
 
+	if !params.ExecutionsInHistory {
+		if err := workflow.ExecuteActivity(ctx, deleteExecutions, result.ID).Get(ctx, nil); err != nil {
+			logger.Warn("Failed to delete stored executions.", zap.String("Key", result.ID), zap.Error(err))
+		}
+	}
+
 	logger.Info("Workflow completed.", zap.Int("Result", result.Count))
 
 	return nil
 }
 
-func listOpenExecutions(ctx context.Context, workflowType string) (*ListOpenExecutionsResult, error) {
-	key := uuid.New()
+func listOpenExecutions(ctx context.Context, params Params) (*ListOpenExecutionsResult, error) {
+	key := executionsKey(ctx)
 	logger := activity.GetLogger(ctx)
 	logger.Info("List all open executions of type.",
-		zap.String("WorkflowType", workflowType),
+		zap.String("WorkflowType", params.Type),
 		zap.String("HostID", HostID))
 
 	cadenceClient, err := getCadenceClientFromContext(ctx)
@@ -165,43 +246,74 @@ func listOpenExecutions(ctx context.Context, workflowType string) (*ListOpenExec
 		return nil, err
 	}
 
-	executionsCache := ctx.Value(WorkflowExecutionCacheKey).(cache.Cache)
-	if executionsCache == nil {
-		logger.Error("Could not retrieve cache from context.")
-		return nil, ErrExecutionCacheNotFound
+	var executionStore store.Store
+	if !params.ExecutionsInHistory {
+		executionStore, err = getExecutionStoreFromContext(ctx)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	openExecutions, err := getAllExecutionsOfType(ctx, cadenceClient, workflowType)
+	openExecutions, err := getAllExecutionsOfType(ctx, cadenceClient, params.Type, executionStore, key)
 	if err != nil {
 		return nil, err
 	}
 
-	executionsCache.Put(key, openExecutions)
-	return &ListOpenExecutionsResult{
+	result := &ListOpenExecutionsResult{
 		ID:     key,
 		Count:  len(openExecutions),
 		HostID: HostID,
-	}, nil
+	}
+	if params.ExecutionsInHistory {
+		result.Executions = openExecutions
+		return result, nil
+	}
+
+	if err := executionStore.Put(ctx, key, openExecutions); err != nil {
+		return nil, err
+	}
+	return result, nil
 }
 
-func recoverExecutions(ctx context.Context, key string, startIndex, batchSize int) error {
+// executionsKey is the key of the executions listed for the recovery workflow run of the activity. Retries of the
+// listing use the same key, so that they replace the list stored by an earlier attempt.
+func executionsKey(ctx context.Context) string {
+	execution := activity.GetInfo(ctx).WorkflowExecution
+	return invalidKeyChars.ReplaceAllString(execution.ID, "_") + "_" + execution.RunID
+}
+
+func recoverExecutions(ctx context.Context, batch RecoveryBatch, params Params) error {
 	logger := activity.GetLogger(ctx)
 	logger.Info("Starting execution recovery.",
 		zap.String("HostID", HostID),
-		zap.String("Key", key),
-		zap.Int("StartIndex", startIndex),
-		zap.Int("BatchSize", batchSize))
-
-	executionsCache := ctx.Value(WorkflowExecutionCacheKey).(cache.Cache)
-	if executionsCache == nil {
-		logger.Error("Could not retrieve cache from context.")
-		return ErrExecutionCacheNotFound
+		zap.String("Key", batch.Key),
+		zap.String("Mode", string(params.mode())),
+		zap.Int("StartIndex", batch.StartIndex),
+		zap.Int("BatchSize", batch.BatchSize))
+
+	executions := batch.Executions
+	if !params.ExecutionsInHistory {
+		executionStore, err := getExecutionStoreFromContext(ctx)
+		if err != nil {
+			return err
+		}
+		// Any worker can load the executions, the store outlives the worker that listed them
+		openExecutions, err := executionStore.Get(ctx, batch.Key)
+		if err != nil {
+			return err
+		}
+		startIndex, endIndex := batch.StartIndex, batch.StartIndex+batch.BatchSize
+		if startIndex > len(openExecutions) {
+			startIndex = len(openExecutions)
+		}
+		if endIndex > len(openExecutions) {
+			endIndex = len(openExecutions)
+		}
+		executions = openExecutions[startIndex:endIndex]
 	}
 
-	openExecutions := executionsCache.Get(key).([]*shared.WorkflowExecution)
-	endIndex := startIndex + batchSize
-
 	// Check if this activity has previous heartbeat to retrieve progress from it
+	startIndex := 0
 	if activity.HasHeartbeatDetails(ctx) {
 		var finishedIndex int
 		if err := activity.GetHeartbeatDetails(ctx, &finishedIndex); err == nil {
@@ -210,9 +322,15 @@ func recoverExecutions(ctx context.Context, key string, startIndex, batchSize in
 		}
 	}
 
-	for index := startIndex; index < endIndex && index < len(openExecutions); index++ {
-		execution := openExecutions[index]
-		if err := recoverSingleExecution(ctx, execution.GetWorkflowId()); err != nil {
+	for index := startIndex; index < len(executions); index++ {
+		execution := executions[index]
+		var err error
+		if params.mode() == RecoveryModeReset {
+			err = resetSingleExecution(ctx, execution, params.ResetPoint)
+		} else {
+			err = recoverSingleExecution(ctx, execution.GetWorkflowId())
+		}
+		if err != nil {
 			logger.Error("Failed to recover execution.",
 				zap.String("WorkflowID", execution.GetWorkflowId()),
 				zap.Error(err))
@@ -226,6 +344,15 @@ func recoverExecutions(ctx context.Context, key string, startIndex, batchSize in
 	return nil
 }
 
+// deleteExecutions removes the executions of a finished recovery from the execution store
+func deleteExecutions(ctx context.Context, key string) error {
+	executionStore, err := getExecutionStoreFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	return executionStore.Delete(ctx, key)
+}
+
 func recoverSingleExecution(ctx context.Context, workflowID string) error {
 	logger := activity.GetLogger(ctx)
 	cadenceClient, err := getCadenceClientFromContext(ctx)
@@ -249,14 +376,20 @@ func recoverSingleExecution(ctx context.Context, workflowID string) error {
 	firstEvent := history[0]
 	lastEvent := history[len(history)-1]
 
+	// Dispatch to the recovery handler registered for the type of the execution
+	handler, err := getRecoveryHandler(firstEvent.WorkflowExecutionStartedEventAttributes.GetWorkflowType().GetName())
+	if err != nil {
+		return err
+	}
+
 	// Extract information from StartWorkflowExecution parameters so we can start a new run
-	params, err := extractStateFromEvent(workflowID, firstEvent)
+	params, err := extractStateFromEvent(workflowID, firstEvent, handler)
 	if err != nil {
 		return err
 	}
 
 	// Parse the entire history and extract all signals so they can be replayed back to new run
-	signals, err := extractSignals(history)
+	signals, err := extractSignals(history, handler)
 	if err != nil {
 		return err
 	}
@@ -270,7 +403,7 @@ func recoverSingleExecution(ctx context.Context, workflowID string) error {
 	}
 
 	// Start new execution run
-	newRun, err := cadenceClient.StartWorkflow(ctx, params.Options, "TripWorkflow", params.State)
+	newRun, err := cadenceClient.StartWorkflow(ctx, params.Options, params.WorkflowType, params.Args...)
 	if err != nil {
 		return err
 	}
@@ -287,47 +420,74 @@ func recoverSingleExecution(ctx context.Context, workflowID string) error {
 	return nil
 }
 
-func extractStateFromEvent(workflowID string, event *shared.HistoryEvent) (*RestartParams, error) {
+// resetSingleExecution rewinds the execution to the reset point instead of replacing it with a new run. The server
+// applies the signals received after the reset point to the new run, so nothing has to be re-sent.
+func resetSingleExecution(ctx context.Context, execution *shared.WorkflowExecution, point common.ResetPoint) error {
+	logger := activity.GetLogger(ctx)
+	cadenceClient, err := getCadenceClientFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	domain, _ := ctx.Value(DomainKey).(string)
+	newRunID, err := common.ResetWorkflow(ctx, cadenceClient, domain,
+		execution.GetWorkflowId(), execution.GetRunId(), "Recover", point)
+	if errors.Is(err, common.ErrNoResetPoint) {
+		// The execution has not completed a decision at the reset point yet, nothing to rewind
+		logger.Warn("Skipped execution without reset point.",
+			zap.String("WorkflowID", execution.GetWorkflowId()),
+			zap.Error(err))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	logger.Info("Successfully reset workflow.",
+		zap.String("WorkflowID", execution.GetWorkflowId()),
+		zap.String("ResetPoint", point.String()),
+		zap.String("NewRunID", newRunID))
+
+	return nil
+}
+
+func (p Params) mode() RecoveryMode {
+	if p.Mode == "" {
+		return RecoveryModeRestart
+	}
+	return p.Mode
+}
+
+func extractStateFromEvent(workflowID string, event *shared.HistoryEvent, handler RecoveryHandler) (*RestartParams, error) {
 	switch event.GetEventType() {
 	case shared.EventTypeWorkflowExecutionStarted:
 		attr := event.WorkflowExecutionStartedEventAttributes
-		state, err := deserializeUserState(attr.Input)
+		args, err := handler.ExtractState(attr.Input)
 		if err != nil {
 			// Corrupted Workflow Execution State
 			return nil, err
 		}
 		return &RestartParams{
-			Options: client.StartWorkflowOptions{
-				ID:                              workflowID,
-				TaskList:                        attr.TaskList.GetName(),
-				ExecutionStartToCloseTimeout:    time.Second * time.Duration(attr.GetExecutionStartToCloseTimeoutSeconds()),
-				DecisionTaskStartToCloseTimeout: time.Second * time.Duration(attr.GetTaskStartToCloseTimeoutSeconds()),
-				WorkflowIDReusePolicy:           client.WorkflowIDReusePolicyAllowDuplicate,
-				//RetryPolicy: attr.RetryPolicy,
-			},
-			State: state,
+			WorkflowType: attr.WorkflowType.GetName(),
+			Options:      handler.RestartOptions(workflowID, attr),
+			Args:         args,
 		}, nil
 	default:
 		return nil, errors.New("Unknown event type")
 	}
 }
 
-func extractSignals(events []*shared.HistoryEvent) ([]*SignalParams, error) {
+func extractSignals(events []*shared.HistoryEvent, handler RecoveryHandler) ([]*SignalParams, error) {
 	var signals []*SignalParams
 	for _, event := range events {
 		if event.GetEventType() == shared.EventTypeWorkflowExecutionSignaled {
 			attr := event.WorkflowExecutionSignaledEventAttributes
-			if attr.GetSignalName() == TripSignalName && attr.Input != nil && len(attr.Input) > 0 {
-				signalData, err := deserializeTripEvent(attr.Input)
-				if err != nil {
-					// Corrupted Signal Payload
-					return nil, err
-				}
-
-				signal := &SignalParams{
-					Name: attr.GetSignalName(),
-					Data: signalData,
-				}
+			signal, err := handler.TransformSignal(attr.GetSignalName(), attr.Input)
+			if err != nil {
+				// Corrupted Signal Payload
+				return nil, err
+			}
+			if signal != nil {
 				signals = append(signals, signal)
 			}
 		}
@@ -347,33 +507,63 @@ func isExecutionCompleted(event *shared.HistoryEvent) bool {
 	}
 }
 
+// getAllExecutionsOfType lists the open executions of the workflow type a page at a time. Before the next page it
+// heartbeats the page token, so that a retried activity resumes the listing instead of starting over. The executions
+// listed before the token are put into the execution store under key, or into the heartbeat without a store.
 func getAllExecutionsOfType(ctx context.Context, cadenceClient client.Client,
-	workflowType string) ([]*shared.WorkflowExecution, error) {
-	var openExecutions []*shared.WorkflowExecution
-	var nextPageToken []byte
-	for hasMore := true; hasMore; hasMore = len(nextPageToken) > 0 {
-		resp, err := cadenceClient.ListOpenWorkflow(ctx, &shared.ListOpenWorkflowExecutionsRequest{
-			Domain:          common.StringPtr(DomainName),
-			MaximumPageSize: common.Int32Ptr(10),
-			NextPageToken:   nextPageToken,
-			StartTimeFilter: &shared.StartTimeFilter{
-				EarliestTime: common.Int64Ptr(0),
-				LatestTime:   common.Int64Ptr(time.Now().UnixNano()),
-			},
-			TypeFilter: &shared.WorkflowTypeFilter{
-				Name: common.StringPtr(workflowType),
-			},
-		})
-		if err != nil {
+	workflowType string, executionStore store.Store, key string) ([]*shared.WorkflowExecution, error) {
+	var progress listProgress
+	if activity.HasHeartbeatDetails(ctx) {
+		if err := activity.GetHeartbeatDetails(ctx, &progress); err != nil {
 			return nil, err
 		}
+		if executionStore != nil {
+			executions, err := executionStore.Get(ctx, key)
+			if err != nil {
+				return nil, err
+			}
+			// Heartbeats are throttled, the store can hold pages listed after the last heartbeat that reached the
+			// server. They are listed again from its page token.
+			if len(executions) < progress.Count {
+				return nil, fmt.Errorf("stored list %v has %d executions, the heartbeat expects %d", key,
+					len(executions), progress.Count)
+			}
+			progress.Executions = executions[:progress.Count]
+		}
+	}
 
-		for _, r := range resp.Executions {
-			openExecutions = append(openExecutions, r.Execution)
+	openExecutions := progress.Executions
+	domain, _ := ctx.Value(DomainKey).(string)
+	it := common.ListOpenExecutions(ctx, cadenceClient, domain, common.ExecutionFilter{
+		WorkflowType: workflowType,
+		PageSize:     10,
+		PageToken:    progress.PageToken,
+	})
+	for {
+		page, err := it.NextPage()
+		if err != nil {
+			return nil, err
+		}
+		if len(page) == 0 {
+			break
+		}
+		for _, info := range page {
+			openExecutions = append(openExecutions, info.Execution)
 		}
 
-		nextPageToken = resp.NextPageToken
-		activity.RecordHeartbeat(ctx, nextPageToken)
+		pageToken := it.NextPageToken()
+		if len(pageToken) == 0 {
+			continue
+		}
+		progress = listProgress{PageToken: pageToken, Count: len(openExecutions)}
+		if executionStore != nil {
+			if err := executionStore.Put(ctx, key, openExecutions); err != nil {
+				return nil, err
+			}
+		} else {
+			progress.Executions = openExecutions
+		}
+		activity.RecordHeartbeat(ctx, progress)
 	}
 
 	return openExecutions, nil
@@ -410,3 +600,14 @@ func getCadenceClientFromContext(ctx context.Context) (client.Client, error) {
 
 	return cadenceClient, nil
 }
+
+func getExecutionStoreFromContext(ctx context.Context) (store.Store, error) {
+	logger := activity.GetLogger(ctx)
+	executionStore, ok := ctx.Value(ExecutionStoreKey).(store.Store)
+	if !ok || executionStore == nil {
+		logger.Error("Could not retrieve execution store from context.")
+		return nil, ErrExecutionStoreNotFound
+	}
+
+	return executionStore, nil
+}
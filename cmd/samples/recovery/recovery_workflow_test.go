@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/cadence/.gen/go/shared"
+	"go.uber.org/cadence/client"
+	"go.uber.org/cadence/testsuite"
+	"go.uber.org/cadence/worker"
+
+	"github.com/uber-common/cadence-samples/cmd/samples/common"
+	"github.com/uber-common/cadence-samples/cmd/samples/recovery/store"
+)
+
+type fakeListClient struct {
+	client.Client
+	executions []*shared.WorkflowExecution
+	// pageSize splits the executions into pages, the page token is the index of the first execution of the page
+	pageSize int
+	// domains are the domains of the requests
+	domains []string
+	// pageTokens are the page tokens of the listing requests
+	pageTokens []string
+}
+
+func (c *fakeListClient) ListOpenWorkflow(ctx context.Context, request *shared.ListOpenWorkflowExecutionsRequest) (*shared.ListOpenWorkflowExecutionsResponse, error) {
+	c.domains = append(c.domains, request.GetDomain())
+	c.pageTokens = append(c.pageTokens, string(request.NextPageToken))
+	executions := c.executions
+	var nextPageToken []byte
+	if c.pageSize > 0 {
+		start, _ := strconv.Atoi(string(request.NextPageToken))
+		end := start + c.pageSize
+		if end < len(executions) {
+			nextPageToken = []byte(strconv.Itoa(end))
+		} else {
+			end = len(executions)
+		}
+		executions = executions[start:end]
+	}
+	var infos []*shared.WorkflowExecutionInfo
+	for _, execution := range executions {
+		infos = append(infos, &shared.WorkflowExecutionInfo{Execution: execution})
+	}
+	return &shared.ListOpenWorkflowExecutionsResponse{Executions: infos, NextPageToken: nextPageToken}, nil
+}
+
+func (c *fakeListClient) GetWorkflowHistory(ctx context.Context, workflowID, runID string, isLongPoll bool, filterType shared.HistoryEventFilterType) client.HistoryEventIterator {
+	eventType := shared.EventTypeDecisionTaskCompleted
+	return &fakeHistoryIterator{events: []*shared.HistoryEvent{{EventId: common.Int64Ptr(4), EventType: &eventType}}}
+}
+
+func (c *fakeListClient) ResetWorkflow(ctx context.Context, request *shared.ResetWorkflowExecutionRequest) (*shared.ResetWorkflowExecutionResponse, error) {
+	c.domains = append(c.domains, request.GetDomain())
+	return &shared.ResetWorkflowExecutionResponse{RunId: common.StringPtr("reset-run")}, nil
+}
+
+type fakeHistoryIterator struct {
+	events []*shared.HistoryEvent
+}
+
+func (it *fakeHistoryIterator) HasNext() bool {
+	return len(it.events) > 0
+}
+
+func (it *fakeHistoryIterator) Next() (*shared.HistoryEvent, error) {
+	event := it.events[0]
+	it.events = it.events[1:]
+	return event, nil
+}
+
+func TestListOpenExecutionsStore(t *testing.T) {
+	executions := []*shared.WorkflowExecution{
+		{WorkflowId: common.StringPtr("UserA"), RunId: common.StringPtr("run-1")},
+		{WorkflowId: common.StringPtr("UserB"), RunId: common.StringPtr("run-2")},
+	}
+	executionStore, err := store.NewFileStore(t.TempDir())
+	require.NoError(t, err)
+	listClient := &fakeListClient{executions: executions}
+	ctx := context.WithValue(context.Background(), CadenceClientKey, client.Client(listClient))
+	ctx = context.WithValue(ctx, ExecutionStoreKey, executionStore)
+	ctx = context.WithValue(ctx, DomainKey, "samples-domain")
+
+	var s testsuite.WorkflowTestSuite
+	env := s.NewTestActivityEnvironment()
+	env.SetWorkerOptions(worker.Options{BackgroundActivityContext: ctx})
+
+	val, err := env.ExecuteActivity(listOpenExecutions, Params{Type: "TripWorkflow"})
+	require.NoError(t, err)
+	var result ListOpenExecutionsResult
+	require.NoError(t, val.Get(&result))
+	assert.Equal(t, 2, result.Count)
+	assert.Empty(t, result.Executions)
+	assert.Equal(t, []string{"samples-domain"}, listClient.domains)
+	stored, err := executionStore.Get(context.Background(), result.ID)
+	require.NoError(t, err)
+	assert.Equal(t, executions, stored)
+
+	_, err = env.ExecuteActivity(deleteExecutions, result.ID)
+	require.NoError(t, err)
+	_, err = executionStore.Get(context.Background(), result.ID)
+	assert.ErrorIs(t, err, store.ErrNotFound)
+
+	val, err = env.ExecuteActivity(listOpenExecutions, Params{Type: "TripWorkflow", ExecutionsInHistory: true})
+	require.NoError(t, err)
+	require.NoError(t, val.Get(&result))
+	assert.Equal(t, executions, result.Executions)
+	_, err = executionStore.Get(context.Background(), result.ID)
+	assert.ErrorIs(t, err, store.ErrNotFound)
+}
+
+func TestListOpenExecutionsResumesFromHeartbeat(t *testing.T) {
+	executions := []*shared.WorkflowExecution{
+		{WorkflowId: common.StringPtr("UserA"), RunId: common.StringPtr("run-1")},
+		{WorkflowId: common.StringPtr("UserB"), RunId: common.StringPtr("run-2")},
+		{WorkflowId: common.StringPtr("UserC"), RunId: common.StringPtr("run-3")},
+	}
+	executionStore, err := store.NewFileStore(t.TempDir())
+	require.NoError(t, err)
+	listClient := &fakeListClient{executions: executions, pageSize: 1}
+	ctx := context.WithValue(context.Background(), CadenceClientKey, client.Client(listClient))
+	ctx = context.WithValue(ctx, ExecutionStoreKey, executionStore)
+
+	var s testsuite.WorkflowTestSuite
+	env := s.NewTestActivityEnvironment()
+	env.SetWorkerOptions(worker.Options{BackgroundActivityContext: ctx})
+
+	// The key of the list is the same for every attempt of the run
+	val, err := env.ExecuteActivity(listOpenExecutions, Params{Type: "TripWorkflow"})
+	require.NoError(t, err)
+	var result ListOpenExecutionsResult
+	require.NoError(t, val.Get(&result))
+	assert.Equal(t, "default-test-workflow-id_default-test-run-id", result.ID)
+	assert.Equal(t, []string{"", "1", "2"}, listClient.pageTokens)
+
+	// A retried attempt continues with the page after the last heartbeat and the executions stored before it
+	require.NoError(t, executionStore.Put(context.Background(), result.ID, executions[:2]))
+	listClient.pageTokens = nil
+	env.SetHeartbeatDetails(listProgress{PageToken: []byte("2"), Count: 2})
+	val, err = env.ExecuteActivity(listOpenExecutions, Params{Type: "TripWorkflow"})
+	require.NoError(t, err)
+	require.NoError(t, val.Get(&result))
+	assert.Equal(t, 3, result.Count)
+	assert.Equal(t, []string{"2"}, listClient.pageTokens)
+	stored, err := executionStore.Get(context.Background(), result.ID)
+	require.NoError(t, err)
+	assert.Equal(t, executions, stored)
+
+	// The store holds a page listed after the last heartbeat that reached the server, it is listed again
+	require.NoError(t, executionStore.Put(context.Background(), result.ID, executions[:2]))
+	listClient.pageTokens = nil
+	env.SetHeartbeatDetails(listProgress{PageToken: []byte("1"), Count: 1})
+	val, err = env.ExecuteActivity(listOpenExecutions, Params{Type: "TripWorkflow"})
+	require.NoError(t, err)
+	require.NoError(t, val.Get(&result))
+	assert.Equal(t, 3, result.Count)
+	assert.Equal(t, []string{"1", "2"}, listClient.pageTokens)
+	stored, err = executionStore.Get(context.Background(), result.ID)
+	require.NoError(t, err)
+	assert.Equal(t, executions, stored)
+
+	// Without the store the executions listed before the page are in the heartbeat
+	listClient.pageTokens = nil
+	env.SetHeartbeatDetails(listProgress{PageToken: []byte("1"), Count: 1, Executions: executions[:1]})
+	val, err = env.ExecuteActivity(listOpenExecutions, Params{Type: "TripWorkflow", ExecutionsInHistory: true})
+	require.NoError(t, err)
+	require.NoError(t, val.Get(&result))
+	assert.Equal(t, executions, result.Executions)
+	assert.Equal(t, []string{"1", "2"}, listClient.pageTokens)
+}
+
+func TestResetExecutionsUsesConfiguredDomain(t *testing.T) {
+	resetClient := &fakeListClient{}
+	ctx := context.WithValue(context.Background(), CadenceClientKey, client.Client(resetClient))
+	ctx = context.WithValue(ctx, DomainKey, "samples-domain")
+
+	var s testsuite.WorkflowTestSuite
+	env := s.NewTestActivityEnvironment()
+	env.SetWorkerOptions(worker.Options{BackgroundActivityContext: ctx})
+
+	batch := RecoveryBatch{Executions: []*shared.WorkflowExecution{
+		{WorkflowId: common.StringPtr("UserA"), RunId: common.StringPtr("run-1")},
+	}}
+	_, err := env.ExecuteActivity(recoverExecutions, batch, Params{ExecutionsInHistory: true, Mode: RecoveryModeReset})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"samples-domain"}, resetClient.domains)
+}
@@ -0,0 +1,103 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"go.uber.org/cadence/.gen/go/shared"
+)
+
+var validKey = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// FileStore stores each execution list as a JSON file in a directory. Lists survive a worker restart and are
+// shared by every worker with access to the directory, e.g. the workers of one host or of a shared volume.
+type FileStore struct {
+	dir string
+}
+
+// NewFileStore creates a store in dir, creating the directory if needed
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create store directory: %w", err)
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+// Put writes the list to a temporary file and renames it, so readers never see a partial list
+func (s *FileStore) Put(ctx context.Context, key string, executions []*shared.WorkflowExecution) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(executions)
+	if err != nil {
+		return fmt.Errorf("failed to encode executions: %w", err)
+	}
+
+	f, err := os.CreateTemp(s.dir, key+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create execution list: %w", err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write execution list: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to sync execution list: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to close execution list: %w", err)
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return fmt.Errorf("failed to store execution list: %w", err)
+	}
+	return nil
+}
+
+// Get reads the list stored under the key
+func (s *FileStore) Get(ctx context.Context, key string) ([]*shared.WorkflowExecution, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %v", ErrNotFound, key)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read execution list: %w", err)
+	}
+
+	var executions []*shared.WorkflowExecution
+	if err := json.Unmarshal(data, &executions); err != nil {
+		return nil, fmt.Errorf("failed to decode execution list: %w", err)
+	}
+	return executions, nil
+}
+
+// Delete removes the list stored under the key
+func (s *FileStore) Delete(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete execution list: %w", err)
+	}
+	return nil
+}
+
+// path maps the key to a file in the store directory, rejecting keys that could escape it
+func (s *FileStore) path(key string) (string, error) {
+	if !validKey.MatchString(key) {
+		return "", fmt.Errorf("invalid execution list key %q", key)
+	}
+	return filepath.Join(s.dir, key+".json"), nil
+}
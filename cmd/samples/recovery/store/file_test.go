@@ -0,0 +1,48 @@
+package store
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/cadence/.gen/go/shared"
+)
+
+func execution(workflowID, runID string) *shared.WorkflowExecution {
+	return &shared.WorkflowExecution{WorkflowId: &workflowID, RunId: &runID}
+}
+
+func TestFileStore(t *testing.T) {
+	ctx := context.Background()
+	dir := filepath.Join(t.TempDir(), "executions")
+	s, err := NewFileStore(dir)
+	require.NoError(t, err)
+
+	executions := []*shared.WorkflowExecution{execution("UserA", "run-1"), execution("UserB", "run-2")}
+	require.NoError(t, s.Put(ctx, "recovery-1", executions))
+
+	// a second store on the same directory, e.g. another worker or a restarted one, reads the list
+	other, err := NewFileStore(dir)
+	require.NoError(t, err)
+	got, err := other.Get(ctx, "recovery-1")
+	require.NoError(t, err)
+	assert.Equal(t, executions, got)
+
+	require.NoError(t, s.Put(ctx, "recovery-1", executions[:1]))
+	got, err = s.Get(ctx, "recovery-1")
+	require.NoError(t, err)
+	assert.Equal(t, executions[:1], got)
+
+	require.NoError(t, s.Delete(ctx, "recovery-1"))
+	require.NoError(t, s.Delete(ctx, "recovery-1"))
+	_, err = s.Get(ctx, "recovery-1")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	matches, err := filepath.Glob(filepath.Join(dir, "*"))
+	require.NoError(t, err)
+	assert.Empty(t, matches)
+
+	assert.ErrorContains(t, s.Put(ctx, "../escape", executions), "invalid execution list key")
+}
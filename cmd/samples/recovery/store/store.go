@@ -0,0 +1,25 @@
+package store
+
+import (
+	"context"
+	"errors"
+
+	"go.uber.org/cadence/.gen/go/shared"
+)
+
+// ErrNotFound is returned by Get when no execution list is stored under the key
+var ErrNotFound = errors.New("execution list not found")
+
+// A Store persists the execution lists the recovery workflow works through, so that the activity listing the
+// executions and the activities recovering them do not have to run in the same process. See FileStore for a
+// local implementation.
+type Store interface {
+	// Put stores the executions under the key, replacing a list stored before
+	Put(ctx context.Context, key string, executions []*shared.WorkflowExecution) error
+
+	// Get returns the executions stored under the key, or ErrNotFound
+	Get(ctx context.Context, key string) ([]*shared.WorkflowExecution, error)
+
+	// Delete removes the executions stored under the key, deleting a missing key is not an error
+	Delete(ctx context.Context, key string) error
+}
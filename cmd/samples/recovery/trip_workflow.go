@@ -31,6 +31,33 @@ const (
 	QueryName = "counter"
 )
 
+// Register how TripWorkflow executions are restarted by the recovery workflow. Runs continued as new are started
+// under the TripWorkflow name, the first run under the name main registers.
+func init() {
+	tripRecovery := RecoveryHandler{
+		ExtractState: func(input []byte) ([]interface{}, error) {
+			state, err := deserializeUserState(input)
+			if err != nil {
+				return nil, err
+			}
+			return []interface{}{state}, nil
+		},
+		TransformSignal: func(name string, input []byte) (*SignalParams, error) {
+			// Only trip events are replayed, other signals are dropped
+			if name != TripSignalName || len(input) == 0 {
+				return nil, nil
+			}
+			trip, err := deserializeTripEvent(input)
+			if err != nil {
+				return nil, err
+			}
+			return &SignalParams{Name: name, Data: trip}, nil
+		},
+	}
+	RegisterRecoveryHandler("tripWorkflow", tripRecovery)
+	RegisterRecoveryHandler("TripWorkflow", tripRecovery)
+}
+
 // tripWorkflow to keep track of total trip count for a user
 // It waits on a TripEvent signal and increments a counter on each signal received by this workflow
 // Trip count is managed as workflow state and passed to new run after 10 signals received by each execution
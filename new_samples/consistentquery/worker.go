@@ -5,6 +5,10 @@
 package main
 
 import (
+	"os"
+	"strings"
+	"time"
+
 	"github.com/uber-go/tally"
 	apiv1 "github.com/uber/cadence-idl/go/proto/api/v1"
 	"go.uber.org/cadence/.gen/go/cadence/workflowserviceclient"
@@ -28,14 +32,18 @@ const (
 	TaskListName   = "cadence-samples-worker"
 	ClientName     = "cadence-samples-worker"
 	CadenceService = "cadence-frontend"
+
+	// WorkerStopTimeout is how long in-flight activities get to finish when the worker is stopped
+	WorkerStopTimeout = 10 * time.Second
 )
 
-// StartWorker creates and starts a basic Cadence worker.
-func StartWorker() {
+// StartWorker creates and starts a basic Cadence worker and returns it so it can be stopped on shutdown.
+func StartWorker() []worker.Worker {
 	logger, cadenceClient := BuildLogger(), BuildCadenceClient()
 	workerOptions := worker.Options{
-		Logger:       logger,
-		MetricsScope: tally.NewTestScope(TaskListName, nil),
+		Logger:            logger,
+		MetricsScope:      tally.NewTestScope(TaskListName, nil),
+		WorkerStopTimeout: WorkerStopTimeout,
 	}
 
 	w := worker.New(
@@ -51,7 +59,7 @@ func StartWorker() {
 		panic("Failed to start worker: " + err.Error())
 	}
 	logger.Info("Started Worker.", zap.String("worker", TaskListName))
-
+	return []worker.Worker{w}
 }
 
 func BuildCadenceClient(dialOptions ...grpc.DialOption) workflowserviceclient.Interface {
@@ -86,9 +94,26 @@ func BuildCadenceClient(dialOptions ...grpc.DialOption) workflowserviceclient.In
 	)
 }
 
+// BuildLogger creates the worker logger. It logs at info level in console format unless overridden with the
+// CADENCE_LOG_LEVEL, CADENCE_LOG_ENCODING (console or json) and CADENCE_LOG_OUTPUT (comma separated paths)
+// environment variables. JSON logs carry the service and host so they can be shipped to a log pipeline.
 func BuildLogger() *zap.Logger {
 	config := zap.NewDevelopmentConfig()
+	if os.Getenv("CADENCE_LOG_ENCODING") == "json" {
+		config = zap.NewProductionConfig()
+		config.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+		host, _ := os.Hostname()
+		config.InitialFields = map[string]interface{}{"service": ClientName, "host": host}
+	}
 	config.Level.SetLevel(zapcore.InfoLevel)
+	if level := os.Getenv("CADENCE_LOG_LEVEL"); level != "" {
+		if err := config.Level.UnmarshalText([]byte(level)); err != nil {
+			panic("Invalid CADENCE_LOG_LEVEL: " + err.Error())
+		}
+	}
+	if output := os.Getenv("CADENCE_LOG_OUTPUT"); output != "" {
+		config.OutputPaths = strings.Split(output, ",")
+	}
 
 	var err error
 	logger, err := config.Build()
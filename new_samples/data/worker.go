@@ -6,6 +6,8 @@ package main
 import (
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/uber-go/tally"
 	apiv1 "github.com/uber/cadence-idl/go/proto/api/v1"
@@ -32,28 +34,36 @@ const (
 	TaskListCompression = "cadence-samples-data-compression"
 	TaskListEncryption  = "cadence-samples-data-encryption"
 	TaskListS3          = "cadence-samples-data-s3"
+
+	// WorkerStopTimeout is how long in-flight activities get to finish when the workers are stopped
+	WorkerStopTimeout = 10 * time.Second
 )
 
-// StartWorker starts one worker per DataConverter sample and prints startup stats for each.
-func StartWorker() {
+// StartWorker starts one worker per DataConverter sample, prints startup stats for each and returns the workers so
+// they can be stopped on shutdown.
+func StartWorker() []worker.Worker {
 	logger := BuildLogger()
 	cadenceClient := BuildCadenceClient()
 
-	startCompressionWorker(logger, cadenceClient)
-	startEncryptionWorker(logger, cadenceClient)
-	startS3OffloadWorker(logger, cadenceClient)
+	workers := []worker.Worker{
+		startCompressionWorker(logger, cadenceClient),
+		startEncryptionWorker(logger, cadenceClient),
+		startS3OffloadWorker(logger, cadenceClient),
+	}
 
 	printCompressionStats()
 	printEncryptionStats()
 	printS3OffloadStats()
+	return workers
 }
 
-func startCompressionWorker(logger *zap.Logger, cadenceClient workflowserviceclient.Interface) {
+func startCompressionWorker(logger *zap.Logger, cadenceClient workflowserviceclient.Interface) worker.Worker {
 	dataConverter := NewCompressedJSONDataConverter()
 	workerOptions := worker.Options{
-		Logger:        logger,
-		MetricsScope:  tally.NewTestScope(TaskListCompression, nil),
-		DataConverter: dataConverter,
+		Logger:            logger,
+		MetricsScope:      tally.NewTestScope(TaskListCompression, nil),
+		DataConverter:     dataConverter,
+		WorkerStopTimeout: WorkerStopTimeout,
 	}
 
 	w := worker.New(cadenceClient, Domain, TaskListCompression, workerOptions)
@@ -64,18 +74,20 @@ func startCompressionWorker(logger *zap.Logger, cadenceClient workflowservicecli
 		panic("Failed to start compression worker: " + err.Error())
 	}
 	logger.Info("Started compression worker", zap.String("task_list", TaskListCompression))
+	return w
 }
 
-func startEncryptionWorker(logger *zap.Logger, cadenceClient workflowserviceclient.Interface) {
+func startEncryptionWorker(logger *zap.Logger, cadenceClient workflowserviceclient.Interface) worker.Worker {
 	key := LoadEncryptionKey()
 	dataConverter, err := NewEncryptedJSONDataConverter(key)
 	if err != nil {
 		panic("Failed to create encryption data converter: " + err.Error())
 	}
 	workerOptions := worker.Options{
-		Logger:        logger,
-		MetricsScope:  tally.NewTestScope(TaskListEncryption, nil),
-		DataConverter: dataConverter,
+		Logger:            logger,
+		MetricsScope:      tally.NewTestScope(TaskListEncryption, nil),
+		DataConverter:     dataConverter,
+		WorkerStopTimeout: WorkerStopTimeout,
 	}
 
 	w := worker.New(cadenceClient, Domain, TaskListEncryption, workerOptions)
@@ -86,15 +98,17 @@ func startEncryptionWorker(logger *zap.Logger, cadenceClient workflowserviceclie
 		panic("Failed to start encryption worker: " + err.Error())
 	}
 	logger.Info("Started encryption worker", zap.String("task_list", TaskListEncryption))
+	return w
 }
 
-func startS3OffloadWorker(logger *zap.Logger, cadenceClient workflowserviceclient.Interface) {
+func startS3OffloadWorker(logger *zap.Logger, cadenceClient workflowserviceclient.Interface) worker.Worker {
 	store := NewLocalFSBlobStore()
 	dataConverter := NewS3OffloadDataConverter(store, "cadence-samples-data-s3", defaultThresholdBytes)
 	workerOptions := worker.Options{
-		Logger:        logger,
-		MetricsScope:  tally.NewTestScope(TaskListS3, nil),
-		DataConverter: dataConverter,
+		Logger:            logger,
+		MetricsScope:      tally.NewTestScope(TaskListS3, nil),
+		DataConverter:     dataConverter,
+		WorkerStopTimeout: WorkerStopTimeout,
 	}
 
 	w := worker.New(cadenceClient, Domain, TaskListS3, workerOptions)
@@ -105,6 +119,7 @@ func startS3OffloadWorker(logger *zap.Logger, cadenceClient workflowserviceclien
 		panic("Failed to start S3 offload worker: " + err.Error())
 	}
 	logger.Info("Started S3 offload worker", zap.String("task_list", TaskListS3))
+	return w
 }
 
 // printCompressionStats displays gzip compression statistics for the sample payload.
@@ -194,9 +209,26 @@ func BuildCadenceClient(dialOptions ...grpc.DialOption) workflowserviceclient.In
 	)
 }
 
+// BuildLogger creates the worker logger. It logs at info level in console format unless overridden with the
+// CADENCE_LOG_LEVEL, CADENCE_LOG_ENCODING (console or json) and CADENCE_LOG_OUTPUT (comma separated paths)
+// environment variables. JSON logs carry the service and host so they can be shipped to a log pipeline.
 func BuildLogger() *zap.Logger {
 	config := zap.NewDevelopmentConfig()
+	if os.Getenv("CADENCE_LOG_ENCODING") == "json" {
+		config = zap.NewProductionConfig()
+		config.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+		host, _ := os.Hostname()
+		config.InitialFields = map[string]interface{}{"service": ClientName, "host": host}
+	}
 	config.Level.SetLevel(zapcore.InfoLevel)
+	if level := os.Getenv("CADENCE_LOG_LEVEL"); level != "" {
+		if err := config.Level.UnmarshalText([]byte(level)); err != nil {
+			panic("Invalid CADENCE_LOG_LEVEL: " + err.Error())
+		}
+	}
+	if output := os.Getenv("CADENCE_LOG_OUTPUT"); output != "" {
+		config.OutputPaths = strings.Split(output, ",")
+	}
 
 	var err error
 	logger, err := config.Build()
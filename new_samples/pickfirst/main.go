@@ -11,10 +11,16 @@ import (
 )
 
 func main() {
-	StartWorker()
+	workers := StartWorker()
 
 	done := make(chan os.Signal, 1)
-	signal.Notify(done, syscall.SIGINT)
+	signal.Notify(done, syscall.SIGINT, syscall.SIGTERM)
 	fmt.Println("Cadence worker started, press ctrl+c to terminate...")
 	<-done
+
+	// Stop waits up to WorkerStopTimeout for in-flight activities and decisions to finish
+	fmt.Println("Stopping Cadence worker...")
+	for _, w := range workers {
+		w.Stop()
+	}
 }